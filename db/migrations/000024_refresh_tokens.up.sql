@@ -0,0 +1,23 @@
+create table if not exists refreshtokens(
+  id uuid primary key default uuid_generate_v4(),
+  userid uuid not null,
+  userendid uuid,
+
+  token varchar(64) not null,
+  expires timestamptz not null,
+  revoked boolean not null default false,
+
+  cat timestamptz default now(),
+  uat timestamptz default now()
+);
+
+create unique index rt_token on refreshtokens (token);
+create index rt_uid on refreshtokens (userid);
+create index rt_ueid on refreshtokens (userendid);
+
+drop trigger if exists uat_refreshtokens on refreshtokens;
+
+create trigger uat_refreshtokens
+before update on refreshtokens
+for each row
+  execute procedure moddatetime(uat);
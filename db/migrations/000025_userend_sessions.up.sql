@@ -0,0 +1,4 @@
+alter table userends add column lastseen timestamptz;
+alter table userends add column revoked boolean not null default false;
+
+create index ue_lastseen on userends (lastseen);
@@ -0,0 +1,28 @@
+alter table users add column email varchar(256);
+alter table users add column emailverified boolean not null default false;
+
+create unique index users_email on users (lower(email)) where email is not null;
+
+create table if not exists usertokens(
+  id uuid primary key default uuid_generate_v4(),
+  userid uuid not null,
+
+  type varchar(32) not null,
+  token varchar(64) not null,
+  email varchar(256),
+  expires timestamptz not null,
+  used boolean not null default false,
+
+  cat timestamptz default now(),
+  uat timestamptz default now()
+);
+
+create unique index ut_token on usertokens (token);
+create index ut_uid on usertokens (userid);
+
+drop trigger if exists uat_usertokens on usertokens;
+
+create trigger uat_usertokens
+before update on usertokens
+for each row
+  execute procedure moddatetime(uat);
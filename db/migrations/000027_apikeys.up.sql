@@ -0,0 +1,23 @@
+create table if not exists apikeys(
+  id uuid primary key default uuid_generate_v4(),
+  userid uuid not null,
+
+  name varchar(64) not null,
+  prefix varchar(16) not null,
+  key varchar(64) not null,
+  scopes text[] not null default '{}',
+  lastused timestamptz,
+
+  cat timestamptz default now(),
+  uat timestamptz default now()
+);
+
+create unique index ak_key on apikeys (key);
+create index ak_uid on apikeys (userid);
+
+drop trigger if exists uat_apikeys on apikeys;
+
+create trigger uat_apikeys
+before update on apikeys
+for each row
+  execute procedure moddatetime(uat);
@@ -0,0 +1,41 @@
+create table if not exists usertotps(
+  id uuid primary key default uuid_generate_v4(),
+  userid uuid not null,
+
+  secret varchar(64) not null,
+  enabled boolean not null default false,
+  laststep bigint not null default 0,
+
+  cat timestamptz default now(),
+  uat timestamptz default now()
+);
+
+create unique index utotp_uid on usertotps (userid);
+
+drop trigger if exists uat_usertotps on usertotps;
+
+create trigger uat_usertotps
+before update on usertotps
+for each row
+  execute procedure moddatetime(uat);
+
+create table if not exists recoverycodes(
+  id uuid primary key default uuid_generate_v4(),
+  userid uuid not null,
+
+  code varchar(64) not null,
+  used boolean not null default false,
+
+  cat timestamptz default now(),
+  uat timestamptz default now()
+);
+
+create index rc_uid on recoverycodes (userid);
+create unique index rc_code on recoverycodes (code);
+
+drop trigger if exists uat_recoverycodes on recoverycodes;
+
+create trigger uat_recoverycodes
+before update on recoverycodes
+for each row
+  execute procedure moddatetime(uat);
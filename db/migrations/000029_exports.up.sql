@@ -0,0 +1,20 @@
+create table if not exists exports(
+  id uuid primary key default uuid_generate_v4(),
+  userid uuid not null,
+
+  status varchar(16) not null default 'pending',
+  filepath varchar,
+  error varchar,
+
+  cat timestamptz default now(),
+  uat timestamptz default now()
+);
+
+create index ex_uid on exports (userid);
+
+drop trigger if exists uat_exports on exports;
+
+create trigger uat_exports
+before update on exports
+for each row
+  execute procedure moddatetime(uat);
@@ -0,0 +1,7 @@
+alter table users add column deleted boolean not null default false;
+alter table users add column purgeat timestamptz;
+
+create index users_purgeat on users (purgeat) where deleted = true;
+
+-- comments of deleted users left on other people's diaries are reassigned to this user
+insert into users (id, nickname, password) values ('00000000-0000-0000-0000-000000000000', '[deleted]', '!') on conflict do nothing;
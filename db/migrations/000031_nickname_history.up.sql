@@ -0,0 +1,19 @@
+create table if not exists nicknames(
+  id uuid primary key default uuid_generate_v4(),
+  userid uuid not null,
+
+  nickname varchar(64) not null,
+
+  cat timestamptz default now(),
+  uat timestamptz default now()
+);
+
+create index nicknames_uid on nicknames (userid);
+create index nicknames_handle on nicknames (lower(replace(nickname, ' ', '')));
+
+drop trigger if exists uat_nicknames on nicknames;
+
+create trigger uat_nicknames
+before update on nicknames
+for each row
+  execute procedure moddatetime(uat);
@@ -0,0 +1,78 @@
+-- changeseq is the id of the last transaction that wrote the row, the /sync cursors are transaction snapshots
+create or replace function set_changeseq()
+returns trigger as $$
+begin
+  new.changeseq = txid_current();
+  return new;
+end;
+$$ language plpgsql;
+
+alter table boxes add column if not exists changeseq bigint not null default 0;
+create index boxes_changeseq on boxes (userid, changeseq);
+
+drop trigger if exists changeseq_boxes on boxes;
+
+create trigger changeseq_boxes
+before insert or update on boxes
+for each row
+  execute procedure set_changeseq();
+
+alter table plants add column if not exists changeseq bigint not null default 0;
+create index plants_changeseq on plants (userid, changeseq);
+
+drop trigger if exists changeseq_plants on plants;
+
+create trigger changeseq_plants
+before insert or update on plants
+for each row
+  execute procedure set_changeseq();
+
+alter table timelapses add column if not exists changeseq bigint not null default 0;
+create index timelapses_changeseq on timelapses (userid, changeseq);
+
+drop trigger if exists changeseq_timelapses on timelapses;
+
+create trigger changeseq_timelapses
+before insert or update on timelapses
+for each row
+  execute procedure set_changeseq();
+
+alter table devices add column if not exists changeseq bigint not null default 0;
+create index devices_changeseq on devices (userid, changeseq);
+
+drop trigger if exists changeseq_devices on devices;
+
+create trigger changeseq_devices
+before insert or update on devices
+for each row
+  execute procedure set_changeseq();
+
+alter table feeds add column if not exists changeseq bigint not null default 0;
+create index feeds_changeseq on feeds (userid, changeseq);
+
+drop trigger if exists changeseq_feeds on feeds;
+
+create trigger changeseq_feeds
+before insert or update on feeds
+for each row
+  execute procedure set_changeseq();
+
+alter table feedentries add column if not exists changeseq bigint not null default 0;
+create index feedentries_changeseq on feedentries (userid, changeseq);
+
+drop trigger if exists changeseq_feedentries on feedentries;
+
+create trigger changeseq_feedentries
+before insert or update on feedentries
+for each row
+  execute procedure set_changeseq();
+
+alter table feedmedias add column if not exists changeseq bigint not null default 0;
+create index feedmedias_changeseq on feedmedias (userid, changeseq);
+
+drop trigger if exists changeseq_feedmedias on feedmedias;
+
+create trigger changeseq_feedmedias
+before insert or update on feedmedias
+for each row
+  execute procedure set_changeseq();
@@ -0,0 +1,82 @@
+-- deletedat is kept by the trigger, objects deleted before this migration don't show in the trash
+create or replace function set_deletedat()
+returns trigger as $$
+begin
+  if new.deleted and (tg_op = 'INSERT' or not old.deleted) then
+    new.deletedat = now();
+  elsif not new.deleted then
+    new.deletedat = null;
+  end if;
+  return new;
+end;
+$$ language plpgsql;
+
+alter table boxes add column if not exists deletedat timestamptz;
+create index boxes_deletedat on boxes (userid, deletedat) where deleted = true;
+
+drop trigger if exists deletedat_boxes on boxes;
+
+create trigger deletedat_boxes
+before insert or update on boxes
+for each row
+  execute procedure set_deletedat();
+
+alter table plants add column if not exists deletedat timestamptz;
+create index plants_deletedat on plants (userid, deletedat) where deleted = true;
+
+drop trigger if exists deletedat_plants on plants;
+
+create trigger deletedat_plants
+before insert or update on plants
+for each row
+  execute procedure set_deletedat();
+
+alter table timelapses add column if not exists deletedat timestamptz;
+create index timelapses_deletedat on timelapses (userid, deletedat) where deleted = true;
+
+drop trigger if exists deletedat_timelapses on timelapses;
+
+create trigger deletedat_timelapses
+before insert or update on timelapses
+for each row
+  execute procedure set_deletedat();
+
+alter table devices add column if not exists deletedat timestamptz;
+create index devices_deletedat on devices (userid, deletedat) where deleted = true;
+
+drop trigger if exists deletedat_devices on devices;
+
+create trigger deletedat_devices
+before insert or update on devices
+for each row
+  execute procedure set_deletedat();
+
+alter table feeds add column if not exists deletedat timestamptz;
+create index feeds_deletedat on feeds (userid, deletedat) where deleted = true;
+
+drop trigger if exists deletedat_feeds on feeds;
+
+create trigger deletedat_feeds
+before insert or update on feeds
+for each row
+  execute procedure set_deletedat();
+
+alter table feedentries add column if not exists deletedat timestamptz;
+create index feedentries_deletedat on feedentries (userid, deletedat) where deleted = true;
+
+drop trigger if exists deletedat_feedentries on feedentries;
+
+create trigger deletedat_feedentries
+before insert or update on feedentries
+for each row
+  execute procedure set_deletedat();
+
+alter table feedmedias add column if not exists deletedat timestamptz;
+create index feedmedias_deletedat on feedmedias (userid, deletedat) where deleted = true;
+
+drop trigger if exists deletedat_feedmedias on feedmedias;
+
+create trigger deletedat_feedmedias
+before insert or update on feedmedias
+for each row
+  execute procedure set_deletedat();
@@ -0,0 +1,7 @@
+-- only one export in progress per user, older duplicates are failed first so the index can be built
+update exports set status = 'failed', error = 'Superseded by a newer export'
+where status in ('pending', 'running') and id not in (
+  select distinct on (userid) id from exports where status in ('pending', 'running') order by userid, cat desc
+);
+
+create unique index ex_uid_in_progress on exports (userid) where status in ('pending', 'running');
@@ -0,0 +1,41 @@
+-- userends syncing with /sync don't get userend_* rows
+alter table userends add column if not exists deltasync boolean not null default false;
+
+-- archiving or unarchiving a plant or a box changes the tombstones of its feed, timelapses, entries and medias,
+-- touching them gives them a new changeseq so the next /sync sends them
+create or replace function touch_plant_dependents()
+returns trigger as $$
+begin
+  update timelapses set changeseq = 0 where plantid = new.id;
+  update feeds set changeseq = 0 where id = new.feedid;
+  update feedentries set changeseq = 0 where feedid = new.feedid;
+  update feedmedias set changeseq = 0 where feedentryid in (select id from feedentries where feedid = new.feedid);
+  return null;
+end;
+$$ language plpgsql;
+
+drop trigger if exists dependents_plants on plants;
+
+create trigger dependents_plants
+after update on plants
+for each row
+  when (old.archived is distinct from new.archived)
+  execute procedure touch_plant_dependents();
+
+create or replace function touch_box_dependents()
+returns trigger as $$
+begin
+  update feeds set changeseq = 0 where id = new.feedid;
+  update feedentries set changeseq = 0 where feedid = new.feedid;
+  update feedmedias set changeseq = 0 where feedentryid in (select id from feedentries where feedid = new.feedid);
+  return null;
+end;
+$$ language plpgsql;
+
+drop trigger if exists dependents_boxes on boxes;
+
+create trigger dependents_boxes
+after update on boxes
+for each row
+  when (old.archived is distinct from new.archived)
+  execute procedure touch_box_dependents();
@@ -0,0 +1,5 @@
+-- userends created before lastseen existed start their idle period now instead of at their creation date,
+-- new userends are seen on creation
+update userends set lastseen = now() where lastseen is null;
+
+alter table userends alter column lastseen set default now();
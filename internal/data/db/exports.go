@@ -0,0 +1,143 @@
+/*
+ * Copyright (C) 2021  SuperGreenLab <towelie@supergreenlab.com>
+ * Author: Constantin Clauzel <constantin.clauzel@gmail.com>
+ *
+ * This program is free software: you can redistribute it and/or modify
+ * it under the terms of the GNU General Public License as published by
+ * the Free Software Foundation, either version 3 of the License, or
+ * (at your option) any later version.
+ *
+ * This program is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ * GNU General Public License for more details.
+ *
+ * You should have received a copy of the GNU General Public License
+ * along with this program.  If not, see <http://www.gnu.org/licenses/>.
+ */
+
+package db
+
+import (
+	"time"
+
+	"github.com/gofrs/uuid"
+	"gopkg.in/guregu/null.v3"
+)
+
+const (
+	ExportPending = "pending"
+	ExportRunning = "running"
+	ExportDone    = "done"
+	ExportFailed  = "failed"
+	// ExportExpired - the archive was removed from the exports bucket
+	ExportExpired = "expired"
+)
+
+// Export - account data export, the zip archive is stored in the exports bucket
+type Export struct {
+	ID     uuid.NullUUID `db:"id,omitempty" json:"id"`
+	UserID uuid.UUID     `db:"userid" json:"userID"`
+
+	Status   string      `db:"status" json:"status"`
+	FilePath null.String `db:"filepath,omitempty" json:"-"`
+	Error    null.String `db:"error,omitempty" json:"-"`
+
+	URL string `db:"-" json:"url,omitempty"`
+
+	CreatedAt time.Time `db:"cat,omitempty" json:"cat"`
+	UpdatedAt time.Time `db:"uat,omitempty" json:"uat"`
+}
+
+// UserExportTables - tables included in the account data exports, filtered on their userid column
+var UserExportTables = []string{
+	"boxes",
+	"plants",
+	"timelapses",
+	"timelapseframes",
+	"devices",
+	"feeds",
+	"feedentries",
+	"feedmedias",
+	"comments",
+	"likes",
+	"bookmarks",
+	"follows",
+	"nicknames",
+}
+
+// GetUserExportJSON - returns the user's rows of the table as a json array
+func GetUserExportJSON(table string, userID uuid.UUID) ([]byte, error) {
+	var b []byte
+	row, err := Sess.QueryRow("select coalesce(json_agg(t), '[]'::json) from (select * from "+table+" where userid = ? order by cat) t", userID)
+	if err != nil {
+		return nil, err
+	}
+	err = row.Scan(&b)
+	return b, err
+}
+
+// GetUserProfileExportJSON - same as GetUserExportJSON for the users table, without the password hash
+func GetUserProfileExportJSON(userID uuid.UUID) ([]byte, error) {
+	var b []byte
+	row, err := Sess.QueryRow("select to_jsonb(u) - 'password' from users u where id = ?", userID)
+	if err != nil {
+		return nil, err
+	}
+	err = row.Scan(&b)
+	return b, err
+}
+
+// SetExportStatus - ends a running export, returns false if it's not running anymore (failed by FailStaleExports)
+func SetExportStatus(id uuid.UUID, status string, filePath, exportErr null.String) (bool, error) {
+	res, err := Sess.Update("exports").Set("status", status, "filepath", filePath, "error", exportErr).Where("id = ?", id).And("status = ?", ExportRunning).Exec()
+	if err != nil {
+		return false, err
+	}
+	n, err := res.RowsAffected()
+	return n == 1, err
+}
+
+// TouchExport - heartbeat of the running exports, so FailStaleExports leaves them alone
+func TouchExport(id uuid.UUID) error {
+	_, err := Sess.Update("exports").Set("uat = now()").Where("id = ?", id).And("status = ?", ExportRunning).Exec()
+	return err
+}
+
+// GetExpiredExports - finished exports created before olderThan, their archive should be removed
+func GetExpiredExports(olderThan time.Time) ([]Export, error) {
+	exports := []Export{}
+	err := Sess.Select("*").From("exports").Where("status = ?", ExportDone).And("cat < ?", olderThan).All(&exports)
+	return exports, err
+}
+
+func SetExportExpired(id uuid.UUID) error {
+	_, err := Sess.Update("exports").Set("status", ExportExpired, "filepath", nil).Where("id = ?", id).Exec()
+	return err
+}
+
+// ClaimExport - moves a pending export to running, returns false if another worker already took it
+func ClaimExport(id uuid.UUID) (bool, error) {
+	res, err := Sess.Update("exports").Set("status", ExportRunning).Where("id = ?", id).And("status = ?", ExportPending).Exec()
+	if err != nil {
+		return false, err
+	}
+	n, err := res.RowsAffected()
+	return n == 1, err
+}
+
+// GetPendingExports - exports that were never picked up, the insert.exports publish only reaches the instance that created them
+func GetPendingExports(olderThan time.Time) ([]Export, error) {
+	exports := []Export{}
+	err := Sess.Select("*").From("exports").Where("status = ?", ExportPending).And("cat < ?", olderThan).OrderBy("cat").All(&exports)
+	return exports, err
+}
+
+// FailStaleExports - running exports not updated since olderThan, their worker died with its instance
+func FailStaleExports(olderThan time.Time) (int64, error) {
+	res, err := Sess.Update("exports").Set("status", ExportFailed, "error", "Export timed out").Where("status = ?", ExportRunning).And("uat < ?", olderThan).Exec()
+	if err != nil {
+		return 0, err
+	}
+	return res.RowsAffected()
+}
@@ -45,8 +45,8 @@ type Comment struct {
 
 	ReplyTo uuid.NullUUID `db:"replyto,omitempty" json:"replyTo,omitempty"`
 	Text    string        `db:"text" json:"text"`
-	Type    string        `db:"ctype" json:"type"`
-	Params  string        `db:"params" json:"params"`
+	Type    string        `db:"ctype" json:"type" validate:"required"`
+	Params  string        `db:"params" json:"params" validate:"json"`
 
 	CreatedAt time.Time `db:"cat,omitempty" json:"cat"`
 	UpdatedAt time.Time `db:"uat,omitempty" json:"uat"`
@@ -76,7 +76,7 @@ type Report struct {
 	CommentID   uuid.NullUUID `db:"commentid" json:"commentID"`
 	PlantID     uuid.NullUUID `db:"plantid" json:"plantID"`
 
-	Type string `db:"rtype" json:"type"`
+	Type string `db:"rtype" json:"type" validate:"required,max=50"`
 
 	CreatedAt time.Time `db:"cat,omitempty" json:"cat"`
 	UpdatedAt time.Time `db:"uat,omitempty" json:"uat"`
@@ -153,7 +153,7 @@ type LinkBookmark struct {
 	ID     uuid.NullUUID `db:"id,omitempty" json:"id"`
 	UserID uuid.UUID     `db:"userid" json:"userID"`
 
-	URL string `db:"url" json:"url"`
+	URL string `db:"url" json:"url" validate:"required,max=4096"`
 
 	CreatedAt time.Time `db:"cat,omitempty" json:"cat"`
 	UpdatedAt time.Time `db:"uat,omitempty" json:"uat"`
@@ -207,6 +207,12 @@ type UserEnd struct {
 
 	NotificationToken null.String `db:"notification_token" json:"notificationToken"`
 
+	LastSeen null.Time `db:"lastseen,omitempty" json:"lastSeen"`
+	Revoked  bool      `db:"revoked" json:"-"`
+
+	// DeltaSync - set by the clients using /sync, they don't get userend_* rows
+	DeltaSync bool `db:"deltasync" json:"deltaSync"`
+
 	CreatedAt time.Time `db:"cat,omitempty" json:"cat"`
 	UpdatedAt time.Time `db:"uat,omitempty" json:"uat"`
 }
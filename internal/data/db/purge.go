@@ -0,0 +1,141 @@
+/*
+ * Copyright (C) 2021  SuperGreenLab <towelie@supergreenlab.com>
+ * Author: Constantin Clauzel <constantin.clauzel@gmail.com>
+ *
+ * This program is free software: you can redistribute it and/or modify
+ * it under the terms of the GNU General Public License as published by
+ * the Free Software Foundation, either version 3 of the License, or
+ * (at your option) any later version.
+ *
+ * This program is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ * GNU General Public License for more details.
+ *
+ * You should have received a copy of the GNU General Public License
+ * along with this program.  If not, see <http://www.gnu.org/licenses/>.
+ */
+
+package db
+
+import (
+	"fmt"
+
+	"github.com/gofrs/uuid"
+	"upper.io/db.v3/lib/sqlbuilder"
+)
+
+// AnonymousUserID - owner of the comments left by deleted users on other people's diaries
+var AnonymousUserID = uuid.Nil
+
+// StorageObject - minio object to remove once its rows are purged
+type StorageObject struct {
+	Bucket string
+	Path   string
+}
+
+// userPurgeTables - tables hard-deleted on their userid column, in order
+var userPurgeTables = []string{
+	"likes",
+	"comments",
+	"bookmarks",
+	"reports",
+	"follows",
+	"linkbookmarks",
+	"feedmedias",
+	"feedentries",
+	"feeds",
+	"timelapseframes",
+	"timelapses",
+	"devices",
+	"plants",
+	"boxes",
+	"userends",
+	"refreshtokens",
+	"usertokens",
+	"apikeys",
+	"usertotps",
+	"recoverycodes",
+	"exports",
+	"nicknames",
+}
+
+// GetUserStorageObjects - minio objects referenced by the user's rows
+func GetUserStorageObjects(sess sqlbuilder.SQLBuilder, userID uuid.UUID) ([]StorageObject, error) {
+	objects := []StorageObject{}
+	queries := []struct {
+		bucket string
+		query  string
+	}{
+		{"feedmedias", "select filepath from feedmedias where userid = ?"},
+		{"feedmedias", "select thumbnailpath from feedmedias where userid = ?"},
+		{"timelapses", "select filepath from timelapseframes where userid = ?"},
+		{"users", "select pic from users where id = ? and pic is not null"},
+		{"exports", "select filepath from exports where userid = ? and filepath is not null"},
+	}
+	for _, q := range queries {
+		rows, err := sess.Query(q.query, userID)
+		if err != nil {
+			return nil, fmt.Errorf("%s: %w", q.bucket, err)
+		}
+		for rows.Next() {
+			var path string
+			if err := rows.Scan(&path); err != nil {
+				rows.Close()
+				return nil, fmt.Errorf("%s: %w", q.bucket, err)
+			}
+			if path != "" {
+				objects = append(objects, StorageObject{Bucket: q.bucket, Path: path})
+			}
+		}
+		rows.Close()
+	}
+	return objects, nil
+}
+
+// PurgeUser - hard-deletes everything the user owns, and the other users' social data attached to it
+func PurgeUser(sess sqlbuilder.SQLBuilder, userID uuid.UUID) error {
+	userFeedEntries := "select id from feedentries where userid = ?"
+	userPlants := "select id from plants where userid = ?"
+
+	// Comments left on other people's diaries stay, but anonymized
+	if _, err := sess.Exec("update comments set userid = ? where userid = ? and feedentryid not in ("+userFeedEntries+")", AnonymousUserID, userID, userID); err != nil {
+		return fmt.Errorf("comments: %w", err)
+	}
+
+	// Social data of the other users on the diaries being removed
+	others := []struct {
+		table string
+		query string
+		args  []interface{}
+	}{
+		{"likes", "delete from likes where feedentryid in (" + userFeedEntries + ") or commentid in (select id from comments where feedentryid in (" + userFeedEntries + "))", []interface{}{userID, userID}},
+		{"comments", "delete from comments where feedentryid in (" + userFeedEntries + ")", []interface{}{userID}},
+		{"bookmarks", "delete from bookmarks where feedentryid in (" + userFeedEntries + ")", []interface{}{userID}},
+		{"reports", "delete from reports where feedentryid in (" + userFeedEntries + ") or plantid in (" + userPlants + ") or commentid in (select id from comments where feedentryid in (" + userFeedEntries + "))", []interface{}{userID, userID, userID}},
+		{"follows", "delete from follows where plantid in (" + userPlants + ")", []interface{}{userID}},
+		{"plantsharings", "delete from plantsharings where userid = ? or touserid = ?", []interface{}{userID, userID}},
+	}
+	for _, o := range others {
+		if _, err := sess.Exec(o.query, o.args...); err != nil {
+			return fmt.Errorf("%s: %w", o.table, err)
+		}
+	}
+
+	for _, table := range UserEndTables {
+		if _, err := sess.Exec("delete from "+table+" where userendid in (select id from userends where userid = ?)", userID); err != nil {
+			return fmt.Errorf("%s: %w", table, err)
+		}
+	}
+
+	for _, table := range userPurgeTables {
+		if _, err := sess.DeleteFrom(table).Where("userid = ?", userID).Exec(); err != nil {
+			return fmt.Errorf("%s: %w", table, err)
+		}
+	}
+
+	if _, err := sess.DeleteFrom("users").Where("id = ?", userID).Exec(); err != nil {
+		return fmt.Errorf("users: %w", err)
+	}
+	return nil
+}
@@ -83,6 +83,12 @@ func GetDeviceFromPlantFeed(feedID uuid.UUID) (appbackend.Device, error) {
 	return device, nil
 }
 
+func GetUserEnd(id uuid.UUID) (UserEnd, error) {
+	userend := UserEnd{}
+	err := GetObjectWithField("id", id, "userends", &userend)
+	return userend, err
+}
+
 func GetUserEndsForUserID(userID uuid.UUID) ([]UserEnd, error) {
 	userends := []UserEnd{}
 
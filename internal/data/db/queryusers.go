@@ -20,6 +20,7 @@ package db
 
 import (
 	"github.com/gofrs/uuid"
+	udb "upper.io/db.v3"
 )
 
 func GetUser(userID uuid.UUID) (User, error) {
@@ -28,8 +29,46 @@ func GetUser(userID uuid.UUID) (User, error) {
 	return user, err
 }
 
+// IsUserActive - false for deleted users waiting for their purge, and for unknown ids
+func IsUserActive(userID uuid.UUID) (bool, error) {
+	n, err := Sess.Collection("users").Find().Where("id = ?", userID).And("deleted = ?", false).Count()
+	return n == 1, err
+}
+
+// GetUserForNickname - falls back to the previous nicknames, so old mentions still resolve.
+// Deleted users and the anonymous user can't be mentioned.
 func GetUserForNickname(nickname string) (User, error) {
 	user := User{}
-	err := GetObjectWithField("nickname", nickname, "users", &user)
-	return user, err
+	err := Sess.Select("*").From("users").Where("nickname = ?", nickname).And("deleted = ?", false).And("id != ?", AnonymousUserID).One(&user)
+	if err != udb.ErrNoMoreRows {
+		return user, err
+	}
+	userID, err := GetUserIDForOldNickname(nickname)
+	if err != nil {
+		return user, err
+	}
+	return GetUser(userID)
+}
+
+// GetUserIDForOldNickname - most recent owner of the nickname, nicknames are compared like login handles
+func GetUserIDForOldNickname(nickname string) (uuid.UUID, error) {
+	n := Nickname{}
+	err := Sess.Select("n.*").From("nicknames n").
+		Join("users u").On("u.id = n.userid").
+		Where("lower(replace(n.nickname, ' ', '')) = lower(replace(?, ' ', ''))", nickname).
+		And("u.deleted = ?", false).
+		OrderBy("n.cat DESC").One(&n)
+	return n.UserID, err
+}
+
+func GetAPIKeyForKey(hashedKey string) (APIKey, error) {
+	apiKey := APIKey{}
+	err := GetObjectWithField("key", hashedKey, "apikeys", &apiKey)
+	return apiKey, err
+}
+
+// TouchAPIKey - updates lastused, at most once every 5 minutes
+func TouchAPIKey(id uuid.UUID) error {
+	_, err := Sess.Update("apikeys").Set("lastused = now()").Where("id = ?", id).And("(lastused is null or lastused < now() - interval '5 minutes')").Exec()
+	return err
 }
@@ -0,0 +1,56 @@
+/*
+ * Copyright (C) 2021  SuperGreenLab <towelie@supergreenlab.com>
+ * Author: Constantin Clauzel <constantin.clauzel@gmail.com>
+ *
+ * This program is free software: you can redistribute it and/or modify
+ * it under the terms of the GNU General Public License as published by
+ * the Free Software Foundation, either version 3 of the License, or
+ * (at your option) any later version.
+ *
+ * This program is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ * GNU General Public License for more details.
+ *
+ * You should have received a copy of the GNU General Public License
+ * along with this program.  If not, see <http://www.gnu.org/licenses/>.
+ */
+
+package db
+
+import (
+	"context"
+	"errors"
+
+	"upper.io/db.v3/lib/sqlbuilder"
+)
+
+var errNestedTx = errors.New("Nested transactions are not supported")
+
+// the alias gives the embedded field a name that doesn't collide with the Tx method
+type transaction = sqlbuilder.Tx
+
+// TxSession - runs the code written for a sqlbuilder.Database inside a transaction
+type TxSession struct {
+	transaction
+}
+
+var _ sqlbuilder.Database = &TxSession{}
+
+func NewTxSession(tx sqlbuilder.Tx) *TxSession {
+	return &TxSession{tx}
+}
+
+// NewTx - the caller would be able to commit the parent transaction
+func (s *TxSession) NewTx(ctx context.Context) (sqlbuilder.Tx, error) {
+	return nil, errNestedTx
+}
+
+// Tx - nested transactions are part of the parent one, an error rolls back everything
+func (s *TxSession) Tx(ctx context.Context, fn func(sess sqlbuilder.Tx) error) error {
+	return fn(s.transaction)
+}
+
+func (s *TxSession) WithContext(ctx context.Context) sqlbuilder.Database {
+	return &TxSession{s.transaction.WithContext(ctx)}
+}
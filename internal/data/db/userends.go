@@ -0,0 +1,89 @@
+/*
+ * Copyright (C) 2021  SuperGreenLab <towelie@supergreenlab.com>
+ * Author: Constantin Clauzel <constantin.clauzel@gmail.com>
+ *
+ * This program is free software: you can redistribute it and/or modify
+ * it under the terms of the GNU General Public License as published by
+ * the Free Software Foundation, either version 3 of the License, or
+ * (at your option) any later version.
+ *
+ * This program is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ * GNU General Public License for more details.
+ *
+ * You should have received a copy of the GNU General Public License
+ * along with this program.  If not, see <http://www.gnu.org/licenses/>.
+ */
+
+package db
+
+import (
+	"fmt"
+	"time"
+
+	"github.com/gofrs/uuid"
+	"upper.io/db.v3/lib/sqlbuilder"
+)
+
+// UserEndTables - tables keeping track of which objects were sent to each userend
+var UserEndTables = []string{
+	"userend_boxes",
+	"userend_plants",
+	"userend_timelapses",
+	"userend_devices",
+	"userend_feeds",
+	"userend_feedentries",
+	"userend_feedmedias",
+}
+
+// LegacySyncUserEnds - active userends of a user still syncing with the userend_* tables, the other ones use /sync
+const LegacySyncUserEnds = "select id from userends where userid = ? and revoked = false and deltasync = false"
+
+// DeleteUserEndObjects - removes all the userend_* rows of a userend, returns the number of rows removed
+func DeleteUserEndObjects(sess sqlbuilder.SQLBuilder, userEndID uuid.UUID) (int64, error) {
+	var total int64
+	for _, table := range UserEndTables {
+		res, err := sess.DeleteFrom(table).Where("userendid = ?", userEndID).Exec()
+		if err != nil {
+			return total, fmt.Errorf("%s: %w", table, err)
+		}
+		if n, err := res.RowsAffected(); err == nil {
+			total += n
+		}
+	}
+	return total, nil
+}
+
+// RevokeUserEnd - flags the userend as revoked, its tokens are rejected from now on
+func RevokeUserEnd(sess sqlbuilder.SQLBuilder, userEndID uuid.UUID) error {
+	_, err := ExpireUserEnd(sess, userEndID)
+	return err
+}
+
+// ExpireUserEnd - revokes the userend, returns the number of userend_* rows removed
+func ExpireUserEnd(sess sqlbuilder.SQLBuilder, userEndID uuid.UUID) (int64, error) {
+	if _, err := sess.Update("userends").Set("revoked", true, "notification_token", nil).Where("id = ?", userEndID).Exec(); err != nil {
+		return 0, err
+	}
+	if _, err := sess.Update("refreshtokens").Set("revoked", true).Where("userendid = ?", userEndID).Exec(); err != nil {
+		return 0, err
+	}
+	return DeleteUserEndObjects(sess, userEndID)
+}
+
+// DeleteRevokedUserEnds - removes the userends revoked before the given date, with their refresh tokens.
+// Returns the number of userends removed.
+func DeleteRevokedUserEnds(sess sqlbuilder.SQLBuilder, before time.Time) (int64, error) {
+	revoked := "select id from userends where revoked = true and uat < ?"
+	for _, table := range append([]string{"refreshtokens"}, UserEndTables...) {
+		if _, err := sess.Exec("delete from "+table+" where userendid in ("+revoked+")", before); err != nil {
+			return 0, fmt.Errorf("%s: %w", table, err)
+		}
+	}
+	res, err := sess.DeleteFrom("userends").Where("revoked = ?", true).And("uat < ?", before).Exec()
+	if err != nil {
+		return 0, fmt.Errorf("userends: %w", err)
+	}
+	return res.RowsAffected()
+}
@@ -23,17 +23,24 @@ import (
 
 	"github.com/gofrs/uuid"
 	"gopkg.in/guregu/null.v3"
+	"upper.io/db.v3/postgresql"
 )
 
 // User -
 type User struct {
 	ID       uuid.NullUUID `db:"id,omitempty" json:"id"`
-	Nickname string        `db:"nickname" json:"nickname"`
+	Nickname string        `db:"nickname" json:"nickname" validate:"max=64"`
 	Password string        `db:"password,omitempty" json:"password"`
 
+	Email         null.String `db:"email,omitempty" json:"email,omitempty"`
+	EmailVerified bool        `db:"emailverified,omitempty" json:"emailVerified"`
+
 	Pic   null.String `db:"pic,omitempty" json:"pic,omitempty"`
 	Liked bool        `db:"liked,omitempty" json:"liked,omitempty"`
 
+	Deleted bool      `db:"deleted,omitempty" json:"-"`
+	PurgeAt null.Time `db:"purgeat,omitempty" json:"-"`
+
 	CreatedAt time.Time `db:"cat,omitempty" json:"cat"`
 	UpdatedAt time.Time `db:"uat,omitempty" json:"uat"`
 }
@@ -41,3 +48,88 @@ type User struct {
 func (u *User) GetID() uuid.NullUUID {
 	return u.ID
 }
+
+// RefreshToken -
+type RefreshToken struct {
+	ID        uuid.NullUUID `db:"id,omitempty" json:"id"`
+	UserID    uuid.UUID     `db:"userid" json:"userID"`
+	UserEndID uuid.NullUUID `db:"userendid" json:"userEndID"`
+
+	Token   string    `db:"token" json:"-"`
+	Expires time.Time `db:"expires" json:"expires"`
+	Revoked bool      `db:"revoked" json:"revoked"`
+
+	CreatedAt time.Time `db:"cat,omitempty" json:"cat"`
+	UpdatedAt time.Time `db:"uat,omitempty" json:"uat"`
+}
+
+const (
+	UserTokenPasswordReset     = "password_reset"
+	UserTokenEmailVerification = "email_verification"
+)
+
+// UserToken - single use tokens sent by email
+type UserToken struct {
+	ID     uuid.NullUUID `db:"id,omitempty" json:"id"`
+	UserID uuid.UUID     `db:"userid" json:"userID"`
+
+	Type    string      `db:"type" json:"type"`
+	Token   string      `db:"token" json:"-"`
+	Email   null.String `db:"email" json:"email"`
+	Expires time.Time   `db:"expires" json:"expires"`
+	Used    bool        `db:"used" json:"used"`
+
+	CreatedAt time.Time `db:"cat,omitempty" json:"cat"`
+	UpdatedAt time.Time `db:"uat,omitempty" json:"uat"`
+}
+
+// APIKey - scoped keys for scripts and third-party access, the key itself is only stored hashed
+type APIKey struct {
+	ID     uuid.NullUUID `db:"id,omitempty" json:"id"`
+	UserID uuid.UUID     `db:"userid" json:"userID"`
+
+	Name     string                 `db:"name" json:"name"`
+	Prefix   string                 `db:"prefix" json:"prefix"`
+	Key      string                 `db:"key" json:"-"`
+	Scopes   postgresql.StringArray `db:"scopes" json:"scopes"`
+	LastUsed null.Time              `db:"lastused,omitempty" json:"lastUsed"`
+
+	CreatedAt time.Time `db:"cat,omitempty" json:"cat"`
+	UpdatedAt time.Time `db:"uat,omitempty" json:"uat"`
+}
+
+// UserTOTP - TOTP secret of the user, 2FA is only required once enabled
+type UserTOTP struct {
+	ID     uuid.NullUUID `db:"id,omitempty" json:"id"`
+	UserID uuid.UUID     `db:"userid" json:"userID"`
+
+	Secret   string `db:"secret" json:"-"`
+	Enabled  bool   `db:"enabled" json:"enabled"`
+	LastStep int64  `db:"laststep" json:"-"`
+
+	CreatedAt time.Time `db:"cat,omitempty" json:"cat"`
+	UpdatedAt time.Time `db:"uat,omitempty" json:"uat"`
+}
+
+// RecoveryCode - single use 2FA codes, only stored hashed
+type RecoveryCode struct {
+	ID     uuid.NullUUID `db:"id,omitempty" json:"id"`
+	UserID uuid.UUID     `db:"userid" json:"userID"`
+
+	Code string `db:"code" json:"-"`
+	Used bool   `db:"used" json:"used"`
+
+	CreatedAt time.Time `db:"cat,omitempty" json:"cat"`
+	UpdatedAt time.Time `db:"uat,omitempty" json:"uat"`
+}
+
+// Nickname - previous nicknames of the user, they still resolve to the user
+type Nickname struct {
+	ID     uuid.NullUUID `db:"id,omitempty" json:"id"`
+	UserID uuid.UUID     `db:"userid" json:"userID"`
+
+	Nickname string `db:"nickname" json:"nickname"`
+
+	CreatedAt time.Time `db:"cat,omitempty" json:"cat"`
+	UpdatedAt time.Time `db:"uat,omitempty" json:"uat"`
+}
@@ -0,0 +1,53 @@
+/*
+ * Copyright (C) 2021  SuperGreenLab <towelie@supergreenlab.com>
+ * Author: Constantin Clauzel <constantin.clauzel@gmail.com>
+ *
+ * This program is free software: you can redistribute it and/or modify
+ * it under the terms of the GNU General Public License as published by
+ * the Free Software Foundation, either version 3 of the License, or
+ * (at your option) any later version.
+ *
+ * This program is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ * GNU General Public License for more details.
+ *
+ * You should have received a copy of the GNU General Public License
+ * along with this program.  If not, see <http://www.gnu.org/licenses/>.
+ */
+
+package kv
+
+import (
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/go-redis/redis"
+)
+
+func idempotencyKey(userID, collection, key string) string {
+	return fmt.Sprintf("IDEMPOTENCY.%s.%s.%s", userID, collection, key)
+}
+
+// LockIdempotencyKey - false if the key is already in use, the lock expires if the request never completes
+func LockIdempotencyKey(userID, collection, key string, expiration time.Duration) (bool, error) {
+	return r.SetNX(idempotencyKey(userID, collection, key), "", expiration).Result()
+}
+
+// GetIdempotencyKey - returns the inserted ID stored for the key, empty while the first request is still running
+func GetIdempotencyKey(userID, collection, key string) (string, bool, error) {
+	id, err := r.Get(idempotencyKey(userID, collection, key)).Result()
+	if errors.Is(err, redis.Nil) {
+		return "", false, nil
+	}
+	return id, err == nil, err
+}
+
+func SetIdempotencyKey(userID, collection, key, id string, retention time.Duration) error {
+	return r.Set(idempotencyKey(userID, collection, key), id, retention).Err()
+}
+
+func ReleaseIdempotencyKey(userID, collection, key string) error {
+	return r.Del(idempotencyKey(userID, collection, key)).Err()
+}
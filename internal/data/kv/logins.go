@@ -0,0 +1,60 @@
+/*
+ * Copyright (C) 2021  SuperGreenLab <towelie@supergreenlab.com>
+ * Author: Constantin Clauzel <constantin.clauzel@gmail.com>
+ *
+ * This program is free software: you can redistribute it and/or modify
+ * it under the terms of the GNU General Public License as published by
+ * the Free Software Foundation, either version 3 of the License, or
+ * (at your option) any later version.
+ *
+ * This program is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ * GNU General Public License for more details.
+ *
+ * You should have received a copy of the GNU General Public License
+ * along with this program.  If not, see <http://www.gnu.org/licenses/>.
+ */
+
+package kv
+
+import (
+	"fmt"
+	"time"
+)
+
+func loginFailuresKey(key string) string {
+	return fmt.Sprintf("LOGIN.%s.FAILURES", key)
+}
+
+func loginLockKey(key string) string {
+	return fmt.Sprintf("LOGIN.%s.LOCK", key)
+}
+
+// IncrLoginFailures - counts failed logins for the key, the counter is reset when no failure happened during window
+func IncrLoginFailures(key string, window time.Duration) (int64, error) {
+	pipe := r.TxPipeline()
+	incr := pipe.Incr(loginFailuresKey(key))
+	pipe.Expire(loginFailuresKey(key), window)
+	if _, err := pipe.Exec(); err != nil {
+		return 0, err
+	}
+	return incr.Val(), nil
+}
+
+func ResetLoginFailures(key string) error {
+	return r.Del(loginFailuresKey(key), loginLockKey(key)).Err()
+}
+
+func SetLoginLock(key string, duration time.Duration) error {
+	return r.Set(loginLockKey(key), 1, duration).Err()
+}
+
+// GetLoginLock - returns the time left before the key is unlocked, 0 if it's not locked
+func GetLoginLock(key string) (time.Duration, error) {
+	d, err := r.PTTL(loginLockKey(key)).Result()
+	if err != nil || d < 0 {
+		return 0, err
+	}
+	return d, nil
+}
@@ -0,0 +1,139 @@
+/*
+ * Copyright (C) 2021  SuperGreenLab <towelie@supergreenlab.com>
+ * Author: Constantin Clauzel <constantin.clauzel@gmail.com>
+ *
+ * This program is free software: you can redistribute it and/or modify
+ * it under the terms of the GNU General Public License as published by
+ * the Free Software Foundation, either version 3 of the License, or
+ * (at your option) any later version.
+ *
+ * This program is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ * GNU General Public License for more details.
+ *
+ * You should have received a copy of the GNU General Public License
+ * along with this program.  If not, see <http://www.gnu.org/licenses/>.
+ */
+
+package apierrors
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+
+	"github.com/sirupsen/logrus"
+	udb "upper.io/db.v3"
+)
+
+// Error codes, they're stable, clients should rely on them instead of the messages
+const (
+	CodeBadRequest           = "bad_request"
+	CodeUnauthorized         = "unauthorized"
+	CodeTokenExpired         = "token_expired"
+	CodeForbidden            = "forbidden"
+	CodeNotFound             = "not_found"
+	CodeConflict             = "conflict"
+	CodeIdempotencyKeyReused = "idempotency_key_reused"
+	CodeValidationFailed     = "validation_failed"
+	CodeTooManyAttempts      = "too_many_attempts"
+	CodeRequestTooLarge      = "request_too_large"
+	CodeUnsupportedMediaType = "unsupported_media_type"
+	CodeInternal             = "internal_error"
+)
+
+// RequestIDHeader - set on every response, also sent in the error responses
+const RequestIDHeader = "X-Request-ID"
+
+// Error - Message is sent to the client, it should never contain the raw error
+type Error struct {
+	Status  int
+	Code    string
+	Message string
+	Details interface{}
+}
+
+func (e *Error) Error() string {
+	return e.Message
+}
+
+// WithDetails - returns a copy of the error with the details set
+func (e *Error) WithDetails(details interface{}) *Error {
+	res := *e
+	res.Details = details
+	return &res
+}
+
+// New -
+func New(status int, code, message string) *Error {
+	return &Error{Status: status, Code: code, Message: message}
+}
+
+// BadRequest -
+func BadRequest(message string) *Error {
+	return New(http.StatusBadRequest, CodeBadRequest, message)
+}
+
+// Unauthorized -
+func Unauthorized(message string) *Error {
+	return New(http.StatusUnauthorized, CodeUnauthorized, message)
+}
+
+// Forbidden -
+func Forbidden(message string) *Error {
+	return New(http.StatusForbidden, CodeForbidden, message)
+}
+
+// NotFound -
+func NotFound(message string) *Error {
+	return New(http.StatusNotFound, CodeNotFound, message)
+}
+
+// Conflict -
+func Conflict(message string) *Error {
+	return New(http.StatusConflict, CodeConflict, message)
+}
+
+// ValidationFailed - details lists the invalid fields
+func ValidationFailed(details interface{}) *Error {
+	return New(http.StatusUnprocessableEntity, CodeValidationFailed, "Validation failed").WithDetails(details)
+}
+
+// Internal - the actual error is only logged
+func Internal() *Error {
+	return New(http.StatusInternalServerError, CodeInternal, http.StatusText(http.StatusInternalServerError))
+}
+
+// Response - body of every error response
+type Response struct {
+	Code      string      `json:"code"`
+	Message   string      `json:"message"`
+	Details   interface{} `json:"details,omitempty"`
+	RequestID string      `json:"requestID"`
+}
+
+// As - returns the typed error, missing rows become not found errors and the other untyped errors internal errors
+func As(err error) *Error {
+	var e *Error
+	if errors.As(err, &e) {
+		return e
+	}
+	if errors.Is(err, udb.ErrNoMoreRows) {
+		return NotFound(http.StatusText(http.StatusNotFound))
+	}
+	return Internal()
+}
+
+// Write - writes the error envelope, untyped errors are sent without their message.
+// Callers log the raw error before calling it.
+func Write(w http.ResponseWriter, err error) {
+	e := As(err)
+	res := Response{Code: e.Code, Message: e.Message, Details: e.Details, RequestID: w.Header().Get(RequestIDHeader)}
+	w.Header().Set("Content-Type", "application/json")
+	w.Header().Set("X-Content-Type-Options", "nosniff")
+	w.WriteHeader(e.Status)
+	if err := json.NewEncoder(w).Encode(res); err != nil {
+		logrus.Errorf("json.NewEncoder in Write %q - %+v", err, res)
+	}
+}
@@ -0,0 +1,91 @@
+/*
+ * Copyright (C) 2021  SuperGreenLab <towelie@supergreenlab.com>
+ * Author: Constantin Clauzel <constantin.clauzel@gmail.com>
+ *
+ * This program is free software: you can redistribute it and/or modify
+ * it under the terms of the GNU General Public License as published by
+ * the Free Software Foundation, either version 3 of the License, or
+ * (at your option) any later version.
+ *
+ * This program is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ * GNU General Public License for more details.
+ *
+ * You should have received a copy of the GNU General Public License
+ * along with this program.  If not, see <http://www.gnu.org/licenses/>.
+ */
+
+package apierrors
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"testing"
+
+	udb "upper.io/db.v3"
+)
+
+func TestAs(t *testing.T) {
+	conflict := Conflict("Already exists")
+	tests := []struct {
+		err    error
+		status int
+		code   string
+		msg    string
+	}{
+		{BadRequest("Invalid id"), http.StatusBadRequest, CodeBadRequest, "Invalid id"},
+		{conflict, http.StatusConflict, CodeConflict, "Already exists"},
+		{fmt.Errorf("insert: %w", conflict), http.StatusConflict, CodeConflict, "Already exists"},
+		{ValidationFailed(nil), http.StatusUnprocessableEntity, CodeValidationFailed, "Validation failed"},
+		{udb.ErrNoMoreRows, http.StatusNotFound, CodeNotFound, "Not Found"},
+		{fmt.Errorf("sess.Select: %w", udb.ErrNoMoreRows), http.StatusNotFound, CodeNotFound, "Not Found"},
+		{errors.New("pq: connection refused"), http.StatusInternalServerError, CodeInternal, "Internal Server Error"},
+		{udb.ErrNotConnected, http.StatusInternalServerError, CodeInternal, "Internal Server Error"},
+	}
+	for _, tt := range tests {
+		e := As(tt.err)
+		if e.Status != tt.status || e.Code != tt.code || e.Message != tt.msg {
+			t.Errorf("As(%q): got (%d, %s, %q), want (%d, %s, %q)", tt.err, e.Status, e.Code, e.Message, tt.status, tt.code, tt.msg)
+		}
+	}
+}
+
+func TestWrite(t *testing.T) {
+	details := []map[string]string{{"field": "name", "error": "is required"}}
+	tests := []struct {
+		err    error
+		status int
+		body   Response
+	}{
+		{NotFound("Plant not found"), http.StatusNotFound, Response{Code: CodeNotFound, Message: "Plant not found", RequestID: "req-1"}},
+		{ValidationFailed(details), http.StatusUnprocessableEntity, Response{Code: CodeValidationFailed, Message: "Validation failed", Details: []interface{}{map[string]interface{}{"field": "name", "error": "is required"}}, RequestID: "req-1"}},
+		{udb.ErrNoMoreRows, http.StatusNotFound, Response{Code: CodeNotFound, Message: "Not Found", RequestID: "req-1"}},
+		// the raw message of untyped errors is never sent
+		{errors.New("pq: password authentication failed"), http.StatusInternalServerError, Response{Code: CodeInternal, Message: "Internal Server Error", RequestID: "req-1"}},
+	}
+	for _, tt := range tests {
+		w := httptest.NewRecorder()
+		w.Header().Set(RequestIDHeader, "req-1")
+		Write(w, tt.err)
+
+		if w.Code != tt.status {
+			t.Errorf("Write(%q): got status %d, want %d", tt.err, w.Code, tt.status)
+		}
+		if ct := w.Header().Get("Content-Type"); ct != "application/json" {
+			t.Errorf("Write(%q): got Content-Type %q, want application/json", tt.err, ct)
+		}
+		res := Response{}
+		if err := json.Unmarshal(w.Body.Bytes(), &res); err != nil {
+			t.Errorf("Write(%q): invalid body %q - %s", tt.err, err, w.Body.String())
+			continue
+		}
+		if !reflect.DeepEqual(res, tt.body) {
+			t.Errorf("Write(%q): got body %+v, want %+v", tt.err, res, tt.body)
+		}
+	}
+}
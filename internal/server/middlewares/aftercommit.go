@@ -0,0 +1,59 @@
+/*
+ * Copyright (C) 2021  SuperGreenLab <towelie@supergreenlab.com>
+ * Author: Constantin Clauzel <constantin.clauzel@gmail.com>
+ *
+ * This program is free software: you can redistribute it and/or modify
+ * it under the terms of the GNU General Public License as published by
+ * the Free Software Foundation, either version 3 of the License, or
+ * (at your option) any later version.
+ *
+ * This program is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ * GNU General Public License for more details.
+ *
+ * You should have received a copy of the GNU General Public License
+ * along with this program.  If not, see <http://www.gnu.org/licenses/>.
+ */
+
+package middlewares
+
+import (
+	"net/http"
+	"sync"
+)
+
+// AfterCommitContextKey - context key which stores the AfterCommitQueue of the request's transaction
+type AfterCommitContextKey struct{}
+
+// AfterCommitQueue - side effects held back until the transaction is committed, dropped on rollback
+type AfterCommitQueue struct {
+	mu  sync.Mutex
+	fns []func()
+}
+
+func (q *AfterCommitQueue) Add(fn func()) {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	q.fns = append(q.fns, fn)
+}
+
+// Run - called once the transaction is committed
+func (q *AfterCommitQueue) Run() {
+	q.mu.Lock()
+	fns := q.fns
+	q.fns = nil
+	q.mu.Unlock()
+	for _, fn := range fns {
+		fn()
+	}
+}
+
+// AfterCommit - runs fn right away, or once the request's transaction is committed
+func AfterCommit(r *http.Request, fn func()) {
+	if q, ok := r.Context().Value(AfterCommitContextKey{}).(*AfterCommitQueue); ok {
+		q.Add(fn)
+		return
+	}
+	fn()
+}
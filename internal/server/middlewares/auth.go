@@ -23,11 +23,14 @@ import (
 	"fmt"
 	"net/http"
 	"strings"
+	"time"
 
+	"github.com/SuperGreenLab/AppBackend/internal/server/apierrors"
 	"github.com/rileyr/middleware/wares"
 
 	"github.com/spf13/pflag"
 
+	"github.com/SuperGreenLab/AppBackend/internal/data/db"
 	"github.com/SuperGreenLab/AppBackend/internal/server/tools"
 	appbackend "github.com/SuperGreenLab/AppBackend/pkg"
 	"github.com/dgrijalva/jwt-go"
@@ -42,13 +45,23 @@ import (
 var (
 	_ = pflag.String("jwtsecret", "", "JWT secret")
 	_ = pflag.String("logrequests", "true", "Set to false in production") // TODO move this somewhere else
+	_ = pflag.String("allownonexpiringtokens", "true", "Accept tokens issued before access tokens had an expiration date")
+	_ = pflag.String("nonexpiringtokenscutoff", "", "RFC3339 date, tokens without expiration date issued before it are rejected. Set once the apps able to refresh their tokens have shipped")
 )
 
 func init() {
 	viper.SetDefault("JWTSecret", "")
 	viper.SetDefault("LogRequests", "true")
+	viper.SetDefault("AllowNonExpiringTokens", "true")
+	viper.SetDefault("NonExpiringTokensCutoff", "")
 }
 
+// ErrTokenExpired - error code sent when the access token has expired, the client should call /token/refresh
+const ErrTokenExpired = apierrors.CodeTokenExpired
+
+// APIKeyPrefix - API keys are sent in place of the JWT token, this prefix tells them apart
+const APIKeyPrefix = "sglk_"
+
 // AnonStack - allows anonymous connection
 func AnonStack() middleware.Stack {
 	anon := middleware.NewStack()
@@ -106,7 +119,7 @@ func CheckAccessRight(collection, field string, optional bool, factory func() ap
 			if err := tools.CheckUserID(sess, uid, o, collection, field, optional, factory); err != nil {
 				errorMsg := "Object is owned by another user"
 				logrus.Errorf("CheckUserID in CheckAccessRight '%s' %q for uid: %s o.GetUserID: %s", errorMsg, err, uid, o.GetUserID())
-				http.Error(w, errorMsg, http.StatusUnauthorized)
+				apierrors.Write(w, apierrors.Unauthorized(errorMsg))
 				return
 			}
 
@@ -137,6 +150,11 @@ func JwtToken(fn httprouter.Handle) httprouter.Handle {
 			return
 		}
 
+		if strings.HasPrefix(tokenString, APIKeyPrefix) {
+			apiKeyToken(fn, w, r, p, tokenString)
+			return
+		}
+
 		token, err := jwt.Parse(tokenString, func(token *jwt.Token) (interface{}, error) {
 			if _, ok := token.Method.(*jwt.SigningMethodHMAC); !ok {
 				return nil, fmt.Errorf("Unexpected signing method: %v", token.Header["alg"])
@@ -145,19 +163,126 @@ func JwtToken(fn httprouter.Handle) httprouter.Handle {
 		})
 
 		if err != nil {
+			if ve, ok := err.(*jwt.ValidationError); ok && ve.Errors&jwt.ValidationErrorExpired != 0 {
+				w.Header().Set("WWW-Authenticate", fmt.Sprintf(`Bearer error="invalid_token", error_description="%s"`, ErrTokenExpired))
+				apierrors.Write(w, apierrors.New(http.StatusUnauthorized, ErrTokenExpired, "Access token expired"))
+				return
+			}
 			logrus.Errorln(err.Error())
-			http.Error(w, err.Error(), http.StatusUnauthorized)
+			apierrors.Write(w, apierrors.Unauthorized("Invalid token"))
 			return
 		}
 
 		if claims, ok := token.Claims.(jwt.MapClaims); ok && token.Valid {
+			if claims["type"] == tools.ChallengeTokenType {
+				errorMsg := "2FA challenge tokens can't be used as access tokens"
+				logrus.Errorln(errorMsg)
+				apierrors.Write(w, apierrors.Unauthorized(errorMsg))
+				return
+			}
+			if _, ok := claims["exp"]; !ok && !nonExpiringTokenAllowed(claims) {
+				errorMsg := "Token has no expiration date"
+				logrus.Errorf("%s - userID: %v", errorMsg, claims["userID"])
+				apierrors.Write(w, apierrors.Unauthorized(errorMsg))
+				return
+			}
+			uid := uuid.FromStringOrNil(claims["userID"].(string))
+			if ueid, ok := claims["userEndID"].(string); ok {
+				ue, err := db.GetUserEnd(uuid.FromStringOrNil(ueid))
+				if err != nil || ue.Revoked || ue.UserID != uid {
+					errorMsg := "UserEnd revoked"
+					logrus.Errorf("%s %v - ueid: %s uid: %s", errorMsg, err, ueid, uid)
+					apierrors.Write(w, apierrors.Unauthorized(errorMsg))
+					return
+				}
+			}
+			if !userActive(w, uid) {
+				return
+			}
 			ctx := context.WithValue(r.Context(), JwtClaimsContextKey{}, claims)
-			ctx = context.WithValue(ctx, UserIDContextKey{}, uuid.FromStringOrNil(claims["userID"].(string)))
+			ctx = context.WithValue(ctx, UserIDContextKey{}, uid)
+			// Tokens given to internal workers are limited like API keys
+			if scopes, ok := claims["scopes"].([]interface{}); ok {
+				ctx = context.WithValue(ctx, ScopesContextKey{}, tokenScopes(scopes))
+			}
 			fn(w, r.WithContext(ctx), p)
 		} else {
-			logrus.Errorln(err.Error())
-			http.Error(w, err.Error(), http.StatusUnauthorized)
+			logrus.Errorln("Invalid token claims")
+			apierrors.Write(w, apierrors.Unauthorized("Invalid token"))
 			return
 		}
 	}
 }
+
+// nonExpiringTokenAllowed - tokens issued before access tokens had an expiration date come without refresh token,
+// the ones issued before the cutoff are rejected. Legacy tokens have no iat, they're older than any cutoff.
+func nonExpiringTokenAllowed(claims jwt.MapClaims) bool {
+	if viper.GetString("AllowNonExpiringTokens") != "true" {
+		return false
+	}
+	cutoff := viper.GetString("NonExpiringTokensCutoff")
+	if cutoff == "" {
+		return true
+	}
+	t, err := time.Parse(time.RFC3339, cutoff)
+	if err != nil {
+		logrus.Errorf("time.Parse in nonExpiringTokenAllowed %q - cutoff: %s", err, cutoff)
+		return true
+	}
+	iat, ok := claims["iat"].(float64)
+	return ok && time.Unix(int64(iat), 0).After(t)
+}
+
+func tokenScopes(claim []interface{}) []string {
+	scopes := make([]string, 0, len(claim))
+	for _, s := range claim {
+		if scope, ok := s.(string); ok {
+			scopes = append(scopes, scope)
+		}
+	}
+	return scopes
+}
+
+// userActive - tokens of deleted users stop working right away, not when the purge runs
+func userActive(w http.ResponseWriter, uid uuid.UUID) bool {
+	active, err := db.IsUserActive(uid)
+	if err != nil {
+		logrus.Errorf("db.IsUserActive in userActive %q - uid: %s", err, uid)
+		apierrors.Write(w, err)
+		return false
+	}
+	if !active {
+		errorMsg := "User deleted"
+		logrus.Errorf("%s - uid: %s", errorMsg, uid)
+		apierrors.Write(w, apierrors.Unauthorized(errorMsg))
+		return false
+	}
+	return true
+}
+
+func apiKeyToken(fn httprouter.Handle, w http.ResponseWriter, r *http.Request, p httprouter.Params, key string) {
+	apiKey, err := db.GetAPIKeyForKey(tools.HashToken(key))
+	if err != nil {
+		errorMsg := "Invalid API key"
+		logrus.Errorf("db.GetAPIKeyForKey in apiKeyToken %q", err)
+		apierrors.Write(w, apierrors.Unauthorized(errorMsg))
+		return
+	}
+
+	if !userActive(w, apiKey.UserID) {
+		return
+	}
+
+	if err := db.TouchAPIKey(apiKey.ID.UUID); err != nil {
+		logrus.Errorf("db.TouchAPIKey in apiKeyToken %q - id: %s", err, apiKey.ID.UUID)
+	}
+
+	claims := jwt.MapClaims{
+		"userID":   apiKey.UserID.String(),
+		"apiKeyID": apiKey.ID.UUID.String(),
+	}
+	ctx := context.WithValue(r.Context(), JwtClaimsContextKey{}, claims)
+	ctx = context.WithValue(ctx, UserIDContextKey{}, apiKey.UserID)
+	ctx = context.WithValue(ctx, ScopesContextKey{}, []string(apiKey.Scopes))
+	fn(w, r.WithContext(ctx), p)
+}
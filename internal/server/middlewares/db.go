@@ -20,15 +20,22 @@ package middlewares
 
 import (
 	"context"
+	"errors"
+	"fmt"
 	"net/http"
+	"reflect"
+	"strings"
+	"time"
 
 	"github.com/SuperGreenLab/AppBackend/internal/data/db"
+	"github.com/SuperGreenLab/AppBackend/internal/server/apierrors"
 	appbackend "github.com/SuperGreenLab/AppBackend/pkg"
 
 	"github.com/gofrs/uuid"
 	"github.com/julienschmidt/httprouter"
 	"github.com/rileyr/middleware"
 	"github.com/sirupsen/logrus"
+	udb "upper.io/db.v3"
 	"upper.io/db.v3/lib/sqlbuilder"
 )
 
@@ -41,7 +48,7 @@ func CreateDBSession(fn httprouter.Handle) httprouter.Handle {
 		/*sess, err := postgresql.Open(db.Settings)
 		if err != nil {
 			logrus.Errorf("db.Open(): %q\n", err)
-			http.Error(w, err.Error(), http.StatusInternalServerError)
+			apierrors.Write(w, err)
 			return
 		}
 		defer sess.Close()*/
@@ -64,7 +71,7 @@ func InsertObject(collection string) middleware.Middleware {
 			id, err := col.Insert(o)
 			if err != nil {
 				logrus.Errorf("Insert in InsertObject %q - %s %+v", err, collection, o)
-				http.Error(w, err.Error(), http.StatusInternalServerError)
+				apierrors.Write(w, err)
 				return
 			}
 			ctx := context.WithValue(r.Context(), InsertedIDContextKey{}, uuid.FromStringOrNil(string(id.([]uint8))))
@@ -76,19 +83,100 @@ func InsertObject(collection string) middleware.Middleware {
 // UpdatedIDContextKey - context key which stores the updated object's ID
 type UpdatedIDContextKey struct{}
 
-// UpdateObject - Updates the db object with JSON payload object
+// ErrConflict - error code sent with the 409 responses of stale updates
+const ErrConflict = apierrors.CodeConflict
+
+type conflictDetails struct {
+	Current interface{} `json:"current"`
+}
+
+var errInvalidIfMatch = errors.New("Invalid If-Match header")
+
+// expectedUpdatedAt - uat the client last synced, from the If-Match header or the uat field of the payload
+func expectedUpdatedAt(r *http.Request, o interface{}) (time.Time, bool, error) {
+	if ifMatch := r.Header.Get("If-Match"); ifMatch != "" {
+		if ifMatch == "*" {
+			return time.Time{}, false, nil
+		}
+		t, err := time.Parse(time.RFC3339Nano, strings.Trim(strings.TrimPrefix(ifMatch, "W/"), "\""))
+		if err != nil {
+			return t, false, errInvalidIfMatch
+		}
+		return t, true, nil
+	}
+	v := reflect.ValueOf(o)
+	if v.Kind() == reflect.Ptr {
+		v = v.Elem()
+	}
+	if v.Kind() != reflect.Struct {
+		return time.Time{}, false, nil
+	}
+	f := v.FieldByName("UpdatedAt")
+	if !f.IsValid() {
+		return time.Time{}, false, nil
+	}
+	t, ok := f.Interface().(time.Time)
+	if !ok || t.IsZero() {
+		return time.Time{}, false, nil
+	}
+	return t, true, nil
+}
+
+// writeConflict - sends the current server copy so the client can merge
+func writeConflict(w http.ResponseWriter, sess sqlbuilder.Database, collection string, o appbackend.Object) {
+	current := reflect.New(reflect.TypeOf(o).Elem()).Interface()
+	if err := sess.Collection(collection).Find("id", o.GetID()).One(current); err != nil {
+		logrus.Errorf("Find in writeConflict %q - %s %+v", err, collection, o)
+		if err == udb.ErrNoMoreRows {
+			apierrors.Write(w, apierrors.NotFound("Object not found"))
+			return
+		}
+		apierrors.Write(w, err)
+		return
+	}
+	apierrors.Write(w, apierrors.Conflict("Object was updated since last sync").WithDetails(conflictDetails{Current: current}))
+}
+
+// UpdateObject - Updates the db object with JSON payload object, stale updates are rejected when the client sends the uat it last synced
 func UpdateObject(collection string) func(fn httprouter.Handle) httprouter.Handle {
 	return func(fn httprouter.Handle) httprouter.Handle {
 		return func(w http.ResponseWriter, r *http.Request, p httprouter.Params) {
 			o := r.Context().Value(ObjectContextKey{}).(appbackend.Object)
 			sess := r.Context().Value(SessContextKey{}).(sqlbuilder.Database)
-			col := sess.Collection(collection)
-			err := col.Find(o.GetID()).Update(o)
+
+			expected, check, err := expectedUpdatedAt(r, o)
 			if err != nil {
-				logrus.Errorf("Find in UpdateObject %q - %s %+v", err, collection, o)
-				http.Error(w, err.Error(), http.StatusInternalServerError)
+				logrus.Errorf("expectedUpdatedAt in UpdateObject %q - %s %+v", err, collection, o)
+				apierrors.Write(w, apierrors.BadRequest(err.Error()))
 				return
 			}
+
+			updater := sess.Update(collection).Set(o).Where("id = ?", o.GetID())
+			if check {
+				// full microsecond precision, as sent in the ETag, two writes can happen in the same millisecond
+				updater = updater.And("uat = ?", expected)
+			}
+			res, err := updater.Exec()
+			if err != nil {
+				logrus.Errorf("Update in UpdateObject %q - %s %+v", err, collection, o)
+				apierrors.Write(w, err)
+				return
+			}
+			if check {
+				if n, err := res.RowsAffected(); err != nil || n == 0 {
+					logrus.Warnf("Stale update in UpdateObject - %s %+v", collection, o)
+					writeConflict(w, sess, collection, o)
+					return
+				}
+			}
+
+			var uat struct {
+				UpdatedAt time.Time `db:"uat"`
+			}
+			if err := sess.Select("uat").From(collection).Where("id = ?", o.GetID()).One(&uat); err == nil {
+				w.Header().Set("ETag", fmt.Sprintf("\"%s\"", uat.UpdatedAt.Format(time.RFC3339Nano)))
+			}
+
 			ctx := context.WithValue(r.Context(), UpdatedIDContextKey{}, o.GetID().UUID)
 			fn(w, r.WithContext(ctx), p)
 		}
@@ -105,7 +193,7 @@ func SelectQuery(factory func() interface{}) func(fn httprouter.Handle) httprout
 			results := factory()
 			if err := selector.All(results); err != nil {
 				logrus.Errorf("All in SelectQuery %q", err)
-				http.Error(w, err.Error(), http.StatusInternalServerError)
+				apierrors.Write(w, err)
 				return
 			}
 			ctx := context.WithValue(r.Context(), SelectResultContextKey{}, results)
@@ -121,7 +209,7 @@ func SelectOneQuery(factory func() interface{}) func(fn httprouter.Handle) httpr
 			results := factory()
 			if err := selector.One(results); err != nil {
 				logrus.Errorf("One in SelectOneQuery %q", err)
-				http.Error(w, err.Error(), http.StatusInternalServerError)
+				apierrors.Write(w, err)
 				return
 			}
 			ctx := context.WithValue(r.Context(), SelectResultContextKey{}, results)
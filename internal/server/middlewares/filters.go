@@ -0,0 +1,213 @@
+/*
+ * Copyright (C) 2021  SuperGreenLab <towelie@supergreenlab.com>
+ * Author: Constantin Clauzel <constantin.clauzel@gmail.com>
+ *
+ * This program is free software: you can redistribute it and/or modify
+ * it under the terms of the GNU General Public License as published by
+ * the Free Software Foundation, either version 3 of the License, or
+ * (at your option) any later version.
+ *
+ * This program is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ * GNU General Public License for more details.
+ *
+ * You should have received a copy of the GNU General Public License
+ * along with this program.  If not, see <http://www.gnu.org/licenses/>.
+ */
+
+package middlewares
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"net/url"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/SuperGreenLab/AppBackend/internal/server/apierrors"
+	"github.com/gofrs/uuid"
+	"github.com/julienschmidt/httprouter"
+	"github.com/rileyr/middleware"
+	"github.com/sirupsen/logrus"
+	"upper.io/db.v3/lib/sqlbuilder"
+)
+
+// Filter value types, values are parsed before reaching the query
+const (
+	FilterString = "string"
+	FilterNumber = "number"
+	FilterBool   = "bool"
+	FilterTime   = "time"
+	FilterUUID   = "uuid"
+)
+
+// filterOps - sql operator of each filter operator, in takes a comma separated list
+var filterOps = map[string]string{
+	"eq":  "=",
+	"ne":  "!=",
+	"gt":  ">",
+	"gte": ">=",
+	"lt":  "<",
+	"lte": "<=",
+	"in":  "IN",
+}
+
+// FilterField - Column is the sql expression filtered on, Ops the operators allowed, eq only when empty
+type FilterField struct {
+	Column string
+	Type   string
+	Ops    []string
+}
+
+// Filters - whitelist of the fields accepted in the filter[field][op]=value query params
+type Filters map[string]FilterField
+
+var filterParam = regexp.MustCompile(`^filter\[(\w+)\](?:\[(\w+)\])?$`)
+
+func isFilterParam(key string) bool {
+	return strings.HasPrefix(key, "filter[")
+}
+
+// withoutFilterParams - filters are not part of the params structs
+func withoutFilterParams(values url.Values) url.Values {
+	res := url.Values{}
+	for k, v := range values {
+		if !isFilterParam(k) {
+			res[k] = v
+		}
+	}
+	return res
+}
+
+func parseFilterValue(t, value string) (interface{}, error) {
+	switch t {
+	case FilterNumber:
+		return strconv.ParseFloat(value, 64)
+	case FilterBool:
+		return strconv.ParseBool(value)
+	case FilterTime:
+		return time.Parse(time.RFC3339Nano, value)
+	case FilterUUID:
+		return uuid.FromString(value)
+	}
+	return value, nil
+}
+
+func (f FilterField) allows(op string) bool {
+	if len(f.Ops) == 0 {
+		return op == "eq"
+	}
+	for _, o := range f.Ops {
+		if o == op {
+			return true
+		}
+	}
+	return false
+}
+
+// filterCondition - returns the condition and its argument for one filter param
+func (filters Filters) filterCondition(key, value string) (string, interface{}, error) {
+	m := filterParam.FindStringSubmatch(key)
+	if m == nil {
+		return "", nil, fmt.Errorf("Invalid filter %s", key)
+	}
+	f, ok := filters[m[1]]
+	if !ok {
+		return "", nil, fmt.Errorf("Unknown filter field %s", m[1])
+	}
+	op := m[2]
+	if op == "" {
+		op = "eq"
+	}
+	sqlOp, ok := filterOps[op]
+	if !ok || !f.allows(op) {
+		return "", nil, fmt.Errorf("Operator %s not allowed on %s", op, m[1])
+	}
+
+	if op == "in" {
+		values := []interface{}{}
+		for _, v := range strings.Split(value, ",") {
+			pv, err := parseFilterValue(f.Type, v)
+			if err != nil {
+				return "", nil, fmt.Errorf("Invalid value for %s: %s", m[1], v)
+			}
+			values = append(values, pv)
+		}
+		return fmt.Sprintf("%s %s ?", f.Column, sqlOp), values, nil
+	}
+	pv, err := parseFilterValue(f.Type, value)
+	if err != nil {
+		return "", nil, fmt.Errorf("Invalid value for %s: %s", m[1], value)
+	}
+	return fmt.Sprintf("%s %s ?", f.Column, sqlOp), pv, nil
+}
+
+// QueryFilters - adds the filter[field][op]=value query params to the selector, only whitelisted fields are accepted
+func QueryFilters(filters Filters) middleware.Middleware {
+	return func(fn httprouter.Handle) httprouter.Handle {
+		return func(w http.ResponseWriter, r *http.Request, p httprouter.Params) {
+			selector := r.Context().Value(SelectorContextKey{}).(sqlbuilder.Selector)
+			for key, values := range r.URL.Query() {
+				if !isFilterParam(key) {
+					continue
+				}
+				for _, value := range values {
+					cond, arg, err := filters.filterCondition(key, value)
+					if err != nil {
+						logrus.Errorf("filterCondition in QueryFilters %q - %s", err, r.URL.String())
+						apierrors.Write(w, apierrors.BadRequest(err.Error()))
+						return
+					}
+					selector = selector.And(cond, arg)
+				}
+			}
+			ctx := context.WithValue(r.Context(), SelectorContextKey{}, selector)
+			fn(w, r.WithContext(ctx), p)
+		}
+	}
+}
+
+// WithFilters - filter params not in the whitelist are rejected, even when the endpoint has no filters
+func (dbe DBEndpointBuilder) WithFilters(filters Filters) DBEndpointBuilder {
+	dbe.Pre = append(append([]middleware.Middleware{}, dbe.Pre...), QueryFilters(filters))
+	return dbe
+}
+
+// Operators of the filter fields
+var (
+	FilterEqualOps = []string{"eq", "ne", "in"}
+	FilterRangeOps = []string{"gt", "gte", "lt", "lte"}
+)
+
+// CatFilters - creation and update dates, every collection has them
+var CatFilters = Filters{
+	"cat": {Column: "t.cat", Type: FilterTime, Ops: FilterRangeOps},
+	"uat": {Column: "t.uat", Type: FilterTime, Ops: FilterRangeOps},
+}
+
+// With - returns a copy of the filters with the fields added
+func (filters Filters) With(fields Filters) Filters {
+	res := Filters{}
+	for k, f := range filters {
+		res[k] = f
+	}
+	for k, f := range fields {
+		res[k] = f
+	}
+	return res
+}
+
+// FilterCacheKey - filter params of the request, to be appended to the cache keys
+func FilterCacheKey(r *http.Request) string {
+	values := url.Values{}
+	for k, v := range r.URL.Query() {
+		if isFilterParam(k) {
+			values[k] = v
+		}
+	}
+	return values.Encode()
+}
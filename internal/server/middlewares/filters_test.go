@@ -0,0 +1,177 @@
+/*
+ * Copyright (C) 2021  SuperGreenLab <towelie@supergreenlab.com>
+ * Author: Constantin Clauzel <constantin.clauzel@gmail.com>
+ *
+ * This program is free software: you can redistribute it and/or modify
+ * it under the terms of the GNU General Public License as published by
+ * the Free Software Foundation, either version 3 of the License, or
+ * (at your option) any later version.
+ *
+ * This program is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ * GNU General Public License for more details.
+ *
+ * You should have received a copy of the GNU General Public License
+ * along with this program.  If not, see <http://www.gnu.org/licenses/>.
+ */
+
+package middlewares
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/SuperGreenLab/AppBackend/internal/server/apierrors"
+	"github.com/gofrs/uuid"
+	"github.com/julienschmidt/httprouter"
+	"upper.io/db.v3/lib/sqlbuilder"
+)
+
+var testFilters = CatFilters.With(Filters{
+	"name":    {Column: "t.name", Type: FilterString, Ops: FilterEqualOps},
+	"public":  {Column: "t.is_public", Type: FilterBool},
+	"size":    {Column: "t.size", Type: FilterNumber, Ops: append(FilterEqualOps, FilterRangeOps...)},
+	"plantid": {Column: "t.plantid", Type: FilterUUID, Ops: FilterEqualOps},
+})
+
+func TestFilterCondition(t *testing.T) {
+	id := uuid.Must(uuid.FromString("d5a9f6e2-9b4c-4d67-8a1e-2f3c4b5a6d7e"))
+	id2 := uuid.Must(uuid.FromString("0e1d2c3b-4a59-4687-9a1b-2c3d4e5f6a7b"))
+	cat := time.Date(2021, 3, 4, 5, 6, 7, 890000000, time.UTC)
+
+	tests := []struct {
+		key   string
+		value string
+		cond  string
+		arg   interface{}
+		err   bool
+	}{
+		// the column comes from the whitelist, never from the param
+		{"filter[name]", "tomato", "t.name = ?", "tomato", false},
+		{"filter[name][eq]", "tomato", "t.name = ?", "tomato", false},
+		{"filter[name][ne]", "tomato", "t.name != ?", "tomato", false},
+		{"filter[public]", "true", "t.is_public = ?", true, false},
+		{"filter[size][gte]", "1.5", "t.size >= ?", 1.5, false},
+		{"filter[cat][lt]", "2021-03-04T05:06:07.89Z", "t.cat < ?", cat, false},
+		{"filter[plantid]", id.String(), "t.plantid = ?", id, false},
+		{"filter[plantid][in]", id.String() + "," + id2.String(), "t.plantid IN ?", []interface{}{id, id2}, false},
+		{"filter[size][in]", "1,2", "t.size IN ?", []interface{}{1.0, 2.0}, false},
+		{"filter[name][in]", "a", "t.name IN ?", []interface{}{"a"}, false},
+
+		// unknown fields and malformed keys
+		{"filter[unknown]", "x", "", nil, true},
+		{"filter[t.name]", "x", "", nil, true},
+		{"filter[name;drop table plants]", "x", "", nil, true},
+		{"filter[name][eq][eq]", "x", "", nil, true},
+		{"filter", "x", "", nil, true},
+
+		// operators unknown or not allowed on the field, eq only when the field has no operators
+		{"filter[name][like]", "x", "", nil, true},
+		{"filter[name][gt]", "x", "", nil, true},
+		{"filter[public][ne]", "true", "", nil, true},
+		{"filter[cat]", "2021-03-04T05:06:07Z", "", nil, true},
+		{"filter[cat][in]", "2021-03-04T05:06:07Z", "", nil, true},
+
+		// values that don't parse to the field's type
+		{"filter[public]", "maybe", "", nil, true},
+		{"filter[size][gt]", "big", "", nil, true},
+		{"filter[cat][gt]", "yesterday", "", nil, true},
+		{"filter[plantid]", "not-a-uuid", "", nil, true},
+		{"filter[plantid][in]", id.String() + ",not-a-uuid", "", nil, true},
+		{"filter[size][in]", "1,,2", "", nil, true},
+	}
+	for _, tt := range tests {
+		cond, arg, err := testFilters.filterCondition(tt.key, tt.value)
+		if tt.err {
+			if err == nil {
+				t.Errorf("filterCondition(%q, %q): got (%q, %v), want an error", tt.key, tt.value, cond, arg)
+			}
+			continue
+		}
+		if err != nil {
+			t.Errorf("filterCondition(%q, %q): unexpected error %q", tt.key, tt.value, err)
+			continue
+		}
+		if cond != tt.cond || !reflect.DeepEqual(arg, tt.arg) {
+			t.Errorf("filterCondition(%q, %q): got (%q, %#v), want (%q, %#v)", tt.key, tt.value, cond, arg, tt.cond, tt.arg)
+		}
+	}
+}
+
+// filterSelector - records the conditions added by QueryFilters, there's no database behind it
+type filterSelector struct {
+	sqlbuilder.Selector
+	conds [][]interface{}
+}
+
+func (s *filterSelector) And(conds ...interface{}) sqlbuilder.Selector {
+	s.conds = append(s.conds, conds)
+	return s
+}
+
+func TestQueryFilters(t *testing.T) {
+	tests := []struct {
+		query  string
+		status int
+		conds  [][]interface{}
+	}{
+		{"", http.StatusOK, nil},
+		{"offset=10&limit=20", http.StatusOK, nil},
+		{"filter[name]=tomato", http.StatusOK, [][]interface{}{{"t.name = ?", "tomato"}}},
+		{"filter[size][gt]=1&filter[size][gt]=2", http.StatusOK, [][]interface{}{{"t.size > ?", 1.0}, {"t.size > ?", 2.0}}},
+		{"filter[name][in]=a,b", http.StatusOK, [][]interface{}{{"t.name IN ?", []interface{}{"a", "b"}}}},
+		{"filter[unknown]=x", http.StatusBadRequest, nil},
+		{"filter[name][like]=x", http.StatusBadRequest, nil},
+		{"filter[public]=maybe", http.StatusBadRequest, nil},
+	}
+	for _, tt := range tests {
+		s := &filterSelector{}
+		called := false
+		fn := QueryFilters(testFilters)(func(w http.ResponseWriter, r *http.Request, p httprouter.Params) {
+			called = true
+			if r.Context().Value(SelectorContextKey{}).(sqlbuilder.Selector) != s {
+				t.Errorf("QueryFilters(%q): selector not passed to the next handler", tt.query)
+			}
+		})
+
+		r := httptest.NewRequest("GET", "/plants?"+tt.query, nil)
+		r = r.WithContext(context.WithValue(r.Context(), SelectorContextKey{}, sqlbuilder.Selector(s)))
+		w := httptest.NewRecorder()
+		fn(w, r, httprouter.Params{})
+
+		if w.Code != tt.status {
+			t.Errorf("QueryFilters(%q): got status %d, want %d", tt.query, w.Code, tt.status)
+			continue
+		}
+		if tt.status != http.StatusOK {
+			res := apierrors.Response{}
+			if err := json.Unmarshal(w.Body.Bytes(), &res); err != nil || res.Code != apierrors.CodeBadRequest {
+				t.Errorf("QueryFilters(%q): got body %s, want a %s error", tt.query, w.Body.String(), apierrors.CodeBadRequest)
+			}
+			if called {
+				t.Errorf("QueryFilters(%q): next handler called on an invalid filter", tt.query)
+			}
+			continue
+		}
+		if !called {
+			t.Errorf("QueryFilters(%q): next handler not called", tt.query)
+		}
+		// the order of the query params is not kept, only single field queries are compared in order
+		if len(s.conds) != len(tt.conds) {
+			t.Errorf("QueryFilters(%q): got conditions %v, want %v", tt.query, s.conds, tt.conds)
+			continue
+		}
+		for i := range tt.conds {
+			if !reflect.DeepEqual(s.conds[i], tt.conds[i]) {
+				t.Errorf("QueryFilters(%q): got conditions %v, want %v", tt.query, s.conds, tt.conds)
+				break
+			}
+		}
+	}
+}
@@ -0,0 +1,196 @@
+/*
+ * Copyright (C) 2021  SuperGreenLab <towelie@supergreenlab.com>
+ * Author: Constantin Clauzel <constantin.clauzel@gmail.com>
+ *
+ * This program is free software: you can redistribute it and/or modify
+ * it under the terms of the GNU General Public License as published by
+ * the Free Software Foundation, either version 3 of the License, or
+ * (at your option) any later version.
+ *
+ * This program is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ * GNU General Public License for more details.
+ *
+ * You should have received a copy of the GNU General Public License
+ * along with this program.  If not, see <http://www.gnu.org/licenses/>.
+ */
+
+package middlewares
+
+import (
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net/http"
+
+	"github.com/SuperGreenLab/AppBackend/internal/data/kv"
+	"github.com/SuperGreenLab/AppBackend/internal/server/apierrors"
+	"github.com/gofrs/uuid"
+	"github.com/julienschmidt/httprouter"
+	"github.com/sirupsen/logrus"
+	"github.com/spf13/pflag"
+	"github.com/spf13/viper"
+)
+
+var (
+	_ = pflag.String("idempotencyretention", "24h", "How long the Idempotency-Key of inserts are kept")
+	_ = pflag.String("idempotencylock", "1m", "How long a request with an Idempotency-Key can run before the key is released")
+)
+
+func init() {
+	viper.SetDefault("IdempotencyRetention", "24h")
+	viper.SetDefault("IdempotencyLock", "1m")
+}
+
+const maxIdempotencyKeyLength = 255
+
+// maxIdempotentBodyLength - same limit as the JSON decoding, larger bodies are rejected further down anyway
+const maxIdempotentBodyLength = 1048576
+
+// IdempotencyKeyContextKey - context key which stores the Idempotency-Key of the insert
+type IdempotencyKeyContextKey struct{}
+
+type idempotencyKey struct {
+	UserID     string
+	Collection string
+	Key        string
+	Committed  bool
+}
+
+// idempotentResponse - the response of the first request, replayed as is for the retries with the same body
+type idempotentResponse struct {
+	BodyHash string      `json:"bodyHash"`
+	Status   int         `json:"status"`
+	Header   http.Header `json:"header"`
+	Body     []byte      `json:"body"`
+}
+
+// requestBodyHash - the body is read and put back for the next handlers
+func requestBodyHash(r *http.Request) (string, error) {
+	body, err := ioutil.ReadAll(io.LimitReader(r.Body, maxIdempotentBodyLength+1))
+	if err != nil {
+		return "", err
+	}
+	r.Body = ioutil.NopCloser(io.MultiReader(bytes.NewReader(body), r.Body))
+	h := sha256.Sum256(body)
+	return hex.EncodeToString(h[:]), nil
+}
+
+func outputIdempotentReplay(w http.ResponseWriter, ir idempotentResponse) {
+	for k, v := range ir.Header {
+		w.Header()[k] = v
+	}
+	w.Header().Set("Idempotent-Replayed", "true")
+	w.WriteHeader(ir.Status)
+	if _, err := w.Write(ir.Body); err != nil {
+		logrus.Errorf("w.Write in outputIdempotentReplay %q - status: %d", err, ir.Status)
+	}
+}
+
+// saveIdempotentResponse - only the headers set by the endpoint are kept, not the ones of the outer middlewares (request id, cors..)
+func saveIdempotentResponse(w http.ResponseWriter, ik *idempotencyKey, hash string, rb *ResponseBuffer) {
+	ir := idempotentResponse{BodyHash: hash, Status: rb.Status(), Header: http.Header{}, Body: rb.Body.Bytes()}
+	for k, v := range rb.Header() {
+		if _, ok := w.Header()[k]; !ok {
+			ir.Header[k] = v
+		}
+	}
+	value, err := json.Marshal(ir)
+	if err != nil {
+		logrus.Errorf("json.Marshal in saveIdempotentResponse %q - %+v", err, ik)
+		return
+	}
+	if err := kv.SetIdempotencyKey(ik.UserID, ik.Collection, ik.Key, string(value), viper.GetDuration("IdempotencyRetention")); err != nil {
+		logrus.Errorf("kv.SetIdempotencyKey in saveIdempotentResponse %q - %+v", err, ik)
+	}
+}
+
+// CheckIdempotencyKey - a retried insert with the same Idempotency-Key gets the response of the first insert,
+// reusing the key with a different body is rejected with a 422
+func CheckIdempotencyKey(collection string) func(fn httprouter.Handle) httprouter.Handle {
+	return func(fn httprouter.Handle) httprouter.Handle {
+		return func(w http.ResponseWriter, r *http.Request, p httprouter.Params) {
+			key := r.Header.Get("Idempotency-Key")
+			uid, ok := r.Context().Value(UserIDContextKey{}).(uuid.UUID)
+			if key == "" || !ok {
+				fn(w, r, p)
+				return
+			}
+			if len(key) > maxIdempotencyKeyLength {
+				logrus.Errorf("Idempotency-Key too long in CheckIdempotencyKey - uid: %s collection: %s", uid, collection)
+				apierrors.Write(w, apierrors.BadRequest("Idempotency-Key too long"))
+				return
+			}
+
+			ik := &idempotencyKey{UserID: uid.String(), Collection: collection, Key: key}
+			hash, err := requestBodyHash(r)
+			if err != nil {
+				logrus.Errorf("requestBodyHash in CheckIdempotencyKey %q - %+v", err, ik)
+				apierrors.Write(w, apierrors.BadRequest("Could not read the request body"))
+				return
+			}
+
+			locked, err := kv.LockIdempotencyKey(ik.UserID, ik.Collection, ik.Key, viper.GetDuration("IdempotencyLock"))
+			if err != nil {
+				logrus.Errorf("kv.LockIdempotencyKey in CheckIdempotencyKey %q - %+v", err, ik)
+				apierrors.Write(w, err)
+				return
+			}
+			if !locked {
+				value, found, err := kv.GetIdempotencyKey(ik.UserID, ik.Collection, ik.Key)
+				if err != nil {
+					logrus.Errorf("kv.GetIdempotencyKey in CheckIdempotencyKey %q - %+v", err, ik)
+					apierrors.Write(w, err)
+					return
+				}
+				if !found || value == "" {
+					logrus.Warnf("Idempotency-Key in use in CheckIdempotencyKey - %+v", ik)
+					apierrors.Write(w, apierrors.Conflict("A request with this Idempotency-Key is already running"))
+					return
+				}
+				ir := idempotentResponse{}
+				if err := json.Unmarshal([]byte(value), &ir); err != nil {
+					// keys saved before the responses were stored only hold the inserted ID
+					ir = idempotentResponse{BodyHash: hash, Status: http.StatusOK, Header: http.Header{"Content-Type": {"application/json"}}, Body: []byte(fmt.Sprintf("{\"id\":%q}\n", value))}
+				}
+				if ir.BodyHash != hash {
+					logrus.Warnf("Idempotency-Key reused with a different body in CheckIdempotencyKey - %+v", ik)
+					apierrors.Write(w, apierrors.New(http.StatusUnprocessableEntity, apierrors.CodeIdempotencyKeyReused, "Idempotency-Key already used with a different request body"))
+					return
+				}
+				outputIdempotentReplay(w, ir)
+				return
+			}
+
+			rb := NewResponseBuffer(w.Header())
+			ctx := context.WithValue(r.Context(), IdempotencyKeyContextKey{}, ik)
+			fn(rb, r.WithContext(ctx), p)
+
+			if ik.Committed {
+				saveIdempotentResponse(w, ik, hash, rb)
+			} else if err := kv.ReleaseIdempotencyKey(ik.UserID, ik.Collection, ik.Key); err != nil {
+				// nothing was committed, the client can retry with the same key
+				logrus.Errorf("kv.ReleaseIdempotencyKey in CheckIdempotencyKey %q - %+v", err, ik)
+			}
+			rb.Flush(w)
+		}
+	}
+}
+
+// SaveIdempotencyKey - the response is stored for the Idempotency-Key once the insert is committed
+func SaveIdempotencyKey(fn httprouter.Handle) httprouter.Handle {
+	return func(w http.ResponseWriter, r *http.Request, p httprouter.Params) {
+		if ik, ok := r.Context().Value(IdempotencyKeyContextKey{}).(*idempotencyKey); ok {
+			AfterCommit(r, func() {
+				ik.Committed = true
+			})
+		}
+		fn(w, r, p)
+	}
+}
@@ -23,6 +23,7 @@ import (
 	"errors"
 	"net/http"
 
+	"github.com/SuperGreenLab/AppBackend/internal/server/apierrors"
 	"github.com/SuperGreenLab/AppBackend/internal/server/tools"
 
 	"github.com/julienschmidt/httprouter"
@@ -32,8 +33,12 @@ import (
 // ObjectContextKey - context key which stores the decoced object
 type ObjectContextKey struct{}
 
-// DecodeJSON - decodes the JSON payload
+// DecodeJSON - decodes the JSON payload, objects with invalid fields are rejected with a 422.
+// The validate tags of the object are checked when the endpoint is built.
 func DecodeJSON(fnObject func() interface{}) func(fn httprouter.Handle) httprouter.Handle {
+	if err := tools.CheckValidateTags(fnObject()); err != nil {
+		logrus.Fatalf("tools.CheckValidateTags in DecodeJSON %q", err)
+	}
 	return func(fn httprouter.Handle) httprouter.Handle {
 		return func(w http.ResponseWriter, r *http.Request, p httprouter.Params) {
 			o := fnObject()
@@ -42,10 +47,21 @@ func DecodeJSON(fnObject func() interface{}) func(fn httprouter.Handle) httprout
 				var mr *tools.MalformedRequest
 				if errors.As(err, &mr) {
 					logrus.Errorf("tools.DecodeJSONBody in DecodeJSON %q - %s", err, r.URL.String())
-					http.Error(w, mr.Msg, mr.Status)
+					apierrors.Write(w, malformedRequestError(mr))
 				} else {
 					logrus.Errorf("tools.DecodeJSONBody in DecodeJSON %q - %s", err, r.URL.String())
-					http.Error(w, http.StatusText(http.StatusInternalServerError), http.StatusInternalServerError)
+					apierrors.Write(w, apierrors.Internal())
+				}
+				return
+			}
+			if err := tools.Validate(o); err != nil {
+				var ve *tools.ValidationError
+				if errors.As(err, &ve) {
+					logrus.Warnf("tools.Validate in DecodeJSON %q - %s", err, r.URL.String())
+					apierrors.Write(w, apierrors.ValidationFailed(ve.Errors))
+				} else {
+					logrus.Errorf("tools.Validate in DecodeJSON %q - %s", err, r.URL.String())
+					apierrors.Write(w, apierrors.Internal())
 				}
 				return
 			}
@@ -54,3 +70,14 @@ func DecodeJSON(fnObject func() interface{}) func(fn httprouter.Handle) httprout
 		}
 	}
 }
+
+// malformedRequestError - the status of the decoding error gives its code
+func malformedRequestError(mr *tools.MalformedRequest) *apierrors.Error {
+	switch mr.Status {
+	case http.StatusRequestEntityTooLarge:
+		return apierrors.New(mr.Status, apierrors.CodeRequestTooLarge, mr.Msg)
+	case http.StatusUnsupportedMediaType:
+		return apierrors.New(mr.Status, apierrors.CodeUnsupportedMediaType, mr.Msg)
+	}
+	return apierrors.BadRequest(mr.Msg)
+}
@@ -27,6 +27,7 @@ import (
 	"time"
 
 	"github.com/SuperGreenLab/AppBackend/internal/data/kv"
+	"github.com/SuperGreenLab/AppBackend/internal/server/apierrors"
 	"github.com/gofrs/uuid"
 	"github.com/julienschmidt/httprouter"
 	"github.com/sirupsen/logrus"
@@ -42,7 +43,7 @@ func OutputObjectID(w http.ResponseWriter, r *http.Request, p httprouter.Params)
 	}{id.String()}
 	if err := json.NewEncoder(w).Encode(response); err != nil {
 		logrus.Errorf("json.NewEncoder in OutputObjectID %q - %+v", err, response)
-		http.Error(w, err.Error(), http.StatusInternalServerError)
+		apierrors.Write(w, err)
 		return
 	}
 }
@@ -54,6 +55,9 @@ func OutputResult(name string) httprouter.Handle {
 
 		response := map[string]interface{}{}
 		response[name] = results
+		if next, ok := r.Context().Value(NextCursorContextKey{}).(string); ok {
+			response["next"] = next
+		}
 
 		var cacheData bytes.Buffer
 		var mw io.Writer = w
@@ -63,7 +67,7 @@ func OutputResult(name string) httprouter.Handle {
 
 		if err := json.NewEncoder(mw).Encode(response); err != nil {
 			logrus.Errorf("json.NewEncoder in OutputResult %q - %+v", err, response)
-			http.Error(w, err.Error(), http.StatusInternalServerError)
+			apierrors.Write(w, err)
 			return
 		}
 		if okCache {
@@ -84,7 +88,7 @@ func OutputSelectOneResult() httprouter.Handle {
 		result := r.Context().Value(SelectResultContextKey{}).(interface{})
 		if err := json.NewEncoder(w).Encode(result); err != nil {
 			logrus.Errorf("json.NewEncoder in OutputSelectOneResult %q - %+v", err, result)
-			http.Error(w, err.Error(), http.StatusInternalServerError)
+			apierrors.Write(w, err)
 			return
 		}
 	}
@@ -97,7 +101,7 @@ func OutputOK(w http.ResponseWriter, r *http.Request, p httprouter.Params) {
 	}{"OK"}
 	if err := json.NewEncoder(w).Encode(response); err != nil {
 		logrus.Errorf("json.NewEncoder in OutputOK %q - %+v", err, response)
-		http.Error(w, err.Error(), http.StatusInternalServerError)
+		apierrors.Write(w, err)
 		return
 	}
 }
@@ -20,10 +20,20 @@ package middlewares
 
 import (
 	"context"
+	"database/sql/driver"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
 	"net/http"
+	"reflect"
+	"strings"
+	"time"
 
+	"github.com/SuperGreenLab/AppBackend/internal/server/apierrors"
 	"github.com/julienschmidt/httprouter"
 	"github.com/rileyr/middleware"
+	"github.com/sirupsen/logrus"
 	"upper.io/db.v3"
 	"upper.io/db.v3/lib/sqlbuilder"
 )
@@ -57,8 +67,10 @@ type DBEndpointBuilder struct {
 	Output httprouter.Handle
 }
 
+// Endpoint - everything from the params decoding to the output runs in the same transaction
 func (dbe DBEndpointBuilder) Endpoint() Endpoint {
 	e := NewEndpoint()
+	e.Middlewares = append(e.Middlewares, Transaction)
 	if dbe.Params != nil {
 		e.Middlewares = append(e.Middlewares, dbe.Params)
 	}
@@ -95,10 +107,20 @@ type InsertEndpointBuilder struct {
 	DBEndpointBuilder
 
 	Collection string
+	// Idempotent - honors the Idempotency-Key header, the responses are kept in redis
+	Idempotent bool
 }
 
 func (dbe InsertEndpointBuilder) Endpoint() Endpoint {
-	e := dbe.DBEndpointBuilder.Endpoint()
+	b := dbe.DBEndpointBuilder
+	if dbe.Idempotent {
+		// the key is only saved if the insert is committed, the response is stored by CheckIdempotencyKey
+		b.Post = append([]middleware.Middleware{SaveIdempotencyKey}, b.Post...)
+	}
+	e := b.Endpoint()
+	if dbe.Idempotent {
+		e.Middlewares = append([]middleware.Middleware{CheckIdempotencyKey(dbe.Collection)}, e.Middlewares...)
+	}
 	e.Middlewares = append(e.Middlewares, PublishInsert(dbe.Collection))
 	e.Output = dbe.DBEndpointBuilder.Output
 	return e
@@ -108,6 +130,7 @@ func NewInsertEndpointBuilder(collection string, input Factory, pre, post []midd
 	e := InsertEndpointBuilder{
 		DBEndpointBuilder: NewDBEndpointBuilder(nil, input, pre, post, InsertObject(collection), OutputObjectID),
 		Collection:        collection,
+		Idempotent:        true,
 	}
 	return e
 }
@@ -137,9 +160,14 @@ type SelectParams interface {
 	GetLimit() int
 }
 
+// SelectParamsOffsetLimit - Cursor, Sort and Order are only used in cursor mode, see KeysetPagination
 type SelectParamsOffsetLimit struct {
 	Offset int
 	Limit  int
+
+	Cursor string
+	Sort   string
+	Order  string
 }
 
 func (p *SelectParamsOffsetLimit) GetOffset() int {
@@ -150,17 +178,221 @@ func (p *SelectParamsOffsetLimit) GetLimit() int {
 	return p.Limit
 }
 
+func (p *SelectParamsOffsetLimit) GetCursor() string {
+	return p.Cursor
+}
+
+func (p *SelectParamsOffsetLimit) GetSort() string {
+	return p.Sort
+}
+
+func (p *SelectParamsOffsetLimit) GetOrder() string {
+	return p.Order
+}
+
+type KeysetParams interface {
+	GetLimit() int
+	GetCursor() string
+	GetSort() string
+	GetOrder() string
+}
+
+const (
+	keysetDefaultLimit = 10
+	keysetMaxLimit     = 50
+)
+
+// KeysetSort - Column is the sql expression sorted on, Field the result field holding its value.
+// ID and IDField break the ties, they must be unique in the results.
+type KeysetSort struct {
+	Column  string
+	Field   string
+	ID      string
+	IDField string
+}
+
+// Keyset - Sorts is the whitelist of the values accepted in the sort query param
+type Keyset struct {
+	Default string
+	Sorts   map[string]KeysetSort
+}
+
+type keysetCursor struct {
+	Sort  string      `json:"s"`
+	Order string      `json:"o"`
+	Value interface{} `json:"v"`
+	ID    interface{} `json:"id"`
+}
+
+type keysetState struct {
+	Sort   KeysetSort
+	Cursor keysetCursor
+	Limit  int
+}
+
+type keysetStateContextKey struct{}
+
+// NextCursorContextKey - context key which stores the cursor of the next page, empty on the last page
+type NextCursorContextKey struct{}
+
+func encodeKeysetCursor(c keysetCursor) (string, error) {
+	b, err := json.Marshal(c)
+	if err != nil {
+		return "", err
+	}
+	return base64.RawURLEncoding.EncodeToString(b), nil
+}
+
+func decodeKeysetCursor(cursor string) (keysetCursor, error) {
+	c := keysetCursor{}
+	b, err := base64.RawURLEncoding.DecodeString(cursor)
+	if err != nil {
+		return c, errInvalidCursor
+	}
+	if err := json.Unmarshal(b, &c); err != nil {
+		return c, errInvalidCursor
+	}
+	return c, nil
+}
+
+var errInvalidCursor = errors.New("Invalid cursor")
+
+// keysetValue - cursor values are sent back as query parameters, postgres casts them to the column's type
+func keysetValue(v reflect.Value) interface{} {
+	for v.Kind() == reflect.Ptr {
+		if v.IsNil() {
+			return nil
+		}
+		v = v.Elem()
+	}
+	switch t := v.Interface().(type) {
+	case time.Time:
+		return t.Format(time.RFC3339Nano)
+	case driver.Valuer:
+		val, err := t.Value()
+		if err != nil {
+			return nil
+		}
+		return val
+	}
+	return v.Interface()
+}
+
+// KeysetPagination - cursor mode is enabled by the cursor query param, an empty cursor is the first page.
+// Replaces the ordering, offset and limit set by the previous middlewares.
+func KeysetPagination(k Keyset) middleware.Middleware {
+	return func(fn httprouter.Handle) httprouter.Handle {
+		return func(w http.ResponseWriter, r *http.Request, p httprouter.Params) {
+			if _, ok := r.URL.Query()["cursor"]; !ok {
+				fn(w, r, p)
+				return
+			}
+			selector := r.Context().Value(SelectorContextKey{}).(sqlbuilder.Selector)
+			params := r.Context().Value(QueryObjectContextKey{}).(KeysetParams)
+
+			state := keysetState{
+				Cursor: keysetCursor{Sort: params.GetSort(), Order: strings.ToLower(params.GetOrder())},
+				Limit:  params.GetLimit(),
+			}
+			if state.Cursor.Sort == "" {
+				state.Cursor.Sort = k.Default
+			}
+			if state.Cursor.Order == "" {
+				state.Cursor.Order = "desc"
+			}
+			sort, ok := k.Sorts[state.Cursor.Sort]
+			if !ok || (state.Cursor.Order != "asc" && state.Cursor.Order != "desc") {
+				errorMsg := fmt.Sprintf("Unknown sort %s %s", state.Cursor.Sort, state.Cursor.Order)
+				logrus.Errorf("%s in KeysetPagination - %s", errorMsg, r.URL.String())
+				apierrors.Write(w, apierrors.BadRequest(errorMsg))
+				return
+			}
+			state.Sort = sort
+			if state.Limit <= 0 {
+				state.Limit = keysetDefaultLimit
+			} else if state.Limit > keysetMaxLimit {
+				state.Limit = keysetMaxLimit
+			}
+
+			cmp, order := "<", "DESC"
+			if state.Cursor.Order == "asc" {
+				cmp, order = ">", "ASC"
+			}
+			if cursor := params.GetCursor(); cursor != "" {
+				c, err := decodeKeysetCursor(cursor)
+				if err != nil || c.Sort != state.Cursor.Sort || c.Order != state.Cursor.Order {
+					logrus.Errorf("decodeKeysetCursor in KeysetPagination %q - %s", errInvalidCursor, r.URL.String())
+					apierrors.Write(w, apierrors.BadRequest(errInvalidCursor.Error()))
+					return
+				}
+				selector = selector.And(fmt.Sprintf("(%s, %s) %s (?, ?)", sort.Column, sort.ID, cmp), c.Value, c.ID)
+			}
+			selector = selector.OrderBy(db.Raw(fmt.Sprintf("%s %s, %s %s", sort.Column, order, sort.ID, order))).Offset(0).Limit(state.Limit + 1)
+
+			ctx := context.WithValue(r.Context(), SelectorContextKey{}, selector)
+			ctx = context.WithValue(ctx, keysetStateContextKey{}, state)
+			fn(w, r.WithContext(ctx), p)
+		}
+	}
+}
+
+// KeysetNext - drops the extra row fetched by KeysetPagination, its presence means there's a next page
+func KeysetNext(fn httprouter.Handle) httprouter.Handle {
+	return func(w http.ResponseWriter, r *http.Request, p httprouter.Params) {
+		state, ok := r.Context().Value(keysetStateContextKey{}).(keysetState)
+		if !ok {
+			fn(w, r, p)
+			return
+		}
+		results := reflect.ValueOf(r.Context().Value(SelectResultContextKey{})).Elem()
+		next := ""
+		if results.Len() > state.Limit {
+			results.Set(results.Slice(0, state.Limit))
+			last := reflect.Indirect(results.Index(state.Limit - 1))
+			value, id := last.FieldByName(state.Sort.Field), last.FieldByName(state.Sort.IDField)
+			if !value.IsValid() || !id.IsValid() {
+				errorMsg := fmt.Sprintf("Missing sort fields %s %s", state.Sort.Field, state.Sort.IDField)
+				logrus.Errorf("%s in KeysetNext - %s", errorMsg, r.URL.String())
+				apierrors.Write(w, apierrors.Internal())
+				return
+			}
+			c := state.Cursor
+			c.Value, c.ID = keysetValue(value), keysetValue(id)
+			var err error
+			if next, err = encodeKeysetCursor(c); err != nil {
+				logrus.Errorf("encodeKeysetCursor in KeysetNext %q - %+v", err, c)
+				apierrors.Write(w, err)
+				return
+			}
+		}
+		ctx := context.WithValue(r.Context(), NextCursorContextKey{}, next)
+		fn(w, r.WithContext(ctx), p)
+	}
+}
+
+// WithKeyset - adds the cursor mode to a select endpoint, KeysetNext runs before the other post middlewares
+func (dbe DBEndpointBuilder) WithKeyset(k Keyset) DBEndpointBuilder {
+	if k.Sorts == nil {
+		return dbe
+	}
+	dbe.Pre = append(append([]middleware.Middleware{}, dbe.Pre...), KeysetPagination(k))
+	dbe.Post = append([]middleware.Middleware{KeysetNext}, dbe.Post...)
+	return dbe
+}
+
 type SelectEndpointBuilder struct {
 	DBEndpointBuilder
 
 	Selector middleware.Middleware
+	Keyset   Keyset
+	Filters  Filters
 
 	Collection string
 }
 
 func (dbe SelectEndpointBuilder) Endpoint() Endpoint {
 	dbe.Pre[0] = dbe.Selector
-	e := dbe.DBEndpointBuilder.Endpoint()
+	e := dbe.DBEndpointBuilder.WithFilters(dbe.Filters).WithKeyset(dbe.Keyset).Endpoint()
 	e.Output = dbe.DBEndpointBuilder.Output
 	return e
 }
@@ -170,6 +402,25 @@ func (dbe SelectEndpointBuilder) SetSelector(selector middleware.Middleware) Sel
 	return dbe
 }
 
+func (dbe SelectEndpointBuilder) SetKeyset(k Keyset) SelectEndpointBuilder {
+	dbe.Keyset = k
+	return dbe
+}
+
+func (dbe SelectEndpointBuilder) SetFilters(filters Filters) SelectEndpointBuilder {
+	dbe.Filters = filters
+	return dbe
+}
+
+// CatKeyset - sorts on the creation date, like the offset mode of the select endpoints
+var CatKeyset = Keyset{
+	Default: "cat",
+	Sorts: map[string]KeysetSort{
+		"cat": {Column: "t.cat", Field: "CreatedAt", ID: "t.id", IDField: "ID"},
+		"uat": {Column: "t.uat", Field: "UpdatedAt", ID: "t.id", IDField: "ID"},
+	},
+}
+
 func NewSelectEndpointBuilder(collection string, param, factory Factory, pre, post []middleware.Middleware) SelectEndpointBuilder {
 	defaultSelector := func(fn httprouter.Handle) httprouter.Handle {
 		return func(w http.ResponseWriter, r *http.Request, p httprouter.Params) {
@@ -185,6 +436,8 @@ func NewSelectEndpointBuilder(collection string, param, factory Factory, pre, po
 		DBEndpointBuilder: NewDBEndpointBuilder(param, nil, append([]middleware.Middleware{defaultSelector}, pre...), post, SelectQuery(factory), OutputSelectResult(collection)),
 		Collection:        collection,
 		Selector:          defaultSelector,
+		Keyset:            CatKeyset,
+		Filters:           CatFilters,
 	}
 	return e
 }
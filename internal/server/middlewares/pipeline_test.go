@@ -0,0 +1,66 @@
+/*
+ * Copyright (C) 2021  SuperGreenLab <towelie@supergreenlab.com>
+ * Author: Constantin Clauzel <constantin.clauzel@gmail.com>
+ *
+ * This program is free software: you can redistribute it and/or modify
+ * it under the terms of the GNU General Public License as published by
+ * the Free Software Foundation, either version 3 of the License, or
+ * (at your option) any later version.
+ *
+ * This program is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ * GNU General Public License for more details.
+ *
+ * You should have received a copy of the GNU General Public License
+ * along with this program.  If not, see <http://www.gnu.org/licenses/>.
+ */
+
+package middlewares
+
+import (
+	"encoding/base64"
+	"reflect"
+	"testing"
+)
+
+func TestKeysetCursorRoundTrip(t *testing.T) {
+	// values come back as decoded json, postgres casts them to the column's type
+	cursors := []keysetCursor{
+		{Sort: "cat", Order: "desc", Value: "2021-03-04T05:06:07.89Z", ID: "d5a9f6e2-9b4c-4d67-8a1e-2f3c4b5a6d7e"},
+		{Sort: "name", Order: "asc", Value: "tomato|basil", ID: "0e1d2c3b-4a59-4687-9a1b-2c3d4e5f6a7b"},
+		{Sort: "size", Order: "asc", Value: 12.5, ID: "0e1d2c3b-4a59-4687-9a1b-2c3d4e5f6a7b"},
+		{Sort: "public", Order: "desc", Value: true, ID: "0e1d2c3b-4a59-4687-9a1b-2c3d4e5f6a7b"},
+		{Sort: "uat", Order: "desc", Value: nil, ID: "0e1d2c3b-4a59-4687-9a1b-2c3d4e5f6a7b"},
+	}
+	for _, c := range cursors {
+		cursor, err := encodeKeysetCursor(c)
+		if err != nil {
+			t.Errorf("encodeKeysetCursor(%+v): unexpected error %q", c, err)
+			continue
+		}
+		d, err := decodeKeysetCursor(cursor)
+		if err != nil {
+			t.Errorf("decodeKeysetCursor(%q): unexpected error %q", cursor, err)
+			continue
+		}
+		if !reflect.DeepEqual(d, c) {
+			t.Errorf("decodeKeysetCursor(encodeKeysetCursor(%+v)): got %+v", c, d)
+		}
+	}
+}
+
+func TestDecodeKeysetCursorInvalid(t *testing.T) {
+	cursors := []string{
+		"not base64!",
+		base64.URLEncoding.EncodeToString([]byte(`{"s":"cat"}`)),
+		base64.RawURLEncoding.EncodeToString([]byte("not json")),
+		base64.RawURLEncoding.EncodeToString([]byte(`["cat","desc"]`)),
+		base64.RawURLEncoding.EncodeToString([]byte(`{"s":1}`)),
+	}
+	for _, cursor := range cursors {
+		if c, err := decodeKeysetCursor(cursor); err != errInvalidCursor {
+			t.Errorf("decodeKeysetCursor(%q): got (%+v, %v), want errInvalidCursor", cursor, c, err)
+		}
+	}
+}
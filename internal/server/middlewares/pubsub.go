@@ -41,9 +41,12 @@ func PublishInsert(collection string) middleware.Middleware {
 			o := r.Context().Value(ObjectContextKey{})
 
 			msg := InsertMessage{id, o}
-			if err := pubsub.PublishObject(fmt.Sprintf("insert.%s", collection), msg); err != nil {
-				logrus.Errorf("PublishObject in PublishInsert %q", err)
-			}
+			// listeners read the inserted object from the db
+			AfterCommit(r, func() {
+				if err := pubsub.PublishObject(fmt.Sprintf("insert.%s", collection), msg); err != nil {
+					logrus.Errorf("PublishObject in PublishInsert %q", err)
+				}
+			})
 			fn(w, r, p)
 		}
 	}
@@ -22,6 +22,7 @@ import (
 	"context"
 	"net/http"
 
+	"github.com/SuperGreenLab/AppBackend/internal/server/apierrors"
 	"github.com/gorilla/schema"
 	"github.com/julienschmidt/httprouter"
 	"github.com/sirupsen/logrus"
@@ -37,9 +38,9 @@ func DecodeQuery(fnObject func() interface{}) func(fn httprouter.Handle) httprou
 	return func(fn httprouter.Handle) httprouter.Handle {
 		return func(w http.ResponseWriter, r *http.Request, p httprouter.Params) {
 			o := fnObject()
-			if err := decoder.Decode(o, r.URL.Query()); err != nil {
+			if err := decoder.Decode(o, withoutFilterParams(r.URL.Query())); err != nil {
 				logrus.Errorf("DecodeQuery %q for %s", err.Error(), r.URL.Query())
-				http.Error(w, err.Error(), http.StatusInternalServerError)
+				apierrors.Write(w, err)
 				return
 			}
 			ctx := context.WithValue(r.Context(), QueryObjectContextKey{}, o)
@@ -0,0 +1,46 @@
+/*
+ * Copyright (C) 2021  SuperGreenLab <towelie@supergreenlab.com>
+ * Author: Constantin Clauzel <constantin.clauzel@gmail.com>
+ *
+ * This program is free software: you can redistribute it and/or modify
+ * it under the terms of the GNU General Public License as published by
+ * the Free Software Foundation, either version 3 of the License, or
+ * (at your option) any later version.
+ *
+ * This program is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ * GNU General Public License for more details.
+ *
+ * You should have received a copy of the GNU General Public License
+ * along with this program.  If not, see <http://www.gnu.org/licenses/>.
+ */
+
+package middlewares
+
+import (
+	"context"
+	"net/http"
+	"regexp"
+
+	"github.com/SuperGreenLab/AppBackend/internal/server/apierrors"
+	"github.com/gofrs/uuid"
+)
+
+// RequestIDContextKey - context key which stores the id of the request
+type RequestIDContextKey struct{}
+
+var validRequestID = regexp.MustCompile(`^[a-zA-Z0-9\-]{1,64}$`)
+
+// RequestID - ids set by the proxies are kept, the id is sent back in the response headers and error responses
+func RequestID(h http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		id := r.Header.Get(apierrors.RequestIDHeader)
+		if !validRequestID.MatchString(id) {
+			id = uuid.Must(uuid.NewV4()).String()
+		}
+		w.Header().Set(apierrors.RequestIDHeader, id)
+		ctx := context.WithValue(r.Context(), RequestIDContextKey{}, id)
+		h.ServeHTTP(w, r.WithContext(ctx))
+	})
+}
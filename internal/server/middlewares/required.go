@@ -21,6 +21,7 @@ package middlewares
 import (
 	"net/http"
 
+	"github.com/SuperGreenLab/AppBackend/internal/server/apierrors"
 	appbackend "github.com/SuperGreenLab/AppBackend/pkg"
 	"github.com/julienschmidt/httprouter"
 	"github.com/sirupsen/logrus"
@@ -32,7 +33,7 @@ func ObjectIDRequired(fn httprouter.Handle) httprouter.Handle {
 		o := r.Context().Value(ObjectContextKey{}).(appbackend.Object)
 		if o.GetID().Valid == false {
 			logrus.Errorf("Missing object's ID - %+v", o)
-			http.Error(w, "Missing object's ID", http.StatusBadRequest)
+			apierrors.Write(w, apierrors.BadRequest("Missing object's ID"))
 			return
 		}
 		fn(w, r, p)
@@ -45,7 +46,7 @@ func UserIDRequired(fn httprouter.Handle) httprouter.Handle {
 		ueid := r.Context().Value(UserIDContextKey{})
 		if ueid == nil {
 			logrus.Errorln("Missing userID")
-			http.Error(w, "Missing userID", http.StatusBadRequest)
+			apierrors.Write(w, apierrors.BadRequest("Missing userID"))
 			return
 		}
 		fn(w, r, p)
@@ -0,0 +1,88 @@
+/*
+ * Copyright (C) 2021  SuperGreenLab <towelie@supergreenlab.com>
+ * Author: Constantin Clauzel <constantin.clauzel@gmail.com>
+ *
+ * This program is free software: you can redistribute it and/or modify
+ * it under the terms of the GNU General Public License as published by
+ * the Free Software Foundation, either version 3 of the License, or
+ * (at your option) any later version.
+ *
+ * This program is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ * GNU General Public License for more details.
+ *
+ * You should have received a copy of the GNU General Public License
+ * along with this program.  If not, see <http://www.gnu.org/licenses/>.
+ */
+
+package middlewares
+
+import (
+	"bytes"
+	"net/http"
+
+	"github.com/sirupsen/logrus"
+)
+
+// ResponseBuffer - holds a response back instead of sending it, used by the transactions
+// (a failed commit can still be reported to the client) and by the endpoints running sub-requests
+type ResponseBuffer struct {
+	header http.Header
+	Code   int
+	Body   bytes.Buffer
+}
+
+// NewResponseBuffer - the buffer starts with a copy of the given headers, can be nil
+func NewResponseBuffer(header http.Header) *ResponseBuffer {
+	rb := &ResponseBuffer{header: http.Header{}}
+	for k, v := range header {
+		rb.header[k] = v
+	}
+	return rb
+}
+
+func (rb *ResponseBuffer) Header() http.Header {
+	return rb.header
+}
+
+func (rb *ResponseBuffer) WriteHeader(status int) {
+	if rb.Code == 0 {
+		rb.Code = status
+	}
+}
+
+func (rb *ResponseBuffer) Write(b []byte) (int, error) {
+	if rb.Code == 0 {
+		rb.Code = http.StatusOK
+	}
+	return rb.Body.Write(b)
+}
+
+// Status - the status sent to the client, 200 if the handler didn't write anything
+func (rb *ResponseBuffer) Status() int {
+	if rb.Code == 0 {
+		return http.StatusOK
+	}
+	return rb.Code
+}
+
+func (rb *ResponseBuffer) Succeeded() bool {
+	return rb.Status() >= 200 && rb.Status() < 300
+}
+
+// Flush - nothing is written if the handler didn't write anything, the caller might still write the response
+func (rb *ResponseBuffer) Flush(w http.ResponseWriter) {
+	for k, v := range rb.header {
+		w.Header()[k] = v
+	}
+	if rb.Code != 0 {
+		w.WriteHeader(rb.Code)
+	}
+	if rb.Body.Len() == 0 {
+		return
+	}
+	if _, err := w.Write(rb.Body.Bytes()); err != nil {
+		logrus.Errorf("w.Write in ResponseBuffer.Flush %q", err)
+	}
+}
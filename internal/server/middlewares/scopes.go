@@ -0,0 +1,81 @@
+/*
+ * Copyright (C) 2021  SuperGreenLab <towelie@supergreenlab.com>
+ * Author: Constantin Clauzel <constantin.clauzel@gmail.com>
+ *
+ * This program is free software: you can redistribute it and/or modify
+ * it under the terms of the GNU General Public License as published by
+ * the Free Software Foundation, either version 3 of the License, or
+ * (at your option) any later version.
+ *
+ * This program is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ * GNU General Public License for more details.
+ *
+ * You should have received a copy of the GNU General Public License
+ * along with this program.  If not, see <http://www.gnu.org/licenses/>.
+ */
+
+package middlewares
+
+import (
+	"fmt"
+	"net/http"
+
+	"github.com/SuperGreenLab/AppBackend/internal/server/apierrors"
+	"github.com/julienschmidt/httprouter"
+	"github.com/rileyr/middleware"
+	"github.com/sirupsen/logrus"
+)
+
+// Scopes required by the endpoints, user tokens have all of them, API keys only the ones they were created with
+const (
+	ScopePlantsRead       = "plants:read"
+	ScopePlantsWrite      = "plants:write"
+	ScopeFeedEntriesWrite = "feedentries:write"
+	ScopeSocialWrite      = "social:write"
+	ScopeMetricsRead      = "metrics:read"
+	ScopeUserRead         = "user:read"
+	ScopeUserWrite        = "user:write"
+	ScopeProductsWrite    = "products:write"
+
+	// ScopeAccount - sessions, emails and API keys management, can't be given to an API key
+	ScopeAccount = "account"
+)
+
+// APIKeyScopes - scopes that can be given to an API key
+var APIKeyScopes = []string{
+	ScopePlantsRead,
+	ScopePlantsWrite,
+	ScopeFeedEntriesWrite,
+	ScopeSocialWrite,
+	ScopeMetricsRead,
+	ScopeUserRead,
+	ScopeUserWrite,
+	ScopeProductsWrite,
+}
+
+// ScopesContextKey - context key which stores the scopes of the request's API key, missing for user tokens
+type ScopesContextKey struct{}
+
+// RequireScope - rejects requests made with an API key that does not have the given scope
+func RequireScope(scope string) middleware.Middleware {
+	return func(fn httprouter.Handle) httprouter.Handle {
+		return func(w http.ResponseWriter, r *http.Request, p httprouter.Params) {
+			scopes, ok := r.Context().Value(ScopesContextKey{}).([]string)
+			if !ok {
+				fn(w, r, p)
+				return
+			}
+			for _, s := range scopes {
+				if s == scope {
+					fn(w, r, p)
+					return
+				}
+			}
+			errorMsg := fmt.Sprintf("Missing scope %s", scope)
+			logrus.Errorf("%s - %s %s", errorMsg, r.Method, r.URL.Path)
+			apierrors.Write(w, apierrors.Forbidden(errorMsg))
+		}
+	}
+}
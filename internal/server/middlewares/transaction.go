@@ -0,0 +1,76 @@
+/*
+ * Copyright (C) 2021  SuperGreenLab <towelie@supergreenlab.com>
+ * Author: Constantin Clauzel <constantin.clauzel@gmail.com>
+ *
+ * This program is free software: you can redistribute it and/or modify
+ * it under the terms of the GNU General Public License as published by
+ * the Free Software Foundation, either version 3 of the License, or
+ * (at your option) any later version.
+ *
+ * This program is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ * GNU General Public License for more details.
+ *
+ * You should have received a copy of the GNU General Public License
+ * along with this program.  If not, see <http://www.gnu.org/licenses/>.
+ */
+
+package middlewares
+
+import (
+	"context"
+	"net/http"
+
+	"github.com/SuperGreenLab/AppBackend/internal/data/db"
+	"github.com/SuperGreenLab/AppBackend/internal/server/apierrors"
+	"github.com/julienschmidt/httprouter"
+	"github.com/sirupsen/logrus"
+	"upper.io/db.v3/lib/sqlbuilder"
+)
+
+// Transaction - runs the rest of the request in a transaction, committed only on 2xx responses.
+// The AfterCommit functions run once committed, requests already in a transaction join it.
+func Transaction(fn httprouter.Handle) httprouter.Handle {
+	return func(w http.ResponseWriter, r *http.Request, p httprouter.Params) {
+		sess := r.Context().Value(SessContextKey{}).(sqlbuilder.Database)
+		if _, ok := sess.(*db.TxSession); ok {
+			fn(w, r, p)
+			return
+		}
+
+		tx, err := sess.NewTx(r.Context())
+		if err != nil {
+			logrus.Errorf("sess.NewTx in Transaction %q - %s", err, r.URL.String())
+			apierrors.Write(w, err)
+			return
+		}
+		q := &AfterCommitQueue{}
+		ctx := context.WithValue(r.Context(), SessContextKey{}, db.NewTxSession(tx))
+		ctx = context.WithValue(ctx, AfterCommitContextKey{}, q)
+
+		tw := NewResponseBuffer(w.Header())
+		done := false
+		defer func() {
+			if !done {
+				if err := tx.Rollback(); err != nil {
+					logrus.Errorf("tx.Rollback in Transaction %q - %s", err, r.URL.String())
+				}
+			}
+		}()
+		fn(tw, r.WithContext(ctx), p)
+
+		if !tw.Succeeded() {
+			tw.Flush(w)
+			return
+		}
+		done = true
+		if err := tx.Commit(); err != nil {
+			logrus.Errorf("tx.Commit in Transaction %q - %s", err, r.URL.String())
+			apierrors.Write(w, err)
+			return
+		}
+		tw.Flush(w)
+		q.Run()
+	}
+}
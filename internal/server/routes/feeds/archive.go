@@ -21,12 +21,15 @@ package feeds
 import (
 	"net/http"
 
+	"github.com/SuperGreenLab/AppBackend/internal/data/db"
+	"github.com/SuperGreenLab/AppBackend/internal/server/apierrors"
 	"github.com/SuperGreenLab/AppBackend/internal/server/middlewares"
 	fmiddlewares "github.com/SuperGreenLab/AppBackend/internal/server/routes/feeds/middlewares"
 	appbackend "github.com/SuperGreenLab/AppBackend/pkg"
 	"github.com/gofrs/uuid"
 	"github.com/julienschmidt/httprouter"
 	"github.com/sirupsen/logrus"
+	udb "upper.io/db.v3"
 	"upper.io/db.v3/lib/sqlbuilder"
 )
 
@@ -41,52 +44,57 @@ func archivePlantHandler(w http.ResponseWriter, r *http.Request, p httprouter.Pa
 	err := sess.Collection("plants").Find("id", id).One(o)
 	if err != nil {
 		logrus.Errorf("sess.Collection('plants') in archivePlantHandler %q - id: %s uid: %s ueid: %s", err, id, uid, ueid)
-		http.Error(w, err.Error(), http.StatusBadRequest)
+		if err == udb.ErrNoMoreRows {
+			apierrors.Write(w, apierrors.NotFound("Plant not found"))
+			return
+		}
+		apierrors.Write(w, err)
 		return
 	}
 
 	if uid != o.GetUserID() {
 		errorMsg := "Plant is owned by another user"
 		logrus.Errorf("uid != o.GetUserID() in archivePlantHandler %q - uid: %s o: %+v", errorMsg, uid, o)
-		http.Error(w, errorMsg, http.StatusBadRequest)
+		apierrors.Write(w, apierrors.BadRequest(errorMsg))
 		return
 	}
 
 	if _, err := sess.Update("plants").Set("archived", true).Where("id = ?", o.GetID()).Exec(); err != nil {
 		logrus.Errorf("sess.Update('plants') in archivePlantHandler %q - uid: %s o: %+v", err, uid, o)
-		http.Error(w, err.Error(), http.StatusBadRequest)
+		apierrors.Write(w, err)
 		return
 	}
-	if _, err := sess.Update("userend_plants").Set("dirty", true).Where("plantid", id).And("userendid != ?", ueid).And("userendid in (select id from userends where userid = ?)", uid).Exec(); err != nil {
+	if _, err := sess.Update("userend_plants").Set("dirty", true).Where("plantid", id).And("userendid != ?", ueid).And("userendid in ("+db.LegacySyncUserEnds+")", uid).Exec(); err != nil {
 		logrus.Warningf("sess.Update('userend_plants') in archivePlantHandler %q - id: %s uid: %s ueid: %s", err, id, uid, ueid)
-		http.Error(w, err.Error(), http.StatusBadRequest)
+		apierrors.Write(w, err)
 		return
 	}
+	fmiddlewares.NotifyUserEnds(r, uid, ueid, true, "plants", o.GetID().UUID)
 
 	// TODO try something better..
 	if _, err := sess.DeleteFrom("userend_plants").Where("plantid = ?", id).And("userendid = ?", ueid).Exec(); err != nil {
 		logrus.Errorf("sess.DeleteFrom('userend_plants') in archivePlantHandler %q - id: %s uid: %s ueid: %s", err, id, uid, ueid)
-		http.Error(w, err.Error(), http.StatusBadRequest)
+		apierrors.Write(w, err)
 		return
 	}
 	if _, err := sess.DeleteFrom("userend_timelapses").Where("timelapseid in (select id from timelapses where timelapses.plantid = ?)", id).Exec(); err != nil {
 		logrus.Errorf("sess.DeleteFrom('userend_timelapses') in archivePlantHandler %q - id: %s uid: %s ueid: %s", err, id, uid, ueid)
-		http.Error(w, err.Error(), http.StatusBadRequest)
+		apierrors.Write(w, err)
 		return
 	}
 	if _, err := sess.DeleteFrom("userend_feeds").Where("feedid = (select feedid from plants where plants.id = ?)", id).Exec(); err != nil {
 		logrus.Errorf("sess.DeleteFrom('userend_feeds') in archivePlantHandler %q - id: %s uid: %s ueid: %s", err, id, uid, ueid)
-		http.Error(w, err.Error(), http.StatusBadRequest)
+		apierrors.Write(w, err)
 		return
 	}
 	if _, err := sess.DeleteFrom("userend_feedentries").Where("feedentryid in (select id from feedentries where feedentries.feedid = (select feedid from plants where plants.id = ?))", id).Exec(); err != nil {
 		logrus.Errorf("sess.DeleteFrom('userend_feedentries') in archivePlantHandler %q - id: %s uid: %s ueid: %s", err, id, uid, ueid)
-		http.Error(w, err.Error(), http.StatusBadRequest)
+		apierrors.Write(w, err)
 		return
 	}
 	if _, err := sess.DeleteFrom("userend_feedmedias").Where("feedmediaid in (select id from feedmedias where feedentryid in (select id from feedentries where feedentries.feedid = (select feedid from plants where plants.id = ?)))", id).Exec(); err != nil {
 		logrus.Errorf("sess.DeleteFrom('userend_feedmedias') in archivePlantHandler %q - id: %s uid: %s ueid: %s", err, id, uid, ueid)
-		http.Error(w, err.Error(), http.StatusBadRequest)
+		apierrors.Write(w, err)
 		return
 	}
 }
@@ -0,0 +1,284 @@
+/*
+ * Copyright (C) 2021  SuperGreenLab <towelie@supergreenlab.com>
+ * Author: Constantin Clauzel <constantin.clauzel@gmail.com>
+ *
+ * This program is free software: you can redistribute it and/or modify
+ * it under the terms of the GNU General Public License as published by
+ * the Free Software Foundation, either version 3 of the License, or
+ * (at your option) any later version.
+ *
+ * This program is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ * GNU General Public License for more details.
+ *
+ * You should have received a copy of the GNU General Public License
+ * along with this program.  If not, see <http://www.gnu.org/licenses/>.
+ */
+
+package feeds
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"strings"
+
+	"github.com/SuperGreenLab/AppBackend/internal/server/apierrors"
+	"github.com/SuperGreenLab/AppBackend/internal/server/middlewares"
+	"github.com/gofrs/uuid"
+	"github.com/julienschmidt/httprouter"
+	"github.com/rileyr/middleware"
+	"github.com/sirupsen/logrus"
+)
+
+const maxBatchOperations = 200
+
+const (
+	batchOpInsert = "insert"
+	batchOpUpdate = "update"
+	batchOpDelete = "delete"
+)
+
+// batchType - handlers of the individual endpoints, each operation goes through the same checks
+type batchType struct {
+	Insert     httprouter.Handle
+	Update     httprouter.Handle
+	Delete     httprouter.Handle
+	Collection string
+}
+
+// batchOperation - TempID names the inserted object, later operations reference it instead of its id
+type batchOperation struct {
+	Op     string          `json:"op"`
+	Type   string          `json:"type"`
+	TempID string          `json:"tempID,omitempty"`
+	ID     string          `json:"id,omitempty"`
+	Object json.RawMessage `json:"object,omitempty"`
+}
+
+type batchRequest struct {
+	Operations []batchOperation `json:"operations"`
+}
+
+type batchResult struct {
+	Index  int    `json:"index"`
+	TempID string `json:"tempID,omitempty"`
+	ID     string `json:"id,omitempty"`
+	Status int    `json:"status"`
+	ETag   string `json:"etag,omitempty"`
+
+	Error *apierrors.Response `json:"error,omitempty"`
+}
+
+type batchResponse struct {
+	Results []batchResult     `json:"results"`
+	IDs     map[string]string `json:"ids"`
+}
+
+// batchError - the failing operation rolls back the whole batch
+type batchError struct {
+	Err *apierrors.Error
+}
+
+func (e *batchError) Error() string {
+	return e.Err.Message
+}
+
+// batchOperationError - the error envelope written by the endpoint of the operation
+func batchOperationError(rb *middlewares.ResponseBuffer) *apierrors.Error {
+	res := apierrors.Response{}
+	if err := json.Unmarshal(rb.Body.Bytes(), &res); err != nil || res.Code == "" {
+		return apierrors.New(rb.Status(), apierrors.CodeInternal, http.StatusText(rb.Status()))
+	}
+	return apierrors.New(rb.Status(), res.Code, res.Message).WithDetails(res.Details)
+}
+
+// isIDKey - temp ids are only replaced in id fields (id, plantID, feedEntryIDs..), free text is left untouched
+func isIDKey(k string) bool {
+	return k == "id" || strings.HasSuffix(k, "ID") || strings.HasSuffix(k, "IDs")
+}
+
+// replaceTempIDs - swaps the id fields matching a temp id for the real id
+func replaceTempIDs(v interface{}, ids map[string]string) interface{} {
+	switch t := v.(type) {
+	case map[string]interface{}:
+		for k, e := range t {
+			if isIDKey(k) {
+				t[k] = replaceTempID(e, ids)
+			} else {
+				t[k] = replaceTempIDs(e, ids)
+			}
+		}
+	case []interface{}:
+		for i, e := range t {
+			t[i] = replaceTempIDs(e, ids)
+		}
+	}
+	return v
+}
+
+// replaceTempID - value of an id field, either an id or a list of ids
+func replaceTempID(v interface{}, ids map[string]string) interface{} {
+	switch t := v.(type) {
+	case string:
+		if id, ok := ids[t]; ok {
+			return id
+		}
+	case []interface{}:
+		for i, e := range t {
+			t[i] = replaceTempID(e, ids)
+		}
+	}
+	return v
+}
+
+func batchObjectBody(raw json.RawMessage, ids map[string]string) ([]byte, error) {
+	if len(raw) == 0 {
+		return nil, errors.New("Missing object")
+	}
+	var o interface{}
+	d := json.NewDecoder(bytes.NewReader(raw))
+	d.UseNumber()
+	if err := d.Decode(&o); err != nil {
+		return nil, err
+	}
+	return json.Marshal(replaceTempIDs(o, ids))
+}
+
+// batchSubRequest - builds the request sent to the individual endpoint
+func batchSubRequest(ctx context.Context, bt batchType, op batchOperation, ids map[string]string) (httprouter.Handle, *http.Request, error) {
+	var (
+		fn     httprouter.Handle
+		method string
+		body   []byte
+		err    error
+	)
+	switch op.Op {
+	case batchOpInsert:
+		fn, method = bt.Insert, http.MethodPost
+		body, err = batchObjectBody(op.Object, ids)
+	case batchOpUpdate:
+		fn, method = bt.Update, http.MethodPut
+		body, err = batchObjectBody(op.Object, ids)
+	case batchOpDelete:
+		fn, method = bt.Delete, http.MethodPost
+		id := op.ID
+		if realID, ok := ids[id]; ok {
+			id = realID
+		}
+		body, err = json.Marshal(map[string]interface{}{
+			"deletes": []map[string]string{{"id": id, "type": bt.Collection}},
+		})
+	default:
+		return nil, nil, fmt.Errorf("Unknown op %s", op.Op)
+	}
+	if err != nil {
+		return nil, nil, err
+	}
+	r, err := http.NewRequestWithContext(ctx, method, "/batch", bytes.NewReader(body))
+	if err != nil {
+		return nil, nil, err
+	}
+	r.Header.Set("Content-Type", "application/json")
+	return fn, r, nil
+}
+
+// batchHandler - runs the operations in order inside a single transaction, the operations join it
+func batchHandler(types map[string]batchType) httprouter.Handle {
+	s := middleware.NewStack()
+
+	s.Use(middlewares.DecodeJSON(func() interface{} { return &batchRequest{} }))
+	s.Use(middlewares.Transaction)
+
+	return s.Wrap(func(w http.ResponseWriter, r *http.Request, p httprouter.Params) {
+		br := r.Context().Value(middlewares.ObjectContextKey{}).(*batchRequest)
+		uid := r.Context().Value(middlewares.UserIDContextKey{}).(uuid.UUID)
+
+		if len(br.Operations) == 0 || len(br.Operations) > maxBatchOperations {
+			errorMsg := fmt.Sprintf("Batch should contain between 1 and %d operations", maxBatchOperations)
+			logrus.Errorf("%s in batchHandler - uid: %s n: %d", errorMsg, uid, len(br.Operations))
+			apierrors.Write(w, apierrors.BadRequest(errorMsg))
+			return
+		}
+
+		response := batchResponse{
+			Results: []batchResult{},
+			IDs:     map[string]string{},
+		}
+		err := func() error {
+			ctx := r.Context()
+			for i, op := range br.Operations {
+				result := batchResult{Index: i, TempID: op.TempID, ID: op.ID}
+				fail := func(e *apierrors.Error) error {
+					result.Status = e.Status
+					result.Error = &apierrors.Response{Code: e.Code, Message: e.Message, Details: e.Details, RequestID: w.Header().Get(apierrors.RequestIDHeader)}
+					response.Results = append(response.Results, result)
+					return &batchError{Err: e}
+				}
+
+				bt, ok := types[op.Type]
+				if !ok {
+					return fail(apierrors.BadRequest(fmt.Sprintf("Unknown type %s", op.Type)))
+				}
+				if op.TempID != "" {
+					if _, ok := response.IDs[op.TempID]; ok || op.Op != batchOpInsert {
+						return fail(apierrors.BadRequest("tempID should be unique and only set on inserts"))
+					}
+				}
+				fn, sr, err := batchSubRequest(ctx, bt, op, response.IDs)
+				if err != nil {
+					return fail(apierrors.BadRequest(err.Error()))
+				}
+
+				rb := middlewares.NewResponseBuffer(nil)
+				fn(rb, sr, httprouter.Params{})
+				if rb.Status() >= http.StatusBadRequest {
+					return fail(batchOperationError(rb))
+				}
+				result.ETag = rb.Header().Get("ETag")
+
+				if op.Op == batchOpInsert {
+					inserted := struct {
+						ID string `json:"id"`
+					}{}
+					if err := json.Unmarshal(rb.Body.Bytes(), &inserted); err != nil {
+						logrus.Errorf("json.Unmarshal in batchHandler %q - uid: %s index: %d", err, uid, i)
+						return fail(apierrors.Internal())
+					}
+					result.ID = inserted.ID
+					if op.TempID != "" {
+						response.IDs[op.TempID] = inserted.ID
+					}
+				} else if realID, ok := response.IDs[op.ID]; ok {
+					result.ID = realID
+				}
+				result.Status = rb.Status()
+				response.Results = append(response.Results, result)
+			}
+			return nil
+		}()
+
+		// the error status rolls back the transaction
+		var be *batchError
+		if errors.As(err, &be) {
+			logrus.Errorf("batch in batchHandler %q - uid: %s results: %+v", err, uid, response.Results)
+			response.IDs = map[string]string{}
+			w.Header().Set("Content-Type", "application/json")
+			w.WriteHeader(be.Err.Status)
+		} else if err != nil {
+			logrus.Errorf("batch in batchHandler %q - uid: %s", err, uid)
+			apierrors.Write(w, err)
+			return
+		}
+
+		if err := json.NewEncoder(w).Encode(response); err != nil {
+			logrus.Errorf("json.NewEncoder in batchHandler %q - uid: %s", err, uid)
+			apierrors.Write(w, err)
+			return
+		}
+	})
+}
@@ -22,6 +22,8 @@ import (
 	"fmt"
 	"net/http"
 
+	"github.com/SuperGreenLab/AppBackend/internal/data/db"
+	"github.com/SuperGreenLab/AppBackend/internal/server/apierrors"
 	"github.com/SuperGreenLab/AppBackend/internal/server/middlewares"
 	fmiddlewares "github.com/SuperGreenLab/AppBackend/internal/server/routes/feeds/middlewares"
 	appbackend "github.com/SuperGreenLab/AppBackend/pkg"
@@ -30,6 +32,7 @@ import (
 	"github.com/julienschmidt/httprouter"
 	"github.com/rileyr/middleware"
 	"github.com/sirupsen/logrus"
+	udb "upper.io/db.v3"
 	"upper.io/db.v3/lib/sqlbuilder"
 )
 
@@ -73,28 +76,45 @@ func createDeleteHandler() httprouter.Handle {
 		deletes := r.Context().Value(middlewares.ObjectContextKey{}).(*deletesRequest)
 		ueid, ueidOK := r.Context().Value(fmiddlewares.UserEndIDContextKey{}).(uuid.UUID)
 
+		dirty := map[string][]uuid.UUID{}
+		defer func() {
+			for collection, ids := range dirty {
+				fmiddlewares.NotifyUserEnds(r, uid, ueid, ueidOK, collection, ids...)
+			}
+		}()
+
 		for _, del := range deletes.Deletes {
 			factory, ok := factories[del.Type]
 			if ok == false {
-				logrus.Warningf("Unknown type %s by %s", del.Type, uid)
-				continue
+				errorMsg := "Unknown type"
+				logrus.Warningf("%s %s by %s", errorMsg, del.Type, uid)
+				apierrors.Write(w, apierrors.BadRequest(errorMsg))
+				return
 			}
 			o := factory()
 			err := sess.Collection(del.Type).Find("id", del.ID).One(o)
 			if err != nil {
 				logrus.Errorf("sess.Collection.Find in createDeleteHandler %q - %+v by %s", err, del, uid)
-				http.Error(w, err.Error(), http.StatusBadRequest)
+				if err == udb.ErrNoMoreRows {
+					apierrors.Write(w, apierrors.NotFound("Object not found"))
+					return
+				}
+				apierrors.Write(w, err)
 				return
 			}
 
+			// The deletes run in a transaction, nothing is deleted if one of them fails
 			if uid != o.GetUserID() {
-				logrus.Warningf("Object is owned by another user - %+v", del)
-				continue
+				errorMsg := "Object is owned by another user"
+				logrus.Warningf("%s - %+v", errorMsg, del)
+				apierrors.Write(w, apierrors.Forbidden(errorMsg))
+				return
 			}
 
 			if _, err := sess.Update(del.Type).Set("deleted", true).Where("id = ?", o.GetID()).Exec(); err != nil {
-				logrus.Warningf("sess.Update(del.Type) in createDeleteHandler %q - %+v %+v by %s", err, del, o, uid)
-				continue
+				logrus.Errorf("sess.Update(del.Type) in createDeleteHandler %q - %+v %+v by %s", err, del, o, uid)
+				apierrors.Write(w, err)
+				return
 			}
 
 			collection := fmt.Sprintf("userend_%s", del.Type)
@@ -103,16 +123,18 @@ func createDeleteHandler() httprouter.Handle {
 			if ueidOK {
 				ueUpdate = ueUpdate.And("userendid != ?", ueid)
 			}
-			ueUpdate = ueUpdate.And("userendid in (select id from userends where userid = ?)", uid)
+			ueUpdate = ueUpdate.And("userendid in ("+db.LegacySyncUserEnds+")", uid)
 			if _, err := ueUpdate.Exec(); err != nil {
-				logrus.Warningf("sess.Update(collection) in createDeleteHandler %q - %+v by %s", err, del, uid)
-				continue
+				logrus.Errorf("sess.Update(collection) in createDeleteHandler %q - %+v by %s", err, del, uid)
+				apierrors.Write(w, err)
+				return
 			}
+			dirty[del.Type] = append(dirty[del.Type], o.GetID().UUID)
 
 			if ueidOK {
 				if _, err := sess.DeleteFrom(collection).Where(fmt.Sprintf("%s = ?", field), del.ID).And("userendid = ?", ueid).Exec(); err != nil {
 					logrus.Warningf("sess.DeleteFrom(collection) in createDeleteHandler %q - %+v by %s", err, del, uid)
-					http.Error(w, err.Error(), http.StatusBadRequest)
+					apierrors.Write(w, err)
 					return
 				}
 			}
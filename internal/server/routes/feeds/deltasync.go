@@ -0,0 +1,401 @@
+/*
+ * Copyright (C) 2021  SuperGreenLab <towelie@supergreenlab.com>
+ * Author: Constantin Clauzel <constantin.clauzel@gmail.com>
+ *
+ * This program is free software: you can redistribute it and/or modify
+ * it under the terms of the GNU General Public License as published by
+ * the Free Software Foundation, either version 3 of the License, or
+ * (at your option) any later version.
+ *
+ * This program is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ * GNU General Public License for more details.
+ *
+ * You should have received a copy of the GNU General Public License
+ * along with this program.  If not, see <http://www.gnu.org/licenses/>.
+ */
+
+package feeds
+
+import (
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"reflect"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/SuperGreenLab/AppBackend/internal/data/db"
+	"github.com/SuperGreenLab/AppBackend/internal/server/apierrors"
+	"github.com/SuperGreenLab/AppBackend/internal/server/middlewares"
+	fmiddlewares "github.com/SuperGreenLab/AppBackend/internal/server/routes/feeds/middlewares"
+	"github.com/SuperGreenLab/AppBackend/internal/services/prometheus"
+	appbackend "github.com/SuperGreenLab/AppBackend/pkg"
+	"github.com/gofrs/uuid"
+	"github.com/julienschmidt/httprouter"
+	"github.com/rileyr/middleware"
+	"github.com/sirupsen/logrus"
+	udb "upper.io/db.v3"
+	"upper.io/db.v3/lib/sqlbuilder"
+)
+
+var errInvalidSyncCursor = errors.New("Invalid sync cursor")
+
+// deltaSyncCollection - Tombstone is the condition of the objects the client should remove
+type deltaSyncCollection struct {
+	Collection string
+	Factory    func() interface{}
+	Tombstone  string
+	Select     func(sqlbuilder.Selector) sqlbuilder.Selector
+	Post       func(interface{}) error
+}
+
+// archivedFeed - feeds of archived plants and boxes are removed from the clients with their entries and medias
+const archivedFeed = "(exists(select 1 from plants ap where ap.feedid = %[1]s and ap.archived = true) or exists(select 1 from boxes ab where ab.feedid = %[1]s and ab.archived = true))"
+
+var deltaSyncCollections = []deltaSyncCollection{
+	{
+		Collection: "boxes",
+		Factory:    func() interface{} { return &[]appbackend.Box{} },
+		Tombstone:  "a.deleted = true",
+	},
+	{
+		Collection: "plants",
+		Factory:    func() interface{} { return &[]appbackend.Plant{} },
+		Tombstone:  "a.deleted = true or a.archived = true",
+	},
+	{
+		Collection: "timelapses",
+		Factory:    func() interface{} { return &[]appbackend.Timelapse{} },
+		Tombstone:  "a.deleted = true or exists(select 1 from plants ap where ap.id = a.plantid and ap.archived = true)",
+	},
+	{
+		Collection: "devices",
+		Factory:    func() interface{} { return &[]appbackend.Device{} },
+		Tombstone:  "a.deleted = true",
+	},
+	{
+		Collection: "feeds",
+		Factory:    func() interface{} { return &[]appbackend.Feed{} },
+		Tombstone:  "a.deleted = true or " + fmt.Sprintf(archivedFeed, "a.id"),
+		Select: func(selector sqlbuilder.Selector) sqlbuilder.Selector {
+			return selector.And("a.isnewsfeed", false)
+		},
+	},
+	{
+		Collection: "feedentries",
+		Factory:    func() interface{} { return &[]appbackend.FeedEntry{} },
+		Tombstone:  "a.deleted = true or " + fmt.Sprintf(archivedFeed, "a.feedid"),
+		Select: func(selector sqlbuilder.Selector) sqlbuilder.Selector {
+			return selector.Join("feeds f").On("f.id = a.feedid").Where("f.isnewsfeed", false)
+		},
+	},
+	{
+		Collection: "feedmedias",
+		Factory:    func() interface{} { return &[]FeedMediaWithArchived{} },
+		Tombstone:  "a.deleted = true or " + fmt.Sprintf(archivedFeed, "(select afe.feedid from feedentries afe where afe.id = a.feedentryid)"),
+		Select:     selectFeedMediasArchived,
+		Post: func(res interface{}) error {
+			return loadFeedMediasURLs(res.(*[]FeedMediaWithArchived))
+		},
+	},
+}
+
+// encodeSyncCursor - cursors are opaque to the clients
+func encodeSyncCursor(seq int64) string {
+	return base64.RawURLEncoding.EncodeToString([]byte(strconv.FormatInt(seq, 10)))
+}
+
+func decodeSyncCursor(cursor string) (int64, error) {
+	b, err := base64.RawURLEncoding.DecodeString(cursor)
+	if err != nil {
+		return 0, errInvalidSyncCursor
+	}
+	seq, err := strconv.ParseInt(string(b), 10, 64)
+	if err != nil || seq < 0 {
+		return 0, errInvalidSyncCursor
+	}
+	return seq, nil
+}
+
+// currentSyncSeq - oldest transaction still running, every change made before it is visible.
+// Changes of the transactions still running might be sent twice, never skipped.
+func currentSyncSeq(sess sqlbuilder.Database) (int64, error) {
+	var seq int64
+	row, err := sess.QueryRow("select txid_snapshot_xmin(txid_current_snapshot())")
+	if err != nil {
+		return 0, err
+	}
+	err = row.Scan(&seq)
+	return seq, err
+}
+
+type syncTombstone struct {
+	Type string    `json:"type"`
+	ID   uuid.UUID `json:"id"`
+}
+
+type deltaSyncResponse struct {
+	Collections map[string]interface{} `json:"collections"`
+	Tombstones  []syncTombstone        `json:"tombstones"`
+	// Cursor - only sent with the last page, the client calls again with pageToken until then
+	Cursor    string `json:"cursor,omitempty"`
+	PageToken string `json:"pageToken,omitempty"`
+}
+
+const defaultDeltaSyncPageSize = 500
+
+var errInvalidSyncPageToken = errors.New("Invalid page token")
+
+// deltaSyncPage - position in a paginated sync, collections are read in order, their objects then their tombstones,
+// each one ordered on (cat, id). Since is -1 for a full sync, Next is the cursor sent with the last page.
+type deltaSyncPage struct {
+	Since      int64
+	Next       int64
+	Collection int
+	Tombstones bool
+	Cat        time.Time
+	ID         uuid.UUID
+}
+
+func encodeDeltaSyncPage(dsp deltaSyncPage) string {
+	return base64.RawURLEncoding.EncodeToString([]byte(fmt.Sprintf("%d|%d|%d|%t|%s|%s", dsp.Since, dsp.Next, dsp.Collection, dsp.Tombstones, dsp.Cat.Format(time.RFC3339Nano), dsp.ID)))
+}
+
+func decodeDeltaSyncPage(token string) (deltaSyncPage, error) {
+	dsp := deltaSyncPage{}
+	b, err := base64.RawURLEncoding.DecodeString(token)
+	if err != nil {
+		return dsp, errInvalidSyncPageToken
+	}
+	parts := strings.Split(string(b), "|")
+	if len(parts) != 6 {
+		return dsp, errInvalidSyncPageToken
+	}
+	if dsp.Since, err = strconv.ParseInt(parts[0], 10, 64); err != nil || dsp.Since < -1 {
+		return dsp, errInvalidSyncPageToken
+	}
+	if dsp.Next, err = strconv.ParseInt(parts[1], 10, 64); err != nil || dsp.Next < 0 {
+		return dsp, errInvalidSyncPageToken
+	}
+	if dsp.Collection, err = strconv.Atoi(parts[2]); err != nil || dsp.Collection < 0 || dsp.Collection >= len(deltaSyncCollections) {
+		return dsp, errInvalidSyncPageToken
+	}
+	if dsp.Tombstones, err = strconv.ParseBool(parts[3]); err != nil {
+		return dsp, errInvalidSyncPageToken
+	}
+	if dsp.Cat, err = time.Parse(time.RFC3339Nano, parts[4]); err != nil {
+		return dsp, errInvalidSyncPageToken
+	}
+	if dsp.ID, err = uuid.FromString(parts[5]); err != nil {
+		return dsp, errInvalidSyncPageToken
+	}
+	return dsp, nil
+}
+
+type deltaSyncParams struct {
+	Cursor    string
+	PageToken string
+	Limit     int
+}
+
+// enableDeltaSync - the userend_* rows of the userend are removed the first time it calls /sync
+func enableDeltaSync(sess sqlbuilder.Database, ueid uuid.UUID) error {
+	res, err := sess.Update("userends").Set("deltasync", true).Where("id = ?", ueid).And("deltasync = ?", false).Exec()
+	if err != nil {
+		return err
+	}
+	if n, err := res.RowsAffected(); err != nil || n == 0 {
+		return err
+	}
+	n, err := db.DeleteUserEndObjects(sess, ueid)
+	if err != nil {
+		return err
+	}
+	prometheus.UserEndObjectsReclaimed(n)
+	return nil
+}
+
+func deltaSyncSelector(sess sqlbuilder.Database, c deltaSyncCollection, uid uuid.UUID, columns ...interface{}) sqlbuilder.Selector {
+	selector := sess.Select(columns...).From(fmt.Sprintf("%s a", c.Collection)).Where("a.userid = ?", uid)
+	if c.Select != nil {
+		selector = c.Select(selector)
+	}
+	return selector
+}
+
+// deltaSyncHandler - returns everything that changed since the cursor, no cursor means a full sync.
+// Responses are paginated, the cursor only comes with the last page.
+func deltaSyncHandler() httprouter.Handle {
+	s := middleware.NewStack()
+
+	s.Use(middlewares.DecodeQuery(func() interface{} { return &deltaSyncParams{} }))
+
+	return s.Wrap(deltaSync)
+}
+
+func deltaSync(w http.ResponseWriter, r *http.Request, p httprouter.Params) {
+	sess := r.Context().Value(middlewares.SessContextKey{}).(sqlbuilder.Database)
+	uid := r.Context().Value(middlewares.UserIDContextKey{}).(uuid.UUID)
+	ueid := r.Context().Value(fmiddlewares.UserEndIDContextKey{}).(uuid.UUID)
+	params := r.Context().Value(middlewares.QueryObjectContextKey{}).(*deltaSyncParams)
+
+	limit := params.Limit
+	if limit == 0 {
+		limit = defaultDeltaSyncPageSize
+	}
+	if limit < 0 || limit > maxSyncPageSize {
+		errorMsg := fmt.Sprintf("limit should be between 1 and %d", maxSyncPageSize)
+		logrus.Errorf("%s in deltaSyncHandler - uid: %s limit: %d", errorMsg, uid, params.Limit)
+		apierrors.Write(w, apierrors.BadRequest(errorMsg))
+		return
+	}
+
+	var (
+		page    deltaSyncPage
+		resumed bool
+	)
+	if params.PageToken != "" {
+		var err error
+		if page, err = decodeDeltaSyncPage(params.PageToken); err != nil {
+			logrus.Errorf("decodeDeltaSyncPage in deltaSyncHandler %q - uid: %s pageToken: %s", err, uid, params.PageToken)
+			apierrors.Write(w, apierrors.BadRequest(err.Error()))
+			return
+		}
+		resumed = true
+	} else {
+		page.Since = -1
+		if params.Cursor != "" {
+			var err error
+			if page.Since, err = decodeSyncCursor(params.Cursor); err != nil {
+				logrus.Errorf("decodeSyncCursor in deltaSyncHandler %q - uid: %s cursor: %s", err, uid, params.Cursor)
+				apierrors.Write(w, apierrors.BadRequest(err.Error()))
+				return
+			}
+		}
+
+		// This userend doesn't need the userend_* rows anymore
+		if err := enableDeltaSync(sess, ueid); err != nil {
+			logrus.Errorf("enableDeltaSync in deltaSyncHandler %q - uid: %s ueid: %s", err, uid, ueid)
+			apierrors.Write(w, err)
+			return
+		}
+
+		// Taken before reading the first page, anything committed later is sent on the next sync
+		var err error
+		if page.Next, err = currentSyncSeq(sess); err != nil {
+			logrus.Errorf("currentSyncSeq in deltaSyncHandler %q - uid: %s", err, uid)
+			apierrors.Write(w, err)
+			return
+		}
+	}
+
+	response := deltaSyncResponse{
+		Collections: map[string]interface{}{},
+		Tombstones:  []syncTombstone{},
+	}
+	remaining := limit
+	for ci := page.Collection; ci < len(deltaSyncCollections); ci++ {
+		c := deltaSyncCollections[ci]
+		// the page token points inside this collection
+		inPage := resumed && ci == page.Collection
+		if remaining == 0 {
+			response.PageToken = encodeDeltaSyncPage(deltaSyncPage{Since: page.Since, Next: page.Next, Collection: ci})
+			break
+		}
+
+		if !(inPage && page.Tombstones) {
+			res := c.Factory()
+			selector := deltaSyncSelector(sess, c, uid, udb.Raw("a.*")).And(fmt.Sprintf("not (%s)", c.Tombstone))
+			if page.Since >= 0 {
+				selector = selector.And("a.changeseq >= ?", page.Since)
+			}
+			if inPage {
+				selector = selector.And("(a.cat, a.id) > (?, ?)", page.Cat, page.ID)
+			}
+			if err := selector.OrderBy("a.cat ASC", "a.id ASC").Limit(remaining + 1).All(res); err != nil {
+				logrus.Errorf("selector.All in deltaSyncHandler %q - collection: %s uid: %s", err, c.Collection, uid)
+				apierrors.Write(w, err)
+				return
+			}
+			full := truncateSyncPage(res, remaining) != ""
+			if c.Post != nil {
+				if err := c.Post(res); err != nil {
+					logrus.Errorf("c.Post in deltaSyncHandler %q - collection: %s uid: %s", err, c.Collection, uid)
+					apierrors.Write(w, err)
+					return
+				}
+			}
+			response.Collections[c.Collection] = res
+			n := reflect.ValueOf(res).Elem().Len()
+			if full {
+				last := reflect.ValueOf(res).Elem().Index(n - 1)
+				response.PageToken = encodeDeltaSyncPage(deltaSyncPage{
+					Since:      page.Since,
+					Next:       page.Next,
+					Collection: ci,
+					Cat:        last.FieldByName("CreatedAt").Interface().(time.Time),
+					ID:         last.FieldByName("ID").Interface().(uuid.NullUUID).UUID,
+				})
+				break
+			}
+			remaining -= n
+			inPage = false
+		}
+
+		// A full sync has nothing to remove
+		if page.Since < 0 {
+			continue
+		}
+		if remaining == 0 {
+			response.PageToken = encodeDeltaSyncPage(deltaSyncPage{Since: page.Since, Next: page.Next, Collection: ci, Tombstones: true})
+			break
+		}
+		ids := []struct {
+			ID        uuid.UUID `db:"id"`
+			CreatedAt time.Time `db:"cat"`
+		}{}
+		selector := deltaSyncSelector(sess, c, uid, "a.id", "a.cat").And(c.Tombstone).And("a.changeseq >= ?", page.Since)
+		if inPage {
+			selector = selector.And("(a.cat, a.id) > (?, ?)", page.Cat, page.ID)
+		}
+		if err := selector.OrderBy("a.cat ASC", "a.id ASC").Limit(remaining + 1).All(&ids); err != nil {
+			logrus.Errorf("selector.All in deltaSyncHandler %q - collection: %s uid: %s", err, c.Collection, uid)
+			apierrors.Write(w, err)
+			return
+		}
+		full := len(ids) > remaining
+		if full {
+			ids = ids[:remaining]
+		}
+		for _, id := range ids {
+			response.Tombstones = append(response.Tombstones, syncTombstone{Type: c.Collection, ID: id.ID})
+		}
+		if full {
+			last := ids[len(ids)-1]
+			response.PageToken = encodeDeltaSyncPage(deltaSyncPage{
+				Since:      page.Since,
+				Next:       page.Next,
+				Collection: ci,
+				Tombstones: true,
+				Cat:        last.CreatedAt,
+				ID:         last.ID,
+			})
+			break
+		}
+		remaining -= len(ids)
+	}
+	if response.PageToken == "" {
+		response.Cursor = encodeSyncCursor(page.Next)
+	}
+
+	if err := json.NewEncoder(w).Encode(response); err != nil {
+		logrus.Errorf("json.NewEncoder in deltaSyncHandler %q - uid: %s", err, uid)
+		apierrors.Write(w, err)
+		return
+	}
+}
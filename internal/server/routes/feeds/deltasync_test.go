@@ -0,0 +1,101 @@
+/*
+ * Copyright (C) 2021  SuperGreenLab <towelie@supergreenlab.com>
+ * Author: Constantin Clauzel <constantin.clauzel@gmail.com>
+ *
+ * This program is free software: you can redistribute it and/or modify
+ * it under the terms of the GNU General Public License as published by
+ * the Free Software Foundation, either version 3 of the License, or
+ * (at your option) any later version.
+ *
+ * This program is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ * GNU General Public License for more details.
+ *
+ * You should have received a copy of the GNU General Public License
+ * along with this program.  If not, see <http://www.gnu.org/licenses/>.
+ */
+
+package feeds
+
+import (
+	"encoding/base64"
+	"testing"
+	"time"
+
+	"github.com/gofrs/uuid"
+)
+
+func TestSyncCursorRoundTrip(t *testing.T) {
+	for _, seq := range []int64{0, 1, 4242, 1 << 62} {
+		cursor := encodeSyncCursor(seq)
+		got, err := decodeSyncCursor(cursor)
+		if err != nil || got != seq {
+			t.Errorf("decodeSyncCursor(%q): got (%d, %v), want (%d, nil)", cursor, got, err, seq)
+		}
+	}
+}
+
+func TestDecodeSyncCursorInvalid(t *testing.T) {
+	cursors := []string{
+		"",
+		"not base64!",
+		base64.URLEncoding.EncodeToString([]byte("42")),
+		base64.RawURLEncoding.EncodeToString([]byte("abc")),
+		base64.RawURLEncoding.EncodeToString([]byte("-1")),
+		base64.RawURLEncoding.EncodeToString([]byte("1.5")),
+		base64.RawURLEncoding.EncodeToString([]byte("99999999999999999999")),
+	}
+	for _, cursor := range cursors {
+		if seq, err := decodeSyncCursor(cursor); err != errInvalidSyncCursor {
+			t.Errorf("decodeSyncCursor(%q): got (%d, %v), want errInvalidSyncCursor", cursor, seq, err)
+		}
+	}
+}
+
+func TestDeltaSyncPageRoundTrip(t *testing.T) {
+	id := uuid.Must(uuid.FromString("d5a9f6e2-9b4c-4d67-8a1e-2f3c4b5a6d7e"))
+	cat := time.Date(2021, 3, 4, 5, 6, 7, 123456000, time.UTC)
+	pages := []deltaSyncPage{
+		{Since: -1, Next: 42, Collection: 0, Tombstones: false, Cat: time.Time{}.UTC(), ID: uuid.Nil},
+		{Since: 10, Next: 42, Collection: len(deltaSyncCollections) - 1, Tombstones: true, Cat: cat, ID: id},
+	}
+	for _, dsp := range pages {
+		token := encodeDeltaSyncPage(dsp)
+		got, err := decodeDeltaSyncPage(token)
+		if err != nil {
+			t.Errorf("decodeDeltaSyncPage(%q): unexpected error %q", token, err)
+			continue
+		}
+		if got.Since != dsp.Since || got.Next != dsp.Next || got.Collection != dsp.Collection || got.Tombstones != dsp.Tombstones || !got.Cat.Equal(dsp.Cat) || got.ID != dsp.ID {
+			t.Errorf("decodeDeltaSyncPage(encodeDeltaSyncPage(%+v)): got %+v", dsp, got)
+		}
+	}
+}
+
+func TestDecodeDeltaSyncPageInvalid(t *testing.T) {
+	encode := func(s string) string {
+		return base64.RawURLEncoding.EncodeToString([]byte(s))
+	}
+	cat := "2021-03-04T05:06:07.123456Z"
+	id := "d5a9f6e2-9b4c-4d67-8a1e-2f3c4b5a6d7e"
+	tokens := []string{
+		"",
+		"not base64!",
+		encode("-1|42|0|false|" + cat),
+		encode("-1|42|0|false|" + cat + "|" + id + "|extra"),
+		encode("-2|42|0|false|" + cat + "|" + id),
+		encode("x|42|0|false|" + cat + "|" + id),
+		encode("-1|-1|0|false|" + cat + "|" + id),
+		encode("-1|42|-1|false|" + cat + "|" + id),
+		encode("-1|42|99|false|" + cat + "|" + id),
+		encode("-1|42|0|maybe|" + cat + "|" + id),
+		encode("-1|42|0|false|yesterday|" + id),
+		encode("-1|42|0|false|" + cat + "|not-a-uuid"),
+	}
+	for _, token := range tokens {
+		if dsp, err := decodeDeltaSyncPage(token); err != errInvalidSyncPageToken {
+			t.Errorf("decodeDeltaSyncPage(%q): got (%+v, %v), want errInvalidSyncPageToken", token, dsp, err)
+		}
+	}
+}
@@ -0,0 +1,125 @@
+/*
+ * Copyright (C) 2021  SuperGreenLab <towelie@supergreenlab.com>
+ * Author: Constantin Clauzel <constantin.clauzel@gmail.com>
+ *
+ * This program is free software: you can redistribute it and/or modify
+ * it under the terms of the GNU General Public License as published by
+ * the Free Software Foundation, either version 3 of the License, or
+ * (at your option) any later version.
+ *
+ * This program is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ * GNU General Public License for more details.
+ *
+ * You should have received a copy of the GNU General Public License
+ * along with this program.  If not, see <http://www.gnu.org/licenses/>.
+ */
+
+package feeds
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"time"
+
+	"github.com/SuperGreenLab/AppBackend/internal/data/db"
+	"github.com/SuperGreenLab/AppBackend/internal/server/apierrors"
+	"github.com/SuperGreenLab/AppBackend/internal/server/middlewares"
+	fmiddlewares "github.com/SuperGreenLab/AppBackend/internal/server/routes/feeds/middlewares"
+	"github.com/SuperGreenLab/AppBackend/internal/services/pubsub"
+	"github.com/dgrijalva/jwt-go"
+	"github.com/gofrs/uuid"
+	"github.com/julienschmidt/httprouter"
+	"github.com/sirupsen/logrus"
+)
+
+// keeps the connection open through proxies
+const userEndEventsPing = 30 * time.Second
+
+// userEndEventsHandler - server-sent events, a dirty event is sent each time another userend changes objects of the user
+func userEndEventsHandler(w http.ResponseWriter, r *http.Request, p httprouter.Params) {
+	uid := r.Context().Value(middlewares.UserIDContextKey{}).(uuid.UUID)
+	ueid := r.Context().Value(fmiddlewares.UserEndIDContextKey{}).(uuid.UUID)
+
+	flusher, ok := w.(http.Flusher)
+	if !ok {
+		errorMsg := "Streaming unsupported"
+		logrus.Errorf("%s - uid: %s ueid: %s", errorMsg, uid, ueid)
+		apierrors.Write(w, apierrors.Internal())
+		return
+	}
+
+	ch := pubsub.SubscribeUserEndsDirty(uid)
+	defer pubsub.UnsubscribeUserEndsDirty(ch)
+
+	w.Header().Set("Content-Type", "text/event-stream")
+	w.Header().Set("Cache-Control", "no-cache")
+	w.Header().Set("Connection", "keep-alive")
+	w.Header().Set("X-Accel-Buffering", "no")
+	w.WriteHeader(http.StatusOK)
+	fmt.Fprint(w, "retry: 5000\n\n")
+	flusher.Flush()
+
+	ticker := time.NewTicker(userEndEventsPing)
+	defer ticker.Stop()
+
+	// the stream ends with the access token, the client reconnects with a refreshed one
+	var expired <-chan time.Time
+	claims := r.Context().Value(middlewares.JwtClaimsContextKey{}).(jwt.MapClaims)
+	if exp, ok := claims["exp"].(float64); ok {
+		timer := time.NewTimer(time.Until(time.Unix(int64(exp), 0)))
+		defer timer.Stop()
+		expired = timer.C
+	}
+
+	for {
+		select {
+		case <-r.Context().Done():
+			return
+		case <-expired:
+			return
+		case <-ticker.C:
+			// auth is only checked when the stream opens
+			if !userEndActive(uid, ueid) {
+				return
+			}
+			fmt.Fprint(w, ": ping\n\n")
+			flusher.Flush()
+		case m, ok := <-ch:
+			if !ok {
+				return
+			}
+			dirty := m.(pubsub.UserEndsDirty)
+			if dirty.UserEndID.Valid && dirty.UserEndID.UUID == ueid {
+				continue
+			}
+			b, err := json.Marshal(dirty)
+			if err != nil {
+				logrus.Errorf("json.Marshal in userEndEventsHandler %q - %+v", err, dirty)
+				continue
+			}
+			fmt.Fprintf(w, "event: dirty\ndata: %s\n\n", b)
+			flusher.Flush()
+		}
+	}
+}
+
+// userEndActive - false once the userend is revoked or the user deleted
+func userEndActive(uid, ueid uuid.UUID) bool {
+	ue, err := db.GetUserEnd(ueid)
+	if err != nil {
+		logrus.Errorf("db.GetUserEnd in userEndActive %q - uid: %s ueid: %s", err, uid, ueid)
+		return false
+	}
+	if ue.Revoked {
+		return false
+	}
+	active, err := db.IsUserActive(uid)
+	if err != nil {
+		logrus.Errorf("db.IsUserActive in userEndActive %q - uid: %s", err, uid)
+		return false
+	}
+	return active
+}
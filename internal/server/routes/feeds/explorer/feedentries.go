@@ -38,6 +38,8 @@ type SelectFeedEntriesEndpointBuilder struct {
 
 	Cache    middleware.Middleware
 	Selector middleware.Middleware
+	Keyset   middlewares.Keyset
+	Filters  middlewares.Filters
 }
 
 func (dbe SelectFeedEntriesEndpointBuilder) Endpoint() middlewares.Endpoint {
@@ -47,15 +49,32 @@ func (dbe SelectFeedEntriesEndpointBuilder) Endpoint() middlewares.Endpoint {
 	} else {
 		dbe.Pre[0] = dbe.Selector
 	}
-	e := dbe.DBEndpointBuilder.Endpoint()
+	e := dbe.DBEndpointBuilder.WithFilters(dbe.Filters).WithKeyset(dbe.Keyset).Endpoint()
 	e.Output = dbe.DBEndpointBuilder.Output
 	return e
 }
 
+func (dbe SelectFeedEntriesEndpointBuilder) SetKeyset(k middlewares.Keyset) SelectFeedEntriesEndpointBuilder {
+	dbe.Keyset = k
+	return dbe
+}
+
+func (dbe SelectFeedEntriesEndpointBuilder) SetFilters(filters middlewares.Filters) SelectFeedEntriesEndpointBuilder {
+	dbe.Filters = filters
+	return dbe
+}
+
 func (dbe SelectFeedEntriesEndpointBuilder) EnableCache(prefix string) SelectFeedEntriesEndpointBuilder {
 	dbe.Cache = middlewares.SelectCacheResult(func(r *http.Request, p httprouter.Params) string {
 		params := r.Context().Value(middlewares.QueryObjectContextKey{}).(*SelectFeedEntriesParams)
-		return fmt.Sprintf("%s.%d-%d", prefix, params.Offset, params.Limit)
+		key := fmt.Sprintf("%s.%d-%d", prefix, params.Offset, params.Limit)
+		if _, ok := r.URL.Query()["cursor"]; ok {
+			key = fmt.Sprintf("%s.cursor.%s-%s-%d.%s", prefix, params.Sort, params.Order, params.Limit, params.Cursor)
+		}
+		if filters := middlewares.FilterCacheKey(r); filters != "" {
+			key = fmt.Sprintf("%s.%s", key, filters)
+		}
+		return key
 	})
 	return dbe
 }
@@ -79,6 +98,18 @@ func NewSelectFeedEntriesEndpointBuilder(pre []middleware.Middleware) SelectFeed
 	return NewSelectFeedEntriesEndpointBuilderWithSelector(defaultSelector, pre)
 }
 
+var feedEntriesKeyset = middlewares.Keyset{
+	Default: "date",
+	Sorts: map[string]middlewares.KeysetSort{
+		"date": {Column: "fe.createdat", Field: "Date", ID: "fe.id", IDField: "ID"},
+	},
+}
+
+var feedEntriesFilters = middlewares.Filters{
+	"etype":     {Column: "fe.etype", Type: middlewares.FilterString, Ops: middlewares.FilterEqualOps},
+	"createdat": {Column: "fe.createdat", Type: middlewares.FilterTime, Ops: middlewares.FilterRangeOps},
+}
+
 func NewSelectFeedEntriesEndpointBuilderWithSelector(selector middleware.Middleware, pre []middleware.Middleware) SelectFeedEntriesEndpointBuilder {
 	pre = append([]middleware.Middleware{
 		selector,
@@ -96,6 +127,8 @@ func NewSelectFeedEntriesEndpointBuilderWithSelector(selector middleware.Middlew
 			middlewares.SelectQuery(factory),
 			middlewares.OutputResult("entries")),
 		Selector: selector,
+		Keyset:   feedEntriesKeyset,
+		Filters:  feedEntriesFilters,
 	}
 	return e
 }
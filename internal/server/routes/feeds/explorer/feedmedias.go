@@ -36,15 +36,27 @@ type SelectFeedMediasEndpointBuilder struct {
 	middlewares.DBEndpointBuilder
 
 	Selector middleware.Middleware
+	Keyset   middlewares.Keyset
+	Filters  middlewares.Filters
 }
 
 func (dbe SelectFeedMediasEndpointBuilder) Endpoint() middlewares.Endpoint {
 	dbe.Pre[0] = dbe.Selector
-	e := dbe.DBEndpointBuilder.Endpoint()
+	e := dbe.DBEndpointBuilder.WithFilters(dbe.Filters).WithKeyset(dbe.Keyset).Endpoint()
 	e.Output = dbe.DBEndpointBuilder.Output
 	return e
 }
 
+func (dbe SelectFeedMediasEndpointBuilder) SetKeyset(k middlewares.Keyset) SelectFeedMediasEndpointBuilder {
+	dbe.Keyset = k
+	return dbe
+}
+
+func (dbe SelectFeedMediasEndpointBuilder) SetFilters(filters middlewares.Filters) SelectFeedMediasEndpointBuilder {
+	dbe.Filters = filters
+	return dbe
+}
+
 func NewSelectFeedMediasEndpointBuilder(pre []middleware.Middleware) SelectFeedMediasEndpointBuilder {
 	defaultSelector := func(fn httprouter.Handle) httprouter.Handle {
 		return func(w http.ResponseWriter, r *http.Request, p httprouter.Params) {
@@ -59,6 +71,17 @@ func NewSelectFeedMediasEndpointBuilder(pre []middleware.Middleware) SelectFeedM
 	return NewSelectFeedMediasEndpointBuilderWithSelector(defaultSelector, pre)
 }
 
+var feedMediasKeyset = middlewares.Keyset{
+	Default: "cat",
+	Sorts: map[string]middlewares.KeysetSort{
+		"cat": {Column: "fm.cat", Field: "CreatedAt", ID: "fm.id", IDField: "ID"},
+	},
+}
+
+var feedMediasFilters = middlewares.Filters{
+	"cat": {Column: "fm.cat", Type: middlewares.FilterTime, Ops: middlewares.FilterRangeOps},
+}
+
 func NewSelectFeedMediasEndpointBuilderWithSelector(selector middleware.Middleware, pre []middleware.Middleware) SelectFeedMediasEndpointBuilder {
 	pre = append([]middleware.Middleware{
 		selector,
@@ -76,6 +99,8 @@ func NewSelectFeedMediasEndpointBuilderWithSelector(selector middleware.Middlewa
 			middlewares.SelectQuery(factory),
 			middlewares.OutputResult("medias")),
 		Selector: selector,
+		Keyset:   feedMediasKeyset,
+		Filters:  feedMediasFilters,
 	}
 	return e
 }
@@ -45,4 +45,9 @@ var fetchLatestCommentedFeedEntries = NewSelectFeedEntriesEndpointBuilder([]midd
 	joinPlantForFeedEntry,
 	createJoinLatestPlantFeedMedia(false, false, []interface{}{"latestfmrow.thumbnailpath as plantthumbnailpath"}),
 	leftJoinLatestFeedMediaForFeedEntry,
+}).SetKeyset(middlewares.Keyset{
+	Default: "commentDate",
+	Sorts: map[string]middlewares.KeysetSort{
+		"commentDate": {Column: "comments.cat", Field: "CommentDate", ID: "comments.id", IDField: "CommentID"},
+	},
 }).EnableCache("latestCommentedFeedEntries").Endpoint().Handle()
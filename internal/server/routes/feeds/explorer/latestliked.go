@@ -45,4 +45,9 @@ var fetchLatestLikedFeedEntries = NewSelectFeedEntriesEndpointBuilderWithSelecto
 		createJoinLatestPlantFeedMedia(false, false, []interface{}{"latestfmrow.thumbnailpath as plantthumbnailpath"}),
 		leftJoinLatestFeedMediaForFeedEntry,
 	},
-).EnableCache("latestLikedFeedEntries").Endpoint().Handle()
+).SetKeyset(middlewares.Keyset{
+	Default: "likeDate",
+	Sorts: map[string]middlewares.KeysetSort{
+		"likeDate": {Column: "fe.likecat", Field: "LikeDate", ID: "fe.id", IDField: "ID"},
+	},
+}).EnableCache("latestLikedFeedEntries").Endpoint().Handle()
@@ -160,3 +160,17 @@ func (pfe *publicFeedMedias) AsFeedMediasArray() []appbackend.S3FileHolder {
 	}
 	return res
 }
+
+type publicUser struct {
+	ID        string    `db:"id" json:"id"`
+	Nickname  string    `db:"nickname" json:"nickname"`
+	Pic       *string   `db:"pic" json:"pic"`
+	CreatedAt time.Time `db:"cat" json:"cat"`
+
+	NPlants    int `db:"nplants" json:"nPlants"`
+	NFollowers int `db:"nfollowers" json:"nFollowers"`
+	NFollowing int `db:"nfollowing" json:"nFollowing"`
+
+	Plants  interface{} `db:"-" json:"plants"`
+	Entries interface{} `db:"-" json:"entries"`
+}
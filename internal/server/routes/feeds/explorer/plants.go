@@ -36,6 +36,8 @@ type SelectPlantsEndpointBuilder struct {
 	middlewares.DBEndpointBuilder
 
 	Selector middleware.Middleware
+	Keyset   middlewares.Keyset
+	Filters  middlewares.Filters
 }
 
 func (dbe SelectPlantsEndpointBuilder) SetParam(param middlewares.Factory) SelectPlantsEndpointBuilder {
@@ -45,11 +47,21 @@ func (dbe SelectPlantsEndpointBuilder) SetParam(param middlewares.Factory) Selec
 
 func (dbe SelectPlantsEndpointBuilder) Endpoint() middlewares.Endpoint {
 	dbe.Pre[0] = dbe.Selector
-	e := dbe.DBEndpointBuilder.Endpoint()
+	e := dbe.DBEndpointBuilder.WithFilters(dbe.Filters).WithKeyset(dbe.Keyset).Endpoint()
 	e.Output = dbe.DBEndpointBuilder.Output
 	return e
 }
 
+func (dbe SelectPlantsEndpointBuilder) SetKeyset(k middlewares.Keyset) SelectPlantsEndpointBuilder {
+	dbe.Keyset = k
+	return dbe
+}
+
+func (dbe SelectPlantsEndpointBuilder) SetFilters(filters middlewares.Filters) SelectPlantsEndpointBuilder {
+	dbe.Filters = filters
+	return dbe
+}
+
 func NewSelectPlantsEndpointBuilder(pre []middleware.Middleware) SelectPlantsEndpointBuilder {
 	defaultSelector := func(fn httprouter.Handle) httprouter.Handle {
 		return func(w http.ResponseWriter, r *http.Request, p httprouter.Params) {
@@ -62,6 +74,18 @@ func NewSelectPlantsEndpointBuilder(pre []middleware.Middleware) SelectPlantsEnd
 	return NewSelectPlantsEndpointBuilderWithSelector(defaultSelector, pre)
 }
 
+var plantsKeyset = middlewares.Keyset{
+	Default: "lastUpdate",
+	Sorts: map[string]middlewares.KeysetSort{
+		"lastUpdate": {Column: "latestferow.createdat", Field: "LastUpdate", ID: "p.id", IDField: "ID"},
+		"name":       {Column: "p.name", Field: "Name", ID: "p.id", IDField: "ID"},
+	},
+}
+
+var plantsFilters = middlewares.Filters{
+	"lastupdate": {Column: "latestferow.createdat", Type: middlewares.FilterTime, Ops: middlewares.FilterRangeOps},
+}
+
 func NewSelectPlantsEndpointBuilderWithSelector(selector middleware.Middleware, pre []middleware.Middleware) SelectPlantsEndpointBuilder {
 	pre = append([]middleware.Middleware{
 		selector,
@@ -82,6 +106,8 @@ func NewSelectPlantsEndpointBuilderWithSelector(selector middleware.Middleware,
 			middlewares.SelectQuery(factory),
 			middlewares.OutputResult("plants")),
 		Selector: selector,
+		Keyset:   plantsKeyset,
+		Filters:  plantsFilters,
 	}
 	return e
 }
@@ -0,0 +1,167 @@
+/*
+ * Copyright (C) 2021  SuperGreenLab <towelie@supergreenlab.com>
+ * Author: Constantin Clauzel <constantin.clauzel@gmail.com>
+ *
+ * This program is free software: you can redistribute it and/or modify
+ * it under the terms of the GNU General Public License as published by
+ * the Free Software Foundation, either version 3 of the License, or
+ * (at your option) any later version.
+ *
+ * This program is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ * GNU General Public License for more details.
+ *
+ * You should have received a copy of the GNU General Public License
+ * along with this program.  If not, see <http://www.gnu.org/licenses/>.
+ */
+
+package explorer
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+
+	"github.com/SuperGreenLab/AppBackend/internal/data/db"
+	"github.com/SuperGreenLab/AppBackend/internal/data/storage"
+	"github.com/SuperGreenLab/AppBackend/internal/server/apierrors"
+	"github.com/SuperGreenLab/AppBackend/internal/server/middlewares"
+	"github.com/julienschmidt/httprouter"
+	"github.com/rileyr/middleware"
+	"github.com/sirupsen/logrus"
+	udb "upper.io/db.v3"
+	"upper.io/db.v3/lib/sqlbuilder"
+)
+
+// nicknameHandle - nicknames are matched the same way as login handles
+func nicknameHandle(p httprouter.Params) string {
+	return strings.ToLower(strings.Replace(p.ByName("nickname"), " ", "", -1))
+}
+
+// publicUserIDQuery - old nicknames still resolve to the user
+const publicUserIDQuery = `coalesce(
+	(select id from users where lower(replace(nickname, ' ', '')) = ? and deleted = false),
+	(select n.userid from nicknames n join users u on u.id = n.userid where lower(replace(n.nickname, ' ', '')) = ? and u.deleted = false order by n.cat desc limit 1))`
+
+var selectPublicUserPlants = NewSelectPlantsEndpointBuilder([]middleware.Middleware{
+	middlewares.Filter(func(p httprouter.Params, selector sqlbuilder.Selector) sqlbuilder.Selector {
+		return selector.Where("p.userid = "+publicUserIDQuery, nicknameHandle(p), nicknameHandle(p))
+	}),
+	joinNFollows,
+}).Endpoint()
+
+var selectPublicUserFeedEntries = NewSelectFeedEntriesEndpointBuilder([]middleware.Middleware{
+	middlewares.Filter(func(p httprouter.Params, selector sqlbuilder.Selector) sqlbuilder.Selector {
+		return selector.Where("pfeo.userid = "+publicUserIDQuery, nicknameHandle(p), nicknameHandle(p))
+	}),
+	joinPlantForFeedEntry,
+	joinBoxSettings,
+	joinFollows,
+}).JoinSocial().Endpoint()
+
+var fetchPublicUserPlants = selectPublicUserPlants.Handle()
+var fetchPublicUserFeedEntries = selectPublicUserFeedEntries.Handle()
+
+type embeddedResultContextKey struct{}
+
+// embedResult - replaces the output of an endpoint, the result is kept for the caller instead of being written
+func embedResult(e middlewares.Endpoint) httprouter.Handle {
+	e.Output = func(w http.ResponseWriter, r *http.Request, p httprouter.Params) {
+		result := r.Context().Value(embeddedResultContextKey{}).(*interface{})
+		*result = r.Context().Value(middlewares.SelectResultContextKey{})
+	}
+	return e.Handle()
+}
+
+// runEmbedded - the endpoint runs on a clean sub-request, the outer query string (offset, limit, filters..)
+// is meant for the outer endpoint. Returns false if the endpoint failed, the error has already been written
+func runEmbedded(fn httprouter.Handle, w http.ResponseWriter, r *http.Request, p httprouter.Params) (interface{}, bool) {
+	var result interface{}
+	ctx := context.WithValue(r.Context(), embeddedResultContextKey{}, &result)
+	sr := r.Clone(ctx)
+	sr.URL.RawQuery = ""
+
+	rb := middlewares.NewResponseBuffer(w.Header())
+	fn(rb, sr, p)
+	if result == nil {
+		rb.Flush(w)
+		return nil, false
+	}
+	return result, true
+}
+
+var embeddedPublicUserPlants = embedResult(selectPublicUserPlants)
+var embeddedPublicUserFeedEntries = embedResult(selectPublicUserFeedEntries)
+
+// redirectOldNickname - permanent redirect to the current nickname of the user
+func redirectOldNickname(w http.ResponseWriter, r *http.Request, p httprouter.Params) {
+	userID, err := db.GetUserIDForOldNickname(p.ByName("nickname"))
+	if err == udb.ErrNoMoreRows {
+		apierrors.Write(w, apierrors.NotFound("User not found"))
+		return
+	} else if err != nil {
+		logrus.Errorf("db.GetUserIDForOldNickname in redirectOldNickname %q - p: %+v", err, p)
+		apierrors.Write(w, err)
+		return
+	}
+	user, err := db.GetUser(userID)
+	if err != nil {
+		logrus.Errorf("db.GetUser in redirectOldNickname %q - p: %+v", err, p)
+		apierrors.Write(w, err)
+		return
+	}
+	u := url.URL{Path: fmt.Sprintf("/public/user/%s", user.Nickname), RawQuery: r.URL.RawQuery}
+	http.Redirect(w, r, u.String(), http.StatusMovedPermanently)
+}
+
+func fetchPublicUser(w http.ResponseWriter, r *http.Request, p httprouter.Params) {
+	sess := r.Context().Value(middlewares.SessContextKey{}).(sqlbuilder.Database)
+
+	user := publicUser{}
+	selector := sess.Select("u.id", "u.nickname", "u.pic", "u.cat").
+		Columns(udb.Raw("(select count(*) from plants pl where pl.userid = u.id and pl.is_public = true and pl.deleted = false) as nplants")).
+		Columns(udb.Raw("(select count(*) from follows fo join plants pl on pl.id = fo.plantid where pl.userid = u.id and pl.is_public = true and pl.deleted = false) as nfollowers")).
+		Columns(udb.Raw("(select count(*) from follows fo where fo.userid = u.id) as nfollowing")).
+		From("users u").
+		Where("lower(replace(u.nickname, ' ', '')) = ?", nicknameHandle(p)).
+		And("u.deleted = false")
+	if err := selector.One(&user); err == udb.ErrNoMoreRows {
+		redirectOldNickname(w, r, p)
+		return
+	} else if err != nil {
+		logrus.Errorf("selector.One in fetchPublicUser %q - p: %+v", err, p)
+		apierrors.Write(w, err)
+		return
+	}
+
+	if user.Pic != nil && *user.Pic != "" {
+		expiry := time.Second * 60 * 60
+		url1, err := storage.Client.PresignedGetObject("users", *user.Pic, expiry, nil)
+		if err != nil {
+			user.Pic = nil
+			logrus.Errorf("storage.Client.PresignedGetObject in fetchPublicUser %q - p: %+v", err, p)
+		} else {
+			pic := url1.RequestURI()
+			user.Pic = &pic
+		}
+	}
+
+	var ok bool
+	if user.Plants, ok = runEmbedded(embeddedPublicUserPlants, w, r, p); !ok {
+		return
+	}
+	if user.Entries, ok = runEmbedded(embeddedPublicUserFeedEntries, w, r, p); !ok {
+		return
+	}
+
+	if err := json.NewEncoder(w).Encode(user); err != nil {
+		logrus.Errorf("json.NewEncoder in fetchPublicUser %q - %+v", err, user)
+		apierrors.Write(w, err)
+		return
+	}
+}
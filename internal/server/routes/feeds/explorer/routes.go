@@ -29,8 +29,10 @@ func Init(router *httprouter.Router) {
 	auth := cmiddlewares.AuthStack()
 	optionalAuth := cmiddlewares.OptionalAuthStack()
 
-	router.GET("/public/plants/followed", auth.Wrap(fetchLatestUpdatedFollowedPublicPlants))
-	router.GET("/public/feedEntries/followed", auth.Wrap(fetchLatestFollowedFeedEntries))
+	plantsRead := cmiddlewares.RequireScope(cmiddlewares.ScopePlantsRead)
+
+	router.GET("/public/plants/followed", auth.Wrap(plantsRead(fetchLatestUpdatedFollowedPublicPlants)))
+	router.GET("/public/feedEntries/followed", auth.Wrap(plantsRead(fetchLatestFollowedFeedEntries)))
 
 	router.GET("/public/plants", optionalAuth.Wrap(fetchLatestUpdatedPublicPlants))
 	router.GET("/public/plants/search", optionalAuth.Wrap(searchPublicPlants))
@@ -42,4 +44,7 @@ func Init(router *httprouter.Router) {
 	router.GET("/public/feedEntry/:id", optionalAuth.Wrap(fetchPublicFeedEntry))
 	router.GET("/public/feedEntry/:id/feedMedias", optionalAuth.Wrap(fetchPublicEntryFeedMedias))
 	router.GET("/public/feedMedia/:id", optionalAuth.Wrap(fetchPublicFeedMedia))
+	router.GET("/public/user/:nickname", optionalAuth.Wrap(fetchPublicUser))
+	router.GET("/public/user/:nickname/plants", optionalAuth.Wrap(fetchPublicUserPlants))
+	router.GET("/public/user/:nickname/feedEntries", optionalAuth.Wrap(fetchPublicUserFeedEntries))
 }
@@ -24,136 +24,118 @@ import (
 	"net/http"
 
 	"github.com/SuperGreenLab/AppBackend/internal/data/db"
+	"github.com/SuperGreenLab/AppBackend/internal/server/apierrors"
 	"github.com/SuperGreenLab/AppBackend/internal/server/middlewares"
 	fmiddlewares "github.com/SuperGreenLab/AppBackend/internal/server/routes/feeds/middlewares"
+	"github.com/SuperGreenLab/AppBackend/internal/server/tools"
+	"github.com/SuperGreenLab/AppBackend/internal/services/prometheus"
 	appbackend "github.com/SuperGreenLab/AppBackend/pkg"
 	"github.com/dgrijalva/jwt-go"
 	"github.com/gofrs/uuid"
 	"github.com/julienschmidt/httprouter"
 	"github.com/rileyr/middleware"
 	"github.com/sirupsen/logrus"
-	"github.com/spf13/viper"
 	udb "upper.io/db.v3"
 	"upper.io/db.v3/lib/sqlbuilder"
 )
 
-func fillUserEnd(sess sqlbuilder.Database, ueid uuid.UUID, collection string, all appbackend.Objects, factory func() db.UserEndObject) {
-	// TODO batch insert, or insert select below
-	all.Each(func(a appbackend.Object) {
-		ueo := factory()
-		ueo.SetUserEndID(ueid)
-		ueo.SetObjectID(a.GetID().UUID)
-		ueo.SetDirty(true)
-		sess.Collection(fmt.Sprintf("userend_%s", collection)).Insert(ueo)
-	})
+// userEndFill - Where selects the objects sent to a new userend, archived plants are left out
+type userEndFill struct {
+	Collection string
+	Field      string
+	Where      string
 }
 
-var createUserEndHandler = middlewares.InsertEndpoint(
-	"userends",
-	func() interface{} { return &db.UserEnd{} },
-	[]middleware.Middleware{middlewares.SetUserID},
-	[]middleware.Middleware{
-		func(fn httprouter.Handle) httprouter.Handle {
-			return func(w http.ResponseWriter, r *http.Request, p httprouter.Params) {
-				hmacSampleSecret := []byte(viper.GetString("JWTSecret"))
-				sess := r.Context().Value(middlewares.SessContextKey{}).(sqlbuilder.Database)
-				id := r.Context().Value(middlewares.InsertedIDContextKey{}).(uuid.UUID)
-				uid := r.Context().Value(middlewares.UserIDContextKey{}).(uuid.UUID)
-
-				token := jwt.NewWithClaims(jwt.SigningMethodHS256, jwt.MapClaims{
-					"userID":    uid.String(),
-					"userEndID": id.String(),
-				})
-				tokenString, err := token.SignedString(hmacSampleSecret)
-				if err != nil {
-					logrus.Errorf("token.SignedString in createUserEndHandler %q - userID: %s userEndID: %s", err, uid, id)
-					http.Error(w, err.Error(), http.StatusInternalServerError)
-					return
-				}
+var userEndFills = []userEndFill{
+	{"boxes", "boxid", "o.deleted = false"},
+	{"plants", "plantid", "o.deleted = false and o.archived = false"},
+	{"timelapses", "timelapseid", "o.deleted = false and (select archived from plants where plants.id = o.plantid) = false"},
+	{"devices", "deviceid", "o.deleted = false"},
+	// TODO replace with joins + add box archived flag management
+	{"feeds", "feedid", `o.deleted = false and (
+		not exists(select id from plants where plants.feedid = o.id) or
+		(select archived from plants where plants.feedid = o.id) = false)`},
+	{"feedentries", "feedentryid", `o.deleted = false and (
+		not exists(select id from plants where plants.feedid = o.feedid) or
+		(select archived from plants where plants.feedid = o.feedid) = false)`},
+	{"feedmedias", "feedmediaid", `o.deleted = false and (
+		not exists(select id from plants where plants.feedid = (select feedid from feedentries where o.feedentryid = feedentries.id)) or
+		(select archived from plants where plants.feedid = (select feedid from feedentries where o.feedentryid = feedentries.id)) = false)`},
+}
 
-				w.Header().Set("x-sgl-token", tokenString)
+// fillUserEnd - marks all the objects of the user as dirty for the new userend
+func fillUserEnd(sess sqlbuilder.SQLBuilder, ueid, uid uuid.UUID, f userEndFill) (int64, error) {
+	res, err := sess.Exec(fmt.Sprintf("insert into userend_%s (userendid, %s, dirty) select ?, o.id, true from %s o where o.userid = ? and %s", f.Collection, f.Field, f.Collection, f.Where), ueid, uid)
+	if err != nil {
+		return 0, err
+	}
+	return res.RowsAffected()
+}
 
-				boxes := []appbackend.Box{}
-				err = sess.Select("*").From("boxes").Where("userid = ?", uid).And("deleted = ?", false).All(&boxes)
-				if err != nil {
-					logrus.Errorf("sess.Select.From('boxes') in createUserEndHandler %q - uid: %s", err, uid)
-					http.Error(w, err.Error(), http.StatusInternalServerError)
-					return
-				}
-				fillUserEnd(sess, id, "boxes", appbackend.Boxes(boxes), func() db.UserEndObject { return &db.UserEndBox{} })
-
-				plants := []appbackend.Plant{}
-				err = sess.Select("*").From("plants").Where("userid = ?", uid).And("deleted = ?", false).And("archived = ?", false).All(&plants)
-				if err != nil {
-					logrus.Errorf("sess.Select.From('plants') in createUserEndHandler %q - uid: %s", err, uid)
-					http.Error(w, err.Error(), http.StatusInternalServerError)
-					return
-				}
-				fillUserEnd(sess, id, "plants", appbackend.Plants(plants), func() db.UserEndObject { return &db.UserEndPlant{} })
-
-				timelapses := []appbackend.Timelapse{}
-				err = sess.Select("*").From("timelapses").Where("userid = ?", uid).And("deleted = ?", false).And("(select archived from plants where plants.id = timelapses.plantid) = ?", false).All(&timelapses)
-				if err != nil {
-					logrus.Errorf("sess.Select.From('timelapses') in createUserEndHandler %q - uid: %s", err, uid)
-					http.Error(w, err.Error(), http.StatusInternalServerError)
-					return
+// createUserEndHandler - no Idempotency-Key, the response holds the tokens of the userend and is not kept in redis
+var createUserEndHandler = func() httprouter.Handle {
+	e := middlewares.NewInsertEndpointBuilder(
+		"userends",
+		func() interface{} { return &db.UserEnd{} },
+		[]middleware.Middleware{middlewares.SetUserID},
+		[]middleware.Middleware{
+			func(fn httprouter.Handle) httprouter.Handle {
+				return func(w http.ResponseWriter, r *http.Request, p httprouter.Params) {
+					sess := r.Context().Value(middlewares.SessContextKey{}).(sqlbuilder.Database)
+					id := r.Context().Value(middlewares.InsertedIDContextKey{}).(uuid.UUID)
+					uid := r.Context().Value(middlewares.UserIDContextKey{}).(uuid.UUID)
+
+					tokenString, err := tools.NewAccessToken(jwt.MapClaims{
+						"userID":    uid.String(),
+						"userEndID": id.String(),
+					})
+					if err != nil {
+						logrus.Errorf("tools.NewAccessToken in createUserEndHandler %q - userID: %s userEndID: %s", err, uid, id)
+						apierrors.Write(w, err)
+						return
+					}
+
+					refreshToken, err := tools.CreateRefreshToken(sess, uid, uuid.NullUUID{UUID: id, Valid: true})
+					if err != nil {
+						logrus.Errorf("tools.CreateRefreshToken in createUserEndHandler %q - userID: %s userEndID: %s", err, uid, id)
+						apierrors.Write(w, err)
+						return
+					}
+
+					w.Header().Set("x-sgl-token", tokenString)
+					w.Header().Set("x-sgl-refresh-token", refreshToken)
+
+					// Clients using /sync don't need the userend_* rows
+					if ue := r.Context().Value(middlewares.ObjectContextKey{}).(*db.UserEnd); ue.DeltaSync {
+						fn(w, r, p)
+						return
+					}
+
+					timer := prometheus.UserEndsProvisioningTimer("userend")
+					if err := sess.Tx(r.Context(), func(tx sqlbuilder.Tx) error {
+						for _, f := range userEndFills {
+							n, err := fillUserEnd(tx, id, uid, f)
+							if err != nil {
+								return fmt.Errorf("%s: %w", f.Collection, err)
+							}
+							prometheus.UserEndObjectsCreated(fmt.Sprintf("userend_%s", f.Collection), n)
+						}
+						return nil
+					}); err != nil {
+						logrus.Errorf("fillUserEnd in createUserEndHandler %q - uid: %s userEndID: %s", err, uid, id)
+						apierrors.Write(w, err)
+						return
+					}
+					timer.ObserveDuration()
+
+					fn(w, r, p)
 				}
-				fillUserEnd(sess, id, "timelapses", appbackend.Timelapses(timelapses), func() db.UserEndObject { return &db.UserEndTimelapse{} })
-
-				devices := []appbackend.Device{}
-				err = sess.Select("*").From("devices").Where("userid = ?", uid).And("deleted = ?", false).All(&devices)
-				if err != nil {
-					logrus.Errorf("sess.Select.From('devices') in createUserEndHandler %q - uid: %s", err, uid)
-					http.Error(w, err.Error(), http.StatusInternalServerError)
-					return
-				}
-				fillUserEnd(sess, id, "devices", appbackend.Devices(devices), func() db.UserEndObject { return &db.UserEndDevice{} })
-
-				// TODO replace with joins + add box archived flag management
-				feeds := []appbackend.Feed{}
-				err = sess.Select("*").From("feeds").Where("userid = ?", uid).And("deleted = ?", false).And(
-					udb.Or(
-						udb.Raw("not exists(select id from plants where plants.feedid = feeds.id)"),
-						udb.Raw("(select archived from plants where plants.feedid = feeds.id) = ?", false)),
-				).All(&feeds)
-				if err != nil {
-					logrus.Errorf("sess.Select.From('feeds') in createUserEndHandler %q - uid: %s", err, uid)
-					http.Error(w, err.Error(), http.StatusInternalServerError)
-					return
-				}
-				fillUserEnd(sess, id, "feeds", appbackend.Feeds(feeds), func() db.UserEndObject { return &db.UserEndFeed{} })
-
-				feedEntries := []appbackend.FeedEntry{}
-				err = sess.Select("*").From("feedentries").Where("userid = ?", uid).And("deleted = ?", false).And(
-					udb.Or(
-						udb.Raw("not exists(select id from plants where plants.feedid = feedentries.feedid)"),
-						udb.Raw("(select archived from plants where plants.feedid = feedentries.feedid) = ?", false)),
-				).All(&feedEntries)
-				if err != nil {
-					logrus.Errorf("sess.Select.From('feedentries') in createUserEndHandler %q - uid: %s", err, uid)
-					http.Error(w, err.Error(), http.StatusInternalServerError)
-					return
-				}
-				fillUserEnd(sess, id, "feedentries", appbackend.FeedEntries(feedEntries), func() db.UserEndObject { return &db.UserEndFeedEntry{} })
-
-				feedMedias := []appbackend.FeedMedia{}
-				err = sess.Select("*").From("feedmedias").Where("userid = ?", uid).And("deleted = ?", false).And(
-					udb.Or(
-						udb.Raw("not exists(select id from plants where plants.feedid = (select feedid from feedentries where feedmedias.feedentryid = feedentries.id))"),
-						udb.Raw("(select archived from plants where plants.feedid = (select feedid from feedentries where feedmedias.feedentryid = feedentries.id)) = ?", false)),
-				).All(&feedMedias)
-				if err != nil {
-					logrus.Errorf("sess.Select.From('feedmedias') in createUserEndHandler %q - uid: %s", err, uid)
-					http.Error(w, err.Error(), http.StatusInternalServerError)
-					return
-				}
-				fillUserEnd(sess, id, "feedmedias", appbackend.FeedMedias(feedMedias), func() db.UserEndObject { return &db.UserEndFeedMedia{} })
-
-				fn(w, r, p)
-			}
+			},
 		},
-	},
-)
+	)
+	e.Idempotent = false
+	return e.Endpoint().Handle()
+}()
 
 var createBoxHandler = middlewares.InsertEndpoint(
 	"boxes",
@@ -163,7 +145,7 @@ var createBoxHandler = middlewares.InsertEndpoint(
 		middlewares.CheckAccessRight("devices", "DeviceID", true, func() appbackend.UserObject { return &appbackend.Device{} }),
 	},
 	[]middleware.Middleware{
-		fmiddlewares.CreateUserEndObjects("userend_boxes", func() db.UserEndObject { return &db.UserEndBox{} }),
+		fmiddlewares.CreateUserEndObjects("userend_boxes", "boxid"),
 	},
 )
 
@@ -175,7 +157,7 @@ var createPlantHandler = middlewares.InsertEndpoint(
 		middlewares.CheckAccessRight("boxes", "BoxID", false, func() appbackend.UserObject { return &appbackend.Box{} }),
 	},
 	[]middleware.Middleware{
-		fmiddlewares.CreateUserEndObjects("userend_plants", func() db.UserEndObject { return &db.UserEndPlant{} }),
+		fmiddlewares.CreateUserEndObjects("userend_plants", "plantid"),
 	},
 )
 
@@ -188,7 +170,7 @@ var createTimelapseHandler = middlewares.InsertEndpoint(
 	},
 	[]middleware.Middleware{
 		fmiddlewares.CheckPlantArchivedForTimelapse,
-		fmiddlewares.CreateUserEndObjects("userend_timelapses", func() db.UserEndObject { return &db.UserEndTimelapse{} }),
+		fmiddlewares.CreateUserEndObjects("userend_timelapses", "timelapseid"),
 	},
 )
 
@@ -207,7 +189,7 @@ var createDeviceHandler = middlewares.InsertEndpoint(
 	func() interface{} { return &appbackend.Device{} },
 	[]middleware.Middleware{middlewares.SetUserID},
 	[]middleware.Middleware{
-		fmiddlewares.CreateUserEndObjects("userend_devices", func() db.UserEndObject { return &db.UserEndDevice{} }),
+		fmiddlewares.CreateUserEndObjects("userend_devices", "deviceid"),
 	},
 )
 
@@ -217,7 +199,7 @@ var createFeedHandler = middlewares.InsertEndpoint(
 	[]middleware.Middleware{middlewares.SetUserID},
 	[]middleware.Middleware{
 		fmiddlewares.CheckPlantArchivedForFeed,
-		fmiddlewares.CreateUserEndObjects("userend_feeds", func() db.UserEndObject { return &db.UserEndFeed{} }),
+		fmiddlewares.CreateUserEndObjects("userend_feeds", "feedid"),
 	},
 )
 
@@ -230,7 +212,7 @@ var createFeedEntryHandler = middlewares.InsertEndpoint(
 	},
 	[]middleware.Middleware{
 		fmiddlewares.CheckPlantArchivedForFeedEntry,
-		fmiddlewares.CreateUserEndObjects("userend_feedentries", func() db.UserEndObject { return &db.UserEndFeedEntry{} }),
+		fmiddlewares.CreateUserEndObjects("userend_feedentries", "feedentryid"),
 	},
 )
 
@@ -243,7 +225,7 @@ var createFeedMediaHandler = middlewares.InsertEndpoint(
 	},
 	[]middleware.Middleware{
 		fmiddlewares.CheckPlantArchivedForFeedMedia,
-		fmiddlewares.CreateUserEndObjects("userend_feedmedias", func() db.UserEndObject { return &db.UserEndFeedMedia{} }),
+		fmiddlewares.CreateUserEndObjects("userend_feedmedias", "feedmediaid"),
 	},
 )
 
@@ -278,7 +260,7 @@ func deleteLikeIfExists(fn httprouter.Handle) httprouter.Handle {
 			err := sess.Collection("likes").Find().Where("id = ?", like.ID).Delete()
 			if err != nil {
 				logrus.Errorf("sess.Collection('likes') in deleteLikeIfExists %q %+v", err, like)
-				http.Error(w, err.Error(), http.StatusInternalServerError)
+				apierrors.Write(w, err)
 				return
 			}
 			ctx := context.WithValue(r.Context(), middlewares.ObjectContextKey{}, like)
@@ -342,7 +324,7 @@ func deleteBookmarkIfExists(fn httprouter.Handle) httprouter.Handle {
 			err := sess.Collection("bookmarks").Find().Where("id = ?", bookmark.ID).Delete()
 			if err != nil {
 				logrus.Errorf("sess.Collection('bookmarks') in deleteBookmarkIfExists %q - %+v", err, bookmark)
-				http.Error(w, err.Error(), http.StatusInternalServerError)
+				apierrors.Write(w, err)
 				return
 			}
 			ctx := context.WithValue(r.Context(), middlewares.ObjectContextKey{}, bookmark)
@@ -377,7 +359,7 @@ func deleteFollowIfExists(fn httprouter.Handle) httprouter.Handle {
 			err := sess.Collection("follows").Find().Where("id = ?", follow.ID).Delete()
 			if err != nil {
 				logrus.Errorf("sess.Collection('follows') in deleteFollowIfExists %q %+v", err, follow)
-				http.Error(w, err.Error(), http.StatusInternalServerError)
+				apierrors.Write(w, err)
 				return
 			}
 			ctx := context.WithValue(r.Context(), middlewares.ObjectContextKey{}, follow)
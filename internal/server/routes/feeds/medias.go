@@ -25,6 +25,7 @@ import (
 	"strings"
 	"time"
 
+	"github.com/SuperGreenLab/AppBackend/internal/server/apierrors"
 	"github.com/gofrs/uuid"
 
 	"github.com/sirupsen/logrus"
@@ -48,7 +49,7 @@ func feedMediaUploadURLHandler(w http.ResponseWriter, r *http.Request, p httprou
 	fmup := feedMediaUploadURLParams{}
 	if err := tools.DecodeJSONBody(w, r, &fmup); err != nil {
 		logrus.Errorf("tools.DecodeJSONBody in feedMediaUploadURLHandler %q", err)
-		http.Error(w, err.Error(), http.StatusInternalServerError)
+		apierrors.Write(w, err)
 		return
 	}
 
@@ -59,7 +60,7 @@ func feedMediaUploadURLHandler(w http.ResponseWriter, r *http.Request, p httprou
 		path = fmt.Sprintf("pictures-%s.jpg", uuid.Must(uuid.NewV4()).String())
 	} else {
 		logrus.Errorf("Unknown file type %s", fmup.FileName)
-		http.Error(w, "Unknown file type", http.StatusBadRequest)
+		apierrors.Write(w, apierrors.BadRequest("Unknown file type"))
 		return
 	}
 
@@ -69,7 +70,7 @@ func feedMediaUploadURLHandler(w http.ResponseWriter, r *http.Request, p httprou
 	url1, err := storage.Client.PresignedPutObject("feedmedias", path, expiry)
 	if err != nil {
 		logrus.Errorf("minioClient.PresignedPutObject in feedMediaUploadURLHandler %q - %s", err, path)
-		http.Error(w, err.Error(), http.StatusInternalServerError)
+		apierrors.Write(w, err)
 		return
 	}
 	res.FilePath = url1.RequestURI()
@@ -78,14 +79,14 @@ func feedMediaUploadURLHandler(w http.ResponseWriter, r *http.Request, p httprou
 	url2, err := storage.Client.PresignedPutObject("feedmedias", path, expiry)
 	if err != nil {
 		logrus.Errorf("minioClient.PresignedPutObject in feedMediaUploadURLHandler %q - %s", err, path)
-		http.Error(w, err.Error(), http.StatusInternalServerError)
+		apierrors.Write(w, err)
 		return
 	}
 	res.ThumbnailPath = url2.RequestURI()
 
 	if err := json.NewEncoder(w).Encode(res); err != nil {
 		logrus.Errorf("json.NewEncoder in feedMediaUploadURLHandler %q", err)
-		http.Error(w, err.Error(), http.StatusInternalServerError)
+		apierrors.Write(w, err)
 		return
 	}
 }
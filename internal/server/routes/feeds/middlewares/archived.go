@@ -21,6 +21,7 @@ package middlewares
 import (
 	"net/http"
 
+	"github.com/SuperGreenLab/AppBackend/internal/server/apierrors"
 	"github.com/SuperGreenLab/AppBackend/internal/server/middlewares"
 	appbackend "github.com/SuperGreenLab/AppBackend/pkg"
 	"github.com/julienschmidt/httprouter"
@@ -35,7 +36,7 @@ func CheckPlantArchivedForPlant(fn httprouter.Handle) httprouter.Handle {
 		plant := appbackend.Plant{}
 		if err := sess.Select("archived").From("plants").Where("id = ?", o.ID).One(&plant); err != nil {
 			logrus.Errorf("sess.Select in CheckPlantArchivedForPlant %q - %+v", err, o)
-			http.Error(w, "Uknown plant", http.StatusBadRequest)
+			apierrors.Write(w, apierrors.NotFound("Unknown plant"))
 			return
 		}
 		if plant.Archived == false {
@@ -51,7 +52,7 @@ func CheckPlantArchivedForTimelapse(fn httprouter.Handle) httprouter.Handle {
 		plant := appbackend.Plant{}
 		if err := sess.Select("archived").From("plants").Where("id = ?", o.PlantID).One(&plant); err != nil {
 			logrus.Errorf("sess.Select in CheckPlantArchivedForTimelapse %q - %+v", err, o)
-			http.Error(w, "Uknown plant", http.StatusBadRequest)
+			apierrors.Write(w, apierrors.NotFound("Unknown plant"))
 			return
 		}
 		if plant.Archived == false {
@@ -67,7 +68,7 @@ func CheckPlantArchivedForFeed(fn httprouter.Handle) httprouter.Handle {
 		plant := appbackend.Plant{}
 		if err := sess.Select("archived").From("plants").Where("feedid = ?", o.ID).One(&plant); err != nil && err.Error() != "upper: no more rows in this result set" {
 			logrus.Errorf("sess.Select in CheckPlantArchivedForFeed %q - %+v", err, o)
-			http.Error(w, "Uknown plant", http.StatusBadRequest)
+			apierrors.Write(w, apierrors.NotFound("Unknown plant"))
 			return
 		}
 		if plant.Archived == false {
@@ -83,7 +84,7 @@ func CheckPlantArchivedForFeedEntry(fn httprouter.Handle) httprouter.Handle {
 		plant := appbackend.Plant{}
 		if err := sess.Select("archived").From("plants").Join("feedentries").On("plants.feedid = feedentries.feedid").Where("feedentries.id = ?", o.ID).One(&plant); err != nil && err.Error() != "upper: no more rows in this result set" {
 			logrus.Errorf("sess.Select in CheckPlantArchivedForFeedEntry %q - %+v", err, o)
-			http.Error(w, "Uknown plant", http.StatusBadRequest)
+			apierrors.Write(w, apierrors.NotFound("Unknown plant"))
 			return
 		}
 		if plant.Archived == false {
@@ -99,7 +100,7 @@ func CheckPlantArchivedForFeedMedia(fn httprouter.Handle) httprouter.Handle {
 		plant := appbackend.Plant{}
 		if err := sess.Select("archived").From("plants").Join("feedentries").On("plants.feedid = feedentries.feedid").Join("feedmedias").On("feedmedias.feedentryid = feedentries.id").Where("feedmedias.id = ?", o.ID).One(&plant); err != nil && err.Error() != "upper: no more rows in this result set" {
 			logrus.Errorf("sess.Select in CheckPlantArchivedForFeedMedia %q - %+v", err, o)
-			http.Error(w, "Uknown plant", http.StatusBadRequest)
+			apierrors.Write(w, apierrors.NotFound("Unknown plant"))
 			return
 		}
 		if plant.Archived == false {
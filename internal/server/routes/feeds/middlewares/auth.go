@@ -28,6 +28,8 @@ import (
 	"github.com/dgrijalva/jwt-go"
 	"github.com/julienschmidt/httprouter"
 	"github.com/rileyr/middleware"
+	"github.com/sirupsen/logrus"
+	"upper.io/db.v3/lib/sqlbuilder"
 )
 
 // AuthStackWithUserEnd - Adds userEndID from JWT claim, sets it as required
@@ -35,6 +37,7 @@ func AuthStackWithUserEnd() middleware.Stack {
 	auth := cmiddlewares.AuthStack()
 	auth.Use(JwtTokenUserEndID)
 	auth.Use(UserEndIDRequired)
+	auth.Use(TouchUserEnd)
 	return auth
 }
 
@@ -42,6 +45,7 @@ func AuthStackWithUserEnd() middleware.Stack {
 func AuthStackWithOptUserEnd() middleware.Stack {
 	auth := cmiddlewares.AuthStack()
 	auth.Use(JwtTokenUserEndID)
+	auth.Use(TouchUserEnd)
 	return auth
 }
 
@@ -60,3 +64,22 @@ func JwtTokenUserEndID(fn httprouter.Handle) httprouter.Handle {
 		}
 	}
 }
+
+// TouchUserEnd - keeps track of the userend's last activity, revoked userends are already rejected by JwtToken
+func TouchUserEnd(fn httprouter.Handle) httprouter.Handle {
+	return func(w http.ResponseWriter, r *http.Request, p httprouter.Params) {
+		ueid, ok := r.Context().Value(UserEndIDContextKey{}).(uuid.UUID)
+		if !ok {
+			fn(w, r, p)
+			return
+		}
+		sess := r.Context().Value(cmiddlewares.SessContextKey{}).(sqlbuilder.Database)
+
+		// Only write once in a while, this runs on every sync request
+		if _, err := sess.Update("userends").Set("lastseen = now()").Where("id = ?", ueid).And("(lastseen is null or lastseen < now() - interval '5 minutes')").Exec(); err != nil {
+			logrus.Errorf("sess.Update in TouchUserEnd %q - ueid: %s", err, ueid)
+		}
+
+		fn(w, r, p)
+	}
+}
@@ -3,6 +3,7 @@ package middlewares
 import (
 	"net/http"
 
+	"github.com/SuperGreenLab/AppBackend/internal/server/apierrors"
 	"github.com/julienschmidt/httprouter"
 	"github.com/sirupsen/logrus"
 )
@@ -13,7 +14,7 @@ func UserEndIDRequired(fn httprouter.Handle) httprouter.Handle {
 		ueid := r.Context().Value(UserEndIDContextKey{})
 		if ueid == nil {
 			logrus.Errorln("Missing userEndID")
-			http.Error(w, "Missing userEndID", http.StatusBadRequest)
+			apierrors.Write(w, apierrors.BadRequest("Missing userEndID"))
 			return
 		}
 		fn(w, r, p)
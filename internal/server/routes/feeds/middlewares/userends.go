@@ -19,10 +19,15 @@
 package middlewares
 
 import (
+	"fmt"
 	"net/http"
+	"strings"
 
 	"github.com/SuperGreenLab/AppBackend/internal/data/db"
+	"github.com/SuperGreenLab/AppBackend/internal/server/apierrors"
 	cmiddlewares "github.com/SuperGreenLab/AppBackend/internal/server/middlewares"
+	"github.com/SuperGreenLab/AppBackend/internal/services/prometheus"
+	"github.com/SuperGreenLab/AppBackend/internal/services/pubsub"
 	"github.com/gofrs/uuid"
 	"github.com/julienschmidt/httprouter"
 	"github.com/rileyr/middleware"
@@ -30,8 +35,8 @@ import (
 	"upper.io/db.v3/lib/sqlbuilder"
 )
 
-// CreateUserEndObjects - creates the UserEnd object associated with the inserted object
-func CreateUserEndObjects(collection string, factory func() db.UserEndObject) middleware.Middleware {
+// CreateUserEndObjects - creates the UserEnd objects associated with the inserted object, in a single insert select
+func CreateUserEndObjects(collection, field string) middleware.Middleware {
 	return func(fn httprouter.Handle) httprouter.Handle {
 		return func(w http.ResponseWriter, r *http.Request, p httprouter.Params) {
 			sess := r.Context().Value(cmiddlewares.SessContextKey{}).(sqlbuilder.Database)
@@ -40,25 +45,23 @@ func CreateUserEndObjects(collection string, factory func() db.UserEndObject) mi
 
 			id := r.Context().Value(cmiddlewares.InsertedIDContextKey{}).(uuid.UUID)
 
-			uends := []db.UserEnd{}
-			err := sess.Collection("userends").Find("userid", uid).All(&uends)
+			// the userend that sent the object already has it
+			sender := uuid.Nil
+			if ueidOK {
+				sender = ueid
+			}
+			timer := prometheus.UserEndsProvisioningTimer("object")
+			res, err := sess.Exec(fmt.Sprintf("insert into %s (userendid, %s, sent, dirty) select id, ?, id = ?, id != ? from userends where id in (%s)", collection, field, db.LegacySyncUserEnds), id, sender, sender, uid)
 			if err != nil {
-				logrus.Errorln(err.Error())
-				http.Error(w, err.Error(), http.StatusInternalServerError)
+				logrus.Errorf("sess.Exec in CreateUserEndObjects %q - collection: %s id: %s uid: %s", err, collection, id, uid)
+				apierrors.Write(w, err)
 				return
 			}
-
-			for _, uend := range uends {
-				ueo := factory()
-				ueo.SetObjectID(id)
-				ueo.SetUserEndID(uend.ID.UUID)
-				if ueidOK && uend.ID.UUID == ueid {
-					ueo.SetSent(true)
-				} else {
-					ueo.SetDirty(true)
-				}
-				sess.Collection(collection).Insert(ueo)
+			timer.ObserveDuration()
+			if n, err := res.RowsAffected(); err == nil {
+				prometheus.UserEndObjectsCreated(collection, n)
 			}
+			NotifyUserEnds(r, uid, ueid, ueidOK, collection, id)
 
 			fn(w, r, p)
 		}
@@ -79,14 +82,30 @@ func UpdateUserEndObjects(collection, field string) middleware.Middleware {
 			if ueidOK {
 				selector = selector.And("userendid != ?", ueid)
 			}
-			_, err := selector.And("userendid in (select id from userends where userid = ?)", uid).Exec()
+			_, err := selector.And("userendid in ("+db.LegacySyncUserEnds+")", uid).Exec()
 			if err != nil {
 				logrus.Errorln(err.Error())
-				http.Error(w, err.Error(), http.StatusInternalServerError)
+				apierrors.Write(w, err)
 				return
 			}
+			NotifyUserEnds(r, uid, ueid, ueidOK, collection, id)
 
 			fn(w, r, p)
 		}
 	}
 }
+
+// NotifyUserEnds - tells the connected userends of the user that they have objects to sync, failures are only logged
+func NotifyUserEnds(r *http.Request, uid, ueid uuid.UUID, ueidOK bool, collection string, ids ...uuid.UUID) {
+	msg := pubsub.UserEndsDirty{
+		UserID:     uid,
+		UserEndID:  uuid.NullUUID{UUID: ueid, Valid: ueidOK},
+		Collection: strings.TrimPrefix(collection, "userend_"),
+		IDs:        ids,
+	}
+	cmiddlewares.AfterCommit(r, func() {
+		if err := pubsub.PublishUserEndsDirty(msg); err != nil {
+			logrus.Errorf("pubsub.PublishUserEndsDirty in NotifyUserEnds %q - %+v", err, msg)
+		}
+	})
+}
@@ -33,80 +33,105 @@ func Init(router *httprouter.Router) {
 	authWithUserEndID := fmiddlewares.AuthStackWithUserEnd()
 	authWithOptUserEndID := fmiddlewares.AuthStackWithOptUserEnd()
 
-	router.POST("/userend", auth.Wrap(createUserEndHandler))
-	router.POST("/plantsharing", auth.Wrap(createPlantSharingHandler))
-
-	router.POST("/box", authWithOptUserEndID.Wrap(createBoxHandler))
-	router.POST("/plant", authWithOptUserEndID.Wrap(createPlantHandler))
-	router.POST("/timelapse", authWithOptUserEndID.Wrap(createTimelapseHandler))
-	router.POST("/timelapseframe", auth.Wrap(createTimelapseFrameHandler))
-	router.POST("/device", authWithOptUserEndID.Wrap(createDeviceHandler))
-	router.POST("/feed", authWithOptUserEndID.Wrap(createFeedHandler))
-	router.POST("/feedEntry", authWithOptUserEndID.Wrap(createFeedEntryHandler))
-	router.POST("/feedMedia", authWithOptUserEndID.Wrap(createFeedMediaHandler))
-	router.POST("/comment", auth.Wrap(createCommentHandler))
-	router.POST("/like", auth.Wrap(createLikeHandler))
-	router.POST("/report", auth.Wrap(createReportHandler))
-	router.POST("/bookmark", auth.Wrap(createBookmarkHandler))
-	router.POST("/follow", auth.Wrap(createFollowHandler))
-	router.POST("/linkbookmark", auth.Wrap(createLinkBookmarkHandler))
-
-	router.PUT("/box", authWithOptUserEndID.Wrap(updateBoxHandler))
-	router.PUT("/plant", authWithOptUserEndID.Wrap(updatePlantHandler))
-	router.PUT("/timelapse", authWithOptUserEndID.Wrap(updateTimelapseHandler))
-	router.PUT("/device", authWithOptUserEndID.Wrap(updateDeviceHandler))
-	router.PUT("/feed", authWithOptUserEndID.Wrap(updateFeedHandler))
-	router.PUT("/feedEntry", authWithOptUserEndID.Wrap(updateFeedEntryHandler))
-	router.PUT("/feedMedia", authWithOptUserEndID.Wrap(updateFeedMediaHandler))
-	router.PUT("/userend", authWithUserEndID.Wrap(updateUserEndHandler))
-
-	router.POST("/deletes", authWithOptUserEndID.Wrap(deletesHandler))
-
-	router.POST("/feedMediaUploadURL", auth.Wrap(feedMediaUploadURLHandler))
-	router.POST("/timelapseUploadURL", auth.Wrap(timelapseUploadURLHandler))
-
-	router.POST("/sgloverlay", auth.Wrap(sglOverlayHandler))
-
-	router.GET("/syncBoxes", authWithUserEndID.Wrap(syncBoxesHandler))
-	router.GET("/syncPlants", authWithUserEndID.Wrap(syncPlantsHandler))
-	router.GET("/syncTimelapses", authWithUserEndID.Wrap(syncTimelapsesHandler))
-	router.GET("/syncDevices", authWithUserEndID.Wrap(syncDevicesHandler))
-	router.GET("/syncFeeds", authWithUserEndID.Wrap(syncFeedsHandler))
-	router.GET("/syncFeedEntries", authWithUserEndID.Wrap(syncFeedEntriesHandler))
-	router.GET("/syncFeedMedias", authWithUserEndID.Wrap(syncFeedMediasHandler))
-
-	router.POST("/box/:id/sync", authWithUserEndID.Wrap(syncedBoxHandler))
-	router.POST("/plant/:id/sync", authWithUserEndID.Wrap(syncedPlantHandler))
-	router.POST("/timelapse/:id/sync", authWithUserEndID.Wrap(syncedTimelapseHandler))
-	router.POST("/device/:id/sync", authWithUserEndID.Wrap(syncedDeviceHandler))
-	router.POST("/feed/:id/sync", authWithUserEndID.Wrap(syncedFeedHandler))
-	router.POST("/feedEntry/:id/sync", authWithUserEndID.Wrap(syncedFeedEntryHandler))
-	router.POST("/feedMedia/:id/sync", authWithUserEndID.Wrap(syncedFeedMediaHandler))
-
-	router.POST("/plant/:id/archive", authWithUserEndID.Wrap(archivePlantHandler))
-
-	router.GET("/plants", auth.Wrap(selectPlants))
-	router.GET("/plant/:id", auth.Wrap(selectPlant))
-	router.GET("/feedEntries", auth.Wrap(selectFeedEntries))
-	router.GET("/feedEntry/:id", auth.Wrap(selectFeedEntry))
+	plantsRead := cmiddlewares.RequireScope(cmiddlewares.ScopePlantsRead)
+	plantsWrite := cmiddlewares.RequireScope(cmiddlewares.ScopePlantsWrite)
+	feedEntriesWrite := cmiddlewares.RequireScope(cmiddlewares.ScopeFeedEntriesWrite)
+	socialWrite := cmiddlewares.RequireScope(cmiddlewares.ScopeSocialWrite)
+	metricsRead := cmiddlewares.RequireScope(cmiddlewares.ScopeMetricsRead)
+	account := cmiddlewares.RequireScope(cmiddlewares.ScopeAccount)
+
+	router.POST("/userend", auth.Wrap(account(createUserEndHandler)))
+	router.POST("/plantsharing", auth.Wrap(plantsWrite(createPlantSharingHandler)))
+
+	router.POST("/box", authWithOptUserEndID.Wrap(plantsWrite(createBoxHandler)))
+	router.POST("/plant", authWithOptUserEndID.Wrap(plantsWrite(createPlantHandler)))
+	router.POST("/timelapse", authWithOptUserEndID.Wrap(plantsWrite(createTimelapseHandler)))
+	router.POST("/timelapseframe", auth.Wrap(plantsWrite(createTimelapseFrameHandler)))
+	router.POST("/device", authWithOptUserEndID.Wrap(plantsWrite(createDeviceHandler)))
+	router.POST("/feed", authWithOptUserEndID.Wrap(plantsWrite(createFeedHandler)))
+	router.POST("/feedEntry", authWithOptUserEndID.Wrap(feedEntriesWrite(createFeedEntryHandler)))
+	router.POST("/feedMedia", authWithOptUserEndID.Wrap(feedEntriesWrite(createFeedMediaHandler)))
+	router.POST("/comment", auth.Wrap(socialWrite(createCommentHandler)))
+	router.POST("/like", auth.Wrap(socialWrite(createLikeHandler)))
+	router.POST("/report", auth.Wrap(socialWrite(createReportHandler)))
+	router.POST("/bookmark", auth.Wrap(socialWrite(createBookmarkHandler)))
+	router.POST("/follow", auth.Wrap(socialWrite(createFollowHandler)))
+	router.POST("/linkbookmark", auth.Wrap(socialWrite(createLinkBookmarkHandler)))
+
+	router.PUT("/box", authWithOptUserEndID.Wrap(plantsWrite(updateBoxHandler)))
+	router.PUT("/plant", authWithOptUserEndID.Wrap(plantsWrite(updatePlantHandler)))
+	router.PUT("/timelapse", authWithOptUserEndID.Wrap(plantsWrite(updateTimelapseHandler)))
+	router.PUT("/device", authWithOptUserEndID.Wrap(plantsWrite(updateDeviceHandler)))
+	router.PUT("/feed", authWithOptUserEndID.Wrap(plantsWrite(updateFeedHandler)))
+	router.PUT("/feedEntry", authWithOptUserEndID.Wrap(feedEntriesWrite(updateFeedEntryHandler)))
+	router.PUT("/feedMedia", authWithOptUserEndID.Wrap(feedEntriesWrite(updateFeedMediaHandler)))
+	router.PUT("/userend", authWithUserEndID.Wrap(account(updateUserEndHandler)))
+
+	router.POST("/deletes", authWithOptUserEndID.Wrap(plantsWrite(cmiddlewares.Transaction(deletesHandler))))
+
+	batchDelete := plantsWrite(deletesHandler)
+	router.POST("/batch", authWithOptUserEndID.Wrap(batchHandler(map[string]batchType{
+		"box":       {Insert: plantsWrite(createBoxHandler), Update: plantsWrite(updateBoxHandler), Delete: batchDelete, Collection: "boxes"},
+		"plant":     {Insert: plantsWrite(createPlantHandler), Update: plantsWrite(updatePlantHandler), Delete: batchDelete, Collection: "plants"},
+		"timelapse": {Insert: plantsWrite(createTimelapseHandler), Update: plantsWrite(updateTimelapseHandler), Delete: batchDelete, Collection: "timelapses"},
+		"device":    {Insert: plantsWrite(createDeviceHandler), Update: plantsWrite(updateDeviceHandler), Delete: batchDelete, Collection: "devices"},
+		"feed":      {Insert: plantsWrite(createFeedHandler), Update: plantsWrite(updateFeedHandler), Delete: batchDelete, Collection: "feeds"},
+		"feedEntry": {Insert: feedEntriesWrite(createFeedEntryHandler), Update: feedEntriesWrite(updateFeedEntryHandler), Delete: batchDelete, Collection: "feedentries"},
+		"feedMedia": {Insert: feedEntriesWrite(createFeedMediaHandler), Update: feedEntriesWrite(updateFeedMediaHandler), Delete: batchDelete, Collection: "feedmedias"},
+	})))
+
+	router.GET("/trash", auth.Wrap(plantsRead(trashHandler)))
+	router.POST("/trash/restore", authWithOptUserEndID.Wrap(plantsWrite(cmiddlewares.Transaction(restoreHandler()))))
+
+	router.POST("/feedMediaUploadURL", auth.Wrap(feedEntriesWrite(feedMediaUploadURLHandler)))
+	router.POST("/timelapseUploadURL", auth.Wrap(plantsWrite(timelapseUploadURLHandler)))
+
+	router.POST("/sgloverlay", auth.Wrap(feedEntriesWrite(sglOverlayHandler)))
+
+	router.GET("/sync", authWithUserEndID.Wrap(plantsRead(deltaSyncHandler())))
+	router.POST("/sync/ack", authWithUserEndID.Wrap(plantsRead(syncAckHandler())))
+	router.GET("/userend/events", authWithUserEndID.Wrap(plantsRead(userEndEventsHandler)))
+
+	router.GET("/syncBoxes", authWithUserEndID.Wrap(plantsRead(syncBoxesHandler)))
+	router.GET("/syncPlants", authWithUserEndID.Wrap(plantsRead(syncPlantsHandler)))
+	router.GET("/syncTimelapses", authWithUserEndID.Wrap(plantsRead(syncTimelapsesHandler)))
+	router.GET("/syncDevices", authWithUserEndID.Wrap(plantsRead(syncDevicesHandler)))
+	router.GET("/syncFeeds", authWithUserEndID.Wrap(plantsRead(syncFeedsHandler)))
+	router.GET("/syncFeedEntries", authWithUserEndID.Wrap(plantsRead(syncFeedEntriesHandler)))
+	router.GET("/syncFeedMedias", authWithUserEndID.Wrap(plantsRead(syncFeedMediasHandler)))
+
+	router.POST("/box/:id/sync", authWithUserEndID.Wrap(plantsRead(syncedBoxHandler)))
+	router.POST("/plant/:id/sync", authWithUserEndID.Wrap(plantsRead(syncedPlantHandler)))
+	router.POST("/timelapse/:id/sync", authWithUserEndID.Wrap(plantsRead(syncedTimelapseHandler)))
+	router.POST("/device/:id/sync", authWithUserEndID.Wrap(plantsRead(syncedDeviceHandler)))
+	router.POST("/feed/:id/sync", authWithUserEndID.Wrap(plantsRead(syncedFeedHandler)))
+	router.POST("/feedEntry/:id/sync", authWithUserEndID.Wrap(plantsRead(syncedFeedEntryHandler)))
+	router.POST("/feedMedia/:id/sync", authWithUserEndID.Wrap(plantsRead(syncedFeedMediaHandler)))
+
+	router.POST("/plant/:id/archive", authWithUserEndID.Wrap(plantsWrite(cmiddlewares.Transaction(archivePlantHandler))))
+
+	router.GET("/plants", auth.Wrap(plantsRead(selectPlants)))
+	router.GET("/plant/:id", auth.Wrap(plantsRead(selectPlant)))
+	router.GET("/feedEntries", auth.Wrap(plantsRead(selectFeedEntries)))
+	router.GET("/feedEntry/:id", auth.Wrap(plantsRead(selectFeedEntry)))
 	router.GET("/feedEntry/:id/comments", optionalAuth.Wrap(selectFeedEntryComments))
 	router.GET("/feedEntry/:id/comments/count", optionalAuth.Wrap(countFeedEntryComments))
 	router.GET("/feedEntry/:id/social", optionalAuth.Wrap(selectFeedEntrySocial))
 	router.GET("/comment/:id", optionalAuth.Wrap(selectComment))
-	router.GET("/feedMedias", auth.Wrap(selectFeedMedias))
-	router.GET("/feedMedia/:id", auth.Wrap(selectFeedMedia))
-	router.GET("/feeds", auth.Wrap(selectFeeds))
-	router.GET("/feed/:id", auth.Wrap(selectFeed))
-	router.GET("/boxes", auth.Wrap(selectBoxes))
-	router.GET("/box/:id", auth.Wrap(selectBox))
-	router.GET("/devices", auth.Wrap(selectDevices))
-	router.GET("/device/:id", auth.Wrap(selectDevice))
-	router.GET("/device/:id/params", auth.Wrap(selectDeviceParams))
-	router.GET("/bookmarks", auth.Wrap(selectBookmarks))
-	router.GET("/bookmark/:id", auth.Wrap(selectBookmark))
-	router.GET("/timelapses", auth.Wrap(selectTimelapses))
-	router.GET("/timelapse/:id", auth.Wrap(selectTimelapse))
-	router.GET("/timelapse/:id/latest", auth.Wrap(timelapseLatestPic))
+	router.GET("/feedMedias", auth.Wrap(plantsRead(selectFeedMedias)))
+	router.GET("/feedMedia/:id", auth.Wrap(plantsRead(selectFeedMedia)))
+	router.GET("/feeds", auth.Wrap(plantsRead(selectFeeds)))
+	router.GET("/feed/:id", auth.Wrap(plantsRead(selectFeed)))
+	router.GET("/boxes", auth.Wrap(plantsRead(selectBoxes)))
+	router.GET("/box/:id", auth.Wrap(plantsRead(selectBox)))
+	router.GET("/devices", auth.Wrap(plantsRead(selectDevices)))
+	router.GET("/device/:id", auth.Wrap(plantsRead(selectDevice)))
+	router.GET("/device/:id/params", auth.Wrap(metricsRead(selectDeviceParams)))
+	router.GET("/bookmarks", auth.Wrap(plantsRead(selectBookmarks)))
+	router.GET("/bookmark/:id", auth.Wrap(plantsRead(selectBookmark)))
+	router.GET("/timelapses", auth.Wrap(plantsRead(selectTimelapses)))
+	router.GET("/timelapse/:id", auth.Wrap(plantsRead(selectTimelapse)))
+	router.GET("/timelapse/:id/latest", auth.Wrap(metricsRead(timelapseLatestPic)))
 
 	explorer.Init(router)
 }
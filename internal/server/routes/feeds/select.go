@@ -27,6 +27,7 @@ import (
 	"github.com/SuperGreenLab/AppBackend/internal/data/db"
 	"github.com/SuperGreenLab/AppBackend/internal/data/kv"
 	"github.com/SuperGreenLab/AppBackend/internal/data/storage"
+	"github.com/SuperGreenLab/AppBackend/internal/server/apierrors"
 	"github.com/SuperGreenLab/AppBackend/internal/server/middlewares"
 	appbackend "github.com/SuperGreenLab/AppBackend/pkg"
 	"github.com/gofrs/uuid"
@@ -65,15 +66,22 @@ type SelectPlantsParams struct {
 	middlewares.SelectParamsOffsetLimit
 }
 
-var selectPlants = middlewares.SelectEndpoint(
+var plantsFilters = middlewares.CatFilters.With(middlewares.Filters{
+	"boxid":     {Column: "t.boxid", Type: middlewares.FilterUUID, Ops: middlewares.FilterEqualOps},
+	"feedid":    {Column: "t.feedid", Type: middlewares.FilterUUID, Ops: middlewares.FilterEqualOps},
+	"is_public": {Column: "t.is_public", Type: middlewares.FilterBool},
+	"archived":  {Column: "t.archived", Type: middlewares.FilterBool},
+})
+
+var selectPlants = middlewares.NewSelectEndpointBuilder(
 	"plants",
-	func() interface{} { return &[]appbackend.Plant{} },
 	func() interface{} { return &SelectPlantsParams{} },
+	func() interface{} { return &[]appbackend.Plant{} },
 	[]middleware.Middleware{
 		filterUserID,
 	},
 	[]middleware.Middleware{},
-)
+).SetFilters(plantsFilters).Endpoint().Handle()
 
 var selectPlant = middlewares.SelectOneEndpoint(
 	"plants",
@@ -90,15 +98,21 @@ type SelectFeedEntriesParams struct {
 	middlewares.SelectParamsOffsetLimit
 }
 
-var selectFeedEntries = middlewares.SelectEndpoint(
+var feedEntriesFilters = middlewares.CatFilters.With(middlewares.Filters{
+	"feedid":    {Column: "t.feedid", Type: middlewares.FilterUUID, Ops: middlewares.FilterEqualOps},
+	"etype":     {Column: "t.etype", Type: middlewares.FilterString, Ops: middlewares.FilterEqualOps},
+	"createdat": {Column: "t.createdat", Type: middlewares.FilterTime, Ops: middlewares.FilterRangeOps},
+})
+
+var selectFeedEntries = middlewares.NewSelectEndpointBuilder(
 	"feedentries",
-	func() interface{} { return &[]appbackend.FeedEntry{} },
 	func() interface{} { return &SelectFeedEntriesParams{} },
+	func() interface{} { return &[]appbackend.FeedEntry{} },
 	[]middleware.Middleware{
 		filterUserID,
 	},
 	[]middleware.Middleware{},
-)
+).SetFilters(feedEntriesFilters).Endpoint().Handle()
 
 var selectFeedEntry = middlewares.SelectOneEndpoint(
 	"feedentries",
@@ -140,15 +154,20 @@ type SelectBoxesParams struct {
 	middlewares.SelectParamsOffsetLimit
 }
 
-var selectBoxes = middlewares.SelectEndpoint(
+var boxesFilters = middlewares.CatFilters.With(middlewares.Filters{
+	"deviceid": {Column: "t.deviceid", Type: middlewares.FilterUUID, Ops: middlewares.FilterEqualOps},
+	"feedid":   {Column: "t.feedid", Type: middlewares.FilterUUID, Ops: middlewares.FilterEqualOps},
+})
+
+var selectBoxes = middlewares.NewSelectEndpointBuilder(
 	"boxes",
-	func() interface{} { return &[]appbackend.Box{} },
 	func() interface{} { return &SelectBoxesParams{} },
+	func() interface{} { return &[]appbackend.Box{} },
 	[]middleware.Middleware{
 		filterUserID,
 	},
 	[]middleware.Middleware{},
-)
+).SetFilters(boxesFilters).Endpoint().Handle()
 
 var selectBox = middlewares.SelectOneEndpoint(
 	"boxes",
@@ -204,13 +223,13 @@ func loadParams(fn httprouter.Handle) httprouter.Handle {
 		keys, err := kv.GetKeys(params.Params) // TODO Is this dangerous?
 		if err != nil {
 			logrus.Errorf("kv.GetKeys in loadParams %q - %+v", err, params)
-			http.Error(w, err.Error(), http.StatusInternalServerError)
+			apierrors.Write(w, err)
 			return
 		}
 		m, err := kv.GetValues(keys)
 		if err != nil {
 			logrus.Errorf("kv.GetValues in loadParams %q - %+v", err, params)
-			http.Error(w, err.Error(), http.StatusInternalServerError)
+			apierrors.Write(w, err)
 			return
 		}
 
@@ -236,15 +255,19 @@ type SelectFeedMediasParams struct {
 	middlewares.SelectParamsOffsetLimit
 }
 
-var selectFeedMedias = middlewares.SelectEndpoint(
+var feedMediasFilters = middlewares.CatFilters.With(middlewares.Filters{
+	"feedentryid": {Column: "t.feedentryid", Type: middlewares.FilterUUID, Ops: middlewares.FilterEqualOps},
+})
+
+var selectFeedMedias = middlewares.NewSelectEndpointBuilder(
 	"feedmedias",
-	func() interface{} { return &[]appbackend.FeedMedia{} },
 	func() interface{} { return &SelectFeedMediasParams{} },
+	func() interface{} { return &[]appbackend.FeedMedia{} },
 	[]middleware.Middleware{
 		filterUserID,
 	},
 	[]middleware.Middleware{},
-)
+).SetFilters(feedMediasFilters).Endpoint().Handle()
 
 var selectFeedMedia = middlewares.SelectOneEndpoint(
 	"feedmedias",
@@ -356,7 +379,7 @@ func selectRepliesForComments(fn httprouter.Handle) httprouter.Handle {
 		selector := joinCommentSocialSelector(r.Context(), sess.Select("t.*").From("comments t").Where("replyto in ?", ids))
 		if err := selector.All(replies); err != nil {
 			logrus.Errorf("selector.All in selectRepliesForComments %q - %+v", err, ids)
-			http.Error(w, err.Error(), http.StatusInternalServerError)
+			apierrors.Write(w, err)
 			return
 		}
 		*result = append(*result, *replies...)
@@ -488,16 +511,22 @@ type publicFeedEntryBookmark struct {
 	PlantSettings string `db:"plantsettings" json:"plantSettings"`
 }
 
-var selectBookmarks = middlewares.SelectEndpoint(
+var selectBookmarks = middlewares.NewSelectEndpointBuilder(
 	"bookmarks",
-	func() interface{} { return &[]publicFeedEntryBookmark{} },
 	func() interface{} { return &SelectBookmarksParams{} },
+	func() interface{} { return &[]publicFeedEntryBookmark{} },
 	[]middleware.Middleware{
 		filterUserID,
 		joinFeedEntry,
 	},
 	[]middleware.Middleware{},
-)
+).SetKeyset(middlewares.Keyset{
+	// the feedentry columns come last, they're the ones in the results
+	Default: "date",
+	Sorts: map[string]middlewares.KeysetSort{
+		"date": {Column: "fe.createdat", Field: "Date", ID: "fe.id", IDField: "ID"},
+	},
+}).Endpoint().Handle()
 
 var selectBookmark = middlewares.SelectOneEndpoint(
 	"bookmarks",
@@ -515,15 +544,20 @@ type SelectTimelapsesParams struct {
 	middlewares.SelectParamsOffsetLimit
 }
 
-var selectTimelapses = middlewares.SelectEndpoint(
+var timelapsesFilters = middlewares.CatFilters.With(middlewares.Filters{
+	"plantid": {Column: "t.plantid", Type: middlewares.FilterUUID, Ops: middlewares.FilterEqualOps},
+	"ttype":   {Column: "t.ttype", Type: middlewares.FilterString, Ops: middlewares.FilterEqualOps},
+})
+
+var selectTimelapses = middlewares.NewSelectEndpointBuilder(
 	"timelapses",
-	func() interface{} { return &[]appbackend.Timelapse{} },
 	func() interface{} { return &SelectTimelapsesParams{} },
+	func() interface{} { return &[]appbackend.Timelapse{} },
 	[]middleware.Middleware{
 		filterUserID,
 	},
 	[]middleware.Middleware{},
-)
+).SetFilters(timelapsesFilters).Endpoint().Handle()
 
 var selectTimelapse = middlewares.SelectOneEndpoint(
 	"timelapses",
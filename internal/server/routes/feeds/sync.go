@@ -21,11 +21,16 @@ package feeds
 import (
 	"context"
 	"database/sql"
+	"encoding/base64"
 	"encoding/json"
+	"errors"
 	"fmt"
 	"net/http"
+	"reflect"
 	"strings"
+	"time"
 
+	"github.com/SuperGreenLab/AppBackend/internal/server/apierrors"
 	"github.com/SuperGreenLab/AppBackend/internal/server/middlewares"
 	cmiddlewares "github.com/SuperGreenLab/AppBackend/internal/server/middlewares"
 	fmiddlewares "github.com/SuperGreenLab/AppBackend/internal/server/routes/feeds/middlewares"
@@ -41,26 +46,103 @@ import (
 
 type syncResponse struct {
 	Items interface{} `json:"items"`
+	Next  string      `json:"next,omitempty"`
+}
+
+const maxSyncPageSize = 1000
+
+var errInvalidSyncPageCursor = errors.New("Invalid cursor")
+
+// syncPageParams - no limit returns everything at once, like older clients expect
+type syncPageParams struct {
+	Limit  int
+	Cursor string
+}
+
+type syncNextContextKey struct{}
+
+// encodeSyncPageCursor - position of the last object of the page, pages are ordered on (cat, id)
+func encodeSyncPageCursor(cat time.Time, id uuid.UUID) string {
+	return base64.RawURLEncoding.EncodeToString([]byte(fmt.Sprintf("%s|%s", cat.Format(time.RFC3339Nano), id)))
+}
+
+func decodeSyncPageCursor(cursor string) (time.Time, uuid.UUID, error) {
+	b, err := base64.RawURLEncoding.DecodeString(cursor)
+	if err != nil {
+		return time.Time{}, uuid.Nil, errInvalidSyncPageCursor
+	}
+	parts := strings.SplitN(string(b), "|", 2)
+	if len(parts) != 2 {
+		return time.Time{}, uuid.Nil, errInvalidSyncPageCursor
+	}
+	cat, err := time.Parse(time.RFC3339Nano, parts[0])
+	if err != nil {
+		return time.Time{}, uuid.Nil, errInvalidSyncPageCursor
+	}
+	id, err := uuid.FromString(parts[1])
+	if err != nil {
+		return time.Time{}, uuid.Nil, errInvalidSyncPageCursor
+	}
+	return cat, id, nil
+}
+
+// truncateSyncPage - res holds limit+1 rows when there's a next page, returns its cursor
+func truncateSyncPage(res interface{}, limit int) string {
+	rv := reflect.ValueOf(res).Elem()
+	if rv.Len() <= limit {
+		return ""
+	}
+	rv.Set(rv.Slice(0, limit))
+	last := rv.Index(limit - 1)
+	cat := last.FieldByName("CreatedAt").Interface().(time.Time)
+	id := last.FieldByName("ID").Interface().(uuid.NullUUID)
+	return encodeSyncPageCursor(cat, id.UUID)
 }
 
 func syncCollection(collection, id string, factory func() interface{}, customSelect func(sqlbuilder.Selector) sqlbuilder.Selector, postSelect []middleware.Middleware) httprouter.Handle {
 	s := middleware.NewStack()
 
+	s.Use(middlewares.DecodeQuery(func() interface{} { return &syncPageParams{} }))
 	s.Use(func(fn httprouter.Handle) httprouter.Handle {
 		return func(w http.ResponseWriter, r *http.Request, p httprouter.Params) {
 			sess := r.Context().Value(cmiddlewares.SessContextKey{}).(sqlbuilder.Database)
 			ueid := r.Context().Value(fmiddlewares.UserEndIDContextKey{}).(uuid.UUID)
+			params := r.Context().Value(middlewares.QueryObjectContextKey{}).(*syncPageParams)
+			if params.Limit < 0 || params.Limit > maxSyncPageSize {
+				errorMsg := fmt.Sprintf("limit should be between 1 and %d", maxSyncPageSize)
+				logrus.Errorf("%s in syncCollection - collection: %s ueid: %s limit: %d", errorMsg, collection, ueid, params.Limit)
+				apierrors.Write(w, apierrors.BadRequest(errorMsg))
+				return
+			}
+
 			res := factory()
 			selector := sess.Select(udb.Raw("a.*")).From(fmt.Sprintf("%s a", collection)).Join(fmt.Sprintf("userend_%s b", collection)).On(fmt.Sprintf("b.%s = a.id", id)).Where("b.userendid = ?", ueid).And("dirty = true")
 			if customSelect != nil {
 				selector = customSelect(selector)
 			}
-			if err := selector.OrderBy("a.cat ASC").All(res); err != nil {
+			if params.Cursor != "" {
+				cat, cid, err := decodeSyncPageCursor(params.Cursor)
+				if err != nil {
+					logrus.Errorf("decodeSyncPageCursor in syncCollection %q - collection: %s ueid: %s cursor: %s", err, collection, ueid, params.Cursor)
+					apierrors.Write(w, apierrors.BadRequest(err.Error()))
+					return
+				}
+				selector = selector.And("(a.cat, a.id) > (?, ?)", cat, cid)
+			}
+			selector = selector.OrderBy("a.cat ASC", "a.id ASC")
+			if params.Limit > 0 {
+				selector = selector.Limit(params.Limit + 1)
+			}
+			if err := selector.All(res); err != nil {
 				logrus.Errorf("selector.OrderBy in syncCollection %q - collection: %s id: %s ueid: %s", err, collection, id, ueid)
-				http.Error(w, err.Error(), http.StatusInternalServerError)
+				apierrors.Write(w, err)
 				return
 			}
-			ctx := context.WithValue(r.Context(), cmiddlewares.ObjectContextKey{}, res)
+			ctx := r.Context()
+			if params.Limit > 0 {
+				ctx = context.WithValue(ctx, syncNextContextKey{}, truncateSyncPage(res, params.Limit))
+			}
+			ctx = context.WithValue(ctx, cmiddlewares.ObjectContextKey{}, res)
 			fn(w, r.WithContext(ctx), p)
 		}
 	})
@@ -73,9 +155,10 @@ func syncCollection(collection, id string, factory func() interface{}, customSel
 
 	return s.Wrap(func(w http.ResponseWriter, r *http.Request, p httprouter.Params) {
 		o := r.Context().Value(middlewares.ObjectContextKey{})
-		if err := json.NewEncoder(w).Encode(syncResponse{o}); err != nil {
+		next, _ := r.Context().Value(syncNextContextKey{}).(string)
+		if err := json.NewEncoder(w).Encode(syncResponse{Items: o, Next: next}); err != nil {
 			logrus.Errorf("json.NewEncoder in syncCollection %q - collection: %s id: %s o: %+v", err, collection, id, o)
-			http.Error(w, err.Error(), http.StatusInternalServerError)
+			apierrors.Write(w, err)
 			return
 		}
 	})
@@ -123,29 +206,37 @@ func (r FeedMediaWithArchived) GetURLs() []appbackend.S3Path {
 	}
 }
 
-var syncFeedMediasHandler = syncCollection("feedmedias", "feedmediaid", func() interface{} { return &[]FeedMediaWithArchived{} }, func(selector sqlbuilder.Selector) sqlbuilder.Selector {
+func selectFeedMediasArchived(selector sqlbuilder.Selector) sqlbuilder.Selector {
 	selector = selector.Join("feedentries fe").On("fe.id = a.feedentryid")
 	selector = selector.Columns(udb.Raw("p.archived as plant_archived")).LeftJoin("plants p").On("p.feedid = fe.feedid")
 	selector = selector.Columns(udb.Raw("boxes.archived as box_archived")).LeftJoin("boxes").On("boxes.feedid = fe.feedid")
 	return selector
-}, []middleware.Middleware{
+}
+
+// loadFeedMediasURLs - medias of deleted or archived objects are sent without urls
+func loadFeedMediasURLs(feedMedias *[]FeedMediaWithArchived) error {
+	for i, fm := range *feedMedias {
+		if fm.Deleted == false && fm.PlantArchived.Bool == false && fm.BoxArchived.Bool == false {
+			if err := tools.LoadFeedMediaPublicURLs(&fm); err != nil {
+				return err
+			}
+		} else {
+			logrus.Infof("Skipped %+v", fm)
+		}
+		// might not be useful anymore
+		(*feedMedias)[i] = fm
+	}
+	return nil
+}
+
+var syncFeedMediasHandler = syncCollection("feedmedias", "feedmediaid", func() interface{} { return &[]FeedMediaWithArchived{} }, selectFeedMediasArchived, []middleware.Middleware{
 	func(fn httprouter.Handle) httprouter.Handle {
 		return func(w http.ResponseWriter, r *http.Request, p httprouter.Params) {
-			var err error
 			feedMedias := r.Context().Value(middlewares.ObjectContextKey{}).(*[]FeedMediaWithArchived)
-			for i, fm := range *feedMedias {
-				if fm.Deleted == false && fm.PlantArchived.Bool == false && fm.BoxArchived.Bool == false {
-					err = tools.LoadFeedMediaPublicURLs(&fm)
-					if err != nil {
-						logrus.Errorf("tools.LoadFeedMediaPublicURLs in syncFeedMediasHandler %q - fm: %+v", err, fm)
-						http.Error(w, err.Error(), http.StatusInternalServerError)
-						return
-					}
-				} else {
-					logrus.Infof("Skipped %+v", fm)
-				}
-				// might not be useful anymore
-				(*feedMedias)[i] = fm
+			if err := loadFeedMediasURLs(feedMedias); err != nil {
+				logrus.Errorf("loadFeedMediasURLs in syncFeedMediasHandler %q - feedMedias: %+v", err, feedMedias)
+				apierrors.Write(w, err)
+				return
 			}
 			ctx := context.WithValue(r.Context(), middlewares.ObjectContextKey{}, feedMedias)
 			fn(w, r.WithContext(ctx), p)
@@ -153,41 +244,38 @@ var syncFeedMediasHandler = syncCollection("feedmedias", "feedmediaid", func() i
 	},
 })
 
+// ackUserEndObject - marks the object as sent to the userend, or removes its userend row if it was deleted or archived
+func ackUserEndObject(sess sqlbuilder.SQLBuilder, collection, field string, id interface{}, ueid uuid.UUID) (bool, error) {
+	var o struct {
+		Deleted  bool `db:"deleted"`
+		Archived bool `db:"archived"`
+	}
+	fields := []interface{}{"deleted"}
+	if strings.Replace(collection, "userend_", "", 1) == "plants" {
+		fields = append(fields, "archived")
+	}
+	if err := sess.Select(fields...).From(strings.Replace(collection, "userend_", "", 1)).Where("id", id).One(&o); err != nil {
+		return false, err
+	}
+
+	if o.Deleted == true || o.Archived == true {
+		_, err := sess.DeleteFrom(collection).Where(fmt.Sprintf("%s = ?", field), id).And("userendid = ?", ueid).Exec()
+		return true, err
+	}
+	_, err := sess.Update(collection).Set("sent", true, "dirty", false).Where(fmt.Sprintf("%s = ?", field), id).And("userendid = ?", ueid).Exec()
+	return false, err
+}
+
 func syncedHandler(collection, field string) httprouter.Handle {
 	return func(w http.ResponseWriter, r *http.Request, p httprouter.Params) {
 		sess := r.Context().Value(cmiddlewares.SessContextKey{}).(sqlbuilder.Database)
 		ueid := r.Context().Value(fmiddlewares.UserEndIDContextKey{}).(uuid.UUID)
 
-		var o struct {
-			Deleted  bool `db:"deleted"`
-			Archived bool `db:"archived"`
-		}
-		fields := []interface{}{"deleted"}
-		if strings.Replace(collection, "userend_", "", 1) == "plants" {
-			fields = append(fields, "archived")
-		}
-		err := sess.Select(fields...).From(strings.Replace(collection, "userend_", "", 1)).Where("id", p.ByName("id")).One(&o)
-		if err != nil {
-			logrus.Errorf("sess.Select in syncedHandler %q - collection: %s field: %s id: %s o: %+v ueid: %s", err, collection, field, p.ByName("id"), o, ueid)
-			http.Error(w, err.Error(), http.StatusBadRequest)
+		if _, err := ackUserEndObject(sess, collection, field, p.ByName("id"), ueid); err != nil {
+			logrus.Errorf("ackUserEndObject in syncedHandler %q - collection: %s field: %s id: %s ueid: %s", err, collection, field, p.ByName("id"), ueid)
+			apierrors.Write(w, err)
 			return
 		}
-
-		if o.Deleted == true || o.Archived == true {
-			_, err := sess.DeleteFrom(collection).Where(fmt.Sprintf("%s = ?", field), p.ByName("id")).And("userendid = ?", ueid).Exec()
-			if err != nil {
-				logrus.Errorf("sess.DeleteFrom in syncedHandler %q - collection: %s field: %s id: %s o: %+v ueid: %s", err, collection, field, p.ByName("id"), o, ueid)
-				http.Error(w, err.Error(), http.StatusBadRequest)
-				return
-			}
-		} else {
-			_, err := sess.Update(collection).Set("sent", true, "dirty", false).Where(fmt.Sprintf("%s = ?", field), p.ByName("id")).And("userendid = ?", ueid).Exec()
-			if err != nil {
-				logrus.Errorf("sess.Update in syncedHandler %q - collection: %s field: %s id: %s o: %+v ueid: %s", err, collection, field, p.ByName("id"), o, ueid)
-				http.Error(w, err.Error(), http.StatusBadRequest)
-				return
-			}
-		}
 	}
 }
 
@@ -198,3 +286,85 @@ var syncedDeviceHandler = syncedHandler("userend_devices", "deviceid")
 var syncedFeedHandler = syncedHandler("userend_feeds", "feedid")
 var syncedFeedEntryHandler = syncedHandler("userend_feedentries", "feedentryid")
 var syncedFeedMediaHandler = syncedHandler("userend_feedmedias", "feedmediaid")
+
+const (
+	syncAckSynced  = "synced"
+	syncAckRemoved = "removed"
+	syncAckError   = "error"
+)
+
+type syncAckRequest struct {
+	Items []struct {
+		Type string `json:"type"`
+		ID   string `json:"id"`
+	} `json:"items"`
+}
+
+type syncAckResult struct {
+	Type   string `json:"type"`
+	ID     string `json:"id"`
+	Status string `json:"status"`
+	Error  string `json:"error,omitempty"`
+}
+
+type syncAckResponse struct {
+	Results []syncAckResult `json:"results"`
+}
+
+// syncAckHandler - same as the /:type/:id/sync endpoints, for a whole batch in one transaction
+func syncAckHandler() httprouter.Handle {
+	s := middleware.NewStack()
+
+	s.Use(middlewares.DecodeJSON(func() interface{} { return &syncAckRequest{} }))
+
+	return s.Wrap(func(w http.ResponseWriter, r *http.Request, p httprouter.Params) {
+		sess := r.Context().Value(cmiddlewares.SessContextKey{}).(sqlbuilder.Database)
+		ueid := r.Context().Value(fmiddlewares.UserEndIDContextKey{}).(uuid.UUID)
+		req := r.Context().Value(middlewares.ObjectContextKey{}).(*syncAckRequest)
+
+		response := syncAckResponse{Results: make([]syncAckResult, 0, len(req.Items))}
+		if err := sess.Tx(r.Context(), func(tx sqlbuilder.Tx) error {
+			for _, item := range req.Items {
+				res := syncAckResult{Type: item.Type, ID: item.ID, Status: syncAckError}
+				field, ok := idFields[item.Type]
+				if !ok {
+					res.Error = "Unknown type"
+					response.Results = append(response.Results, res)
+					continue
+				}
+				id, err := uuid.FromString(item.ID)
+				if err != nil {
+					res.Error = "Invalid id"
+					response.Results = append(response.Results, res)
+					continue
+				}
+
+				removed, err := ackUserEndObject(tx, fmt.Sprintf("userend_%s", item.Type), field, id, ueid)
+				if err == udb.ErrNoMoreRows {
+					res.Error = "Not found"
+					response.Results = append(response.Results, res)
+					continue
+				} else if err != nil {
+					return err
+				}
+
+				res.Status = syncAckSynced
+				if removed {
+					res.Status = syncAckRemoved
+				}
+				response.Results = append(response.Results, res)
+			}
+			return nil
+		}); err != nil {
+			logrus.Errorf("sess.Tx in syncAckHandler %q - ueid: %s", err, ueid)
+			apierrors.Write(w, err)
+			return
+		}
+
+		if err := json.NewEncoder(w).Encode(response); err != nil {
+			logrus.Errorf("json.NewEncoder in syncAckHandler %q - ueid: %s", err, ueid)
+			apierrors.Write(w, err)
+			return
+		}
+	})
+}
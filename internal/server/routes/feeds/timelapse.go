@@ -25,6 +25,7 @@ import (
 	"net/http"
 	"time"
 
+	"github.com/SuperGreenLab/AppBackend/internal/server/apierrors"
 	"github.com/gofrs/uuid"
 
 	"github.com/sirupsen/logrus"
@@ -49,7 +50,7 @@ func timelapseUploadURLHandler(w http.ResponseWriter, r *http.Request, p httprou
 	fmup := timelapseUploadRequest{}
 	if err := tools.DecodeJSONBody(w, r, &fmup); err != nil {
 		logrus.Errorf("tools.DecodeJSONBody in timelapseUploadURLHandler %q", err)
-		http.Error(w, err.Error(), http.StatusInternalServerError)
+		apierrors.Write(w, err)
 		return
 	}
 
@@ -60,14 +61,14 @@ func timelapseUploadURLHandler(w http.ResponseWriter, r *http.Request, p httprou
 	url2, err := storage.Client.PresignedPutObject("timelapses", path, expiry)
 	if err != nil {
 		logrus.Errorf("minioClient.PresignedPutObject in timelapseUploadURLHandler %q - %s", err, path)
-		http.Error(w, err.Error(), http.StatusInternalServerError)
+		apierrors.Write(w, err)
 		return
 	}
 	res.UploadPath = url2.RequestURI()
 
 	if err := json.NewEncoder(w).Encode(res); err != nil {
 		logrus.Errorf("json.NewEncoder in timelapseUploadURLHandler %q", err)
-		http.Error(w, err.Error(), http.StatusInternalServerError)
+		apierrors.Write(w, err)
 		return
 	}
 }
@@ -78,33 +79,33 @@ func timelapseLatestPic(w http.ResponseWriter, r *http.Request, p httprouter.Par
 	timelapseID, err := uuid.FromString(timelapseIDStr)
 	if err != nil {
 		logrus.Errorf("uuid.FromString in timelapseLatestPic %q", err)
-		http.Error(w, err.Error(), http.StatusInternalServerError)
+		apierrors.Write(w, err)
 		return
 	}
 	frame, err := db.GetTimelapseFrame(timelapseID)
 	if err != nil {
 		logrus.Errorf("db.GetTimelapseFrame in timelapseLatestPic %q", err)
-		http.Error(w, err.Error(), http.StatusInternalServerError)
+		apierrors.Write(w, err)
 		return
 	}
 
 	if frame.UserID != uid {
 		errorMsg := "Access denied"
 		logrus.Errorf("frame.UserID.UUID in timelapseLatestPic uid: %s", errorMsg, err, uid)
-		http.Error(w, errorMsg, http.StatusUnauthorized)
+		apierrors.Write(w, apierrors.Unauthorized(errorMsg))
 		return
 	}
 
 	err = tools.LoadFeedMediaPublicURLs(&frame)
 	if err != nil {
 		logrus.Errorf("tools.LoadFeedMediaPublicURLs in timelapseLatestPic %q", err)
-		http.Error(w, err.Error(), http.StatusInternalServerError)
+		apierrors.Write(w, err)
 		return
 	}
 
 	if err := json.NewEncoder(w).Encode(frame); err != nil {
 		logrus.Errorf("json.NewEncoder in timelapseLatestPic %q", err)
-		http.Error(w, err.Error(), http.StatusInternalServerError)
+		apierrors.Write(w, err)
 		return
 	}
 }
@@ -121,7 +122,7 @@ func sglOverlayHandler(w http.ResponseWriter, r *http.Request, p httprouter.Para
 	sop := SGLOverlayParams{}
 	if err := tools.DecodeJSONBody(w, r, &sop); err != nil {
 		logrus.Errorf("tools.DecodeJSONBody in sglOverlayHandler %q", err)
-		http.Error(w, err.Error(), http.StatusInternalServerError)
+		apierrors.Write(w, err)
 		return
 	}
 
@@ -133,7 +134,7 @@ func sglOverlayHandler(w http.ResponseWriter, r *http.Request, p httprouter.Para
 	request, err := http.NewRequest("GET", sop.URL, nil)
 	if err != nil {
 		logrus.Errorf("http.NewRequest in sglOverlayHandler %q", err)
-		http.Error(w, err.Error(), http.StatusInternalServerError)
+		apierrors.Write(w, err)
 		return
 	}
 	request.Host = sop.Host
@@ -141,7 +142,7 @@ func sglOverlayHandler(w http.ResponseWriter, r *http.Request, p httprouter.Para
 	resp, err := client.Do(request)
 	if err != nil {
 		logrus.Errorf("client.Do in sglOverlayHandler %q", err)
-		http.Error(w, err.Error(), http.StatusInternalServerError)
+		apierrors.Write(w, err)
 		return
 	}
 	defer resp.Body.Close()
@@ -149,7 +150,7 @@ func sglOverlayHandler(w http.ResponseWriter, r *http.Request, p httprouter.Para
 	picBuffer := &bytes.Buffer{}
 	if _, err := picBuffer.ReadFrom(resp.Body); err != nil {
 		logrus.Errorf("picBuffer.ReadFrom in sglOverlayHandler %q", err)
-		http.Error(w, err.Error(), http.StatusInternalServerError)
+		apierrors.Write(w, err)
 		return
 	}
 	picBuffer, err = appbackend.AddSGLOverlays(sop.Box, sop.Plant, sop.Meta, picBuffer)
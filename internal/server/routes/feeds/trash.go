@@ -0,0 +1,287 @@
+/*
+ * Copyright (C) 2021  SuperGreenLab <towelie@supergreenlab.com>
+ * Author: Constantin Clauzel <constantin.clauzel@gmail.com>
+ *
+ * This program is free software: you can redistribute it and/or modify
+ * it under the terms of the GNU General Public License as published by
+ * the Free Software Foundation, either version 3 of the License, or
+ * (at your option) any later version.
+ *
+ * This program is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ * GNU General Public License for more details.
+ *
+ * You should have received a copy of the GNU General Public License
+ * along with this program.  If not, see <http://www.gnu.org/licenses/>.
+ */
+
+package feeds
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"time"
+
+	"github.com/SuperGreenLab/AppBackend/internal/data/db"
+	"github.com/SuperGreenLab/AppBackend/internal/server/apierrors"
+	"github.com/SuperGreenLab/AppBackend/internal/server/middlewares"
+	fmiddlewares "github.com/SuperGreenLab/AppBackend/internal/server/routes/feeds/middlewares"
+	"github.com/SuperGreenLab/AppBackend/internal/server/tools"
+	appbackend "github.com/SuperGreenLab/AppBackend/pkg"
+	"github.com/gofrs/uuid"
+	"github.com/julienschmidt/httprouter"
+	"github.com/rileyr/middleware"
+	"github.com/sirupsen/logrus"
+	"github.com/spf13/pflag"
+	"github.com/spf13/viper"
+	udb "upper.io/db.v3"
+	"upper.io/db.v3/lib/sqlbuilder"
+)
+
+var (
+	_ = pflag.String("trashretention", "720h", "How long deleted objects can be restored")
+)
+
+func init() {
+	viper.SetDefault("TrashRetention", "720h")
+}
+
+// trashCascadeWindow - dependents deleted around the same time as the restored object are considered deleted with it
+const trashCascadeWindow = 5 * time.Minute
+
+var errTrashParentDeleted = errors.New("Parent is deleted, restore it first")
+
+type trashBox struct {
+	appbackend.Box
+	DeletedAt time.Time `db:"deletedat" json:"deletedAt"`
+}
+
+type trashPlant struct {
+	appbackend.Plant
+	DeletedAt time.Time `db:"deletedat" json:"deletedAt"`
+}
+
+type trashFeedEntry struct {
+	appbackend.FeedEntry
+	DeletedAt time.Time `db:"deletedat" json:"deletedAt"`
+}
+
+type trashFeedMedia struct {
+	FeedMediaWithArchived
+	DeletedAt time.Time `db:"deletedat" json:"deletedAt"`
+}
+
+type trashResponse struct {
+	Boxes       []trashBox       `json:"boxes"`
+	Plants      []trashPlant     `json:"plants"`
+	FeedEntries []trashFeedEntry `json:"feedEntries"`
+	FeedMedias  []trashFeedMedia `json:"feedMedias"`
+}
+
+func trashRetentionStart() time.Time {
+	return time.Now().Add(-viper.GetDuration("TrashRetention"))
+}
+
+// trashHandler - deleted objects of the user that can still be restored, most recent first
+func trashHandler(w http.ResponseWriter, r *http.Request, p httprouter.Params) {
+	sess := r.Context().Value(middlewares.SessContextKey{}).(sqlbuilder.Database)
+	uid := r.Context().Value(middlewares.UserIDContextKey{}).(uuid.UUID)
+
+	response := trashResponse{
+		Boxes:       []trashBox{},
+		Plants:      []trashPlant{},
+		FeedEntries: []trashFeedEntry{},
+		FeedMedias:  []trashFeedMedia{},
+	}
+	since := trashRetentionStart()
+	for collection, res := range map[string]interface{}{
+		"boxes":       &response.Boxes,
+		"plants":      &response.Plants,
+		"feedentries": &response.FeedEntries,
+		"feedmedias":  &response.FeedMedias,
+	} {
+		selector := sess.Select("*").From(collection).Where("userid = ?", uid).And("deleted = ?", true).And("deletedat >= ?", since)
+		if err := selector.OrderBy("deletedat DESC").All(res); err != nil {
+			logrus.Errorf("selector.All in trashHandler %q - collection: %s uid: %s", err, collection, uid)
+			apierrors.Write(w, err)
+			return
+		}
+	}
+	for i := range response.FeedMedias {
+		if err := tools.LoadFeedMediaPublicURLs(&response.FeedMedias[i]); err != nil {
+			logrus.Errorf("tools.LoadFeedMediaPublicURLs in trashHandler %q - uid: %s", err, uid)
+			apierrors.Write(w, err)
+			return
+		}
+	}
+
+	if err := json.NewEncoder(w).Encode(response); err != nil {
+		logrus.Errorf("json.NewEncoder in trashHandler %q - uid: %s", err, uid)
+		apierrors.Write(w, err)
+		return
+	}
+}
+
+// trashDependent - Where selects the children of the restored object, its id is the only argument
+type trashDependent struct {
+	Collection string
+	Where      string
+}
+
+var trashDependents = map[string][]trashDependent{
+	"boxes": {
+		{"feeds", "id = (select feedid from boxes where id = ?)"},
+		{"plants", "boxid = ?"},
+	},
+	"plants": {
+		{"feeds", "id = (select feedid from plants where id = ?)"},
+		{"timelapses", "plantid = ?"},
+	},
+	"feeds": {
+		{"feedentries", "feedid = ?"},
+	},
+	"feedentries": {
+		{"feedmedias", "feedentryid = ?"},
+	},
+}
+
+// trashParents - restoring an object under a deleted parent would leave it unreachable
+var trashParents = map[string]string{
+	"plants":      "exists(select 1 from boxes where boxes.id = o.boxid and boxes.deleted = true)",
+	"feedentries": "exists(select 1 from feeds where feeds.id = o.feedid and feeds.deleted = true)",
+	"feedmedias":  "exists(select 1 from feedentries where feedentries.id = o.feedentryid and feedentries.deleted = true)",
+}
+
+// restoreObject - un-deletes the object and the dependents deleted with it, restored collects the ids by collection
+func restoreObject(sess sqlbuilder.SQLBuilder, uid uuid.UUID, collection string, id uuid.UUID, from, to time.Time, restored map[string][]uuid.UUID) error {
+	res, err := sess.Update(collection).Set("deleted", false).Where("id = ?", id).And("userid = ?", uid).And("deleted = ?", true).Exec()
+	if err != nil {
+		return fmt.Errorf("%s: %w", collection, err)
+	}
+	if n, err := res.RowsAffected(); err != nil {
+		return fmt.Errorf("%s: %w", collection, err)
+	} else if n == 0 {
+		return nil
+	}
+	restored[collection] = append(restored[collection], id)
+
+	for _, d := range trashDependents[collection] {
+		ids := []struct {
+			ID uuid.UUID `db:"id"`
+		}{}
+		selector := sess.Select("id").From(d.Collection).Where(d.Where, id).And("userid = ?", uid).And("deleted = ?", true).And("deletedat between ? and ?", from, to)
+		if err := selector.All(&ids); err != nil {
+			return fmt.Errorf("%s: %w", d.Collection, err)
+		}
+		for _, child := range ids {
+			if err := restoreObject(sess, uid, d.Collection, child.ID, from, to, restored); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+// dirtyRestoredObjects - userend rows might have been removed when the deletion was synced
+func dirtyRestoredObjects(sess sqlbuilder.SQLBuilder, uid uuid.UUID, collection string, ids []uuid.UUID) error {
+	field := idFields[collection]
+	for _, id := range ids {
+		if _, err := sess.Update(fmt.Sprintf("userend_%s", collection)).Set("dirty", true).Where(fmt.Sprintf("%s = ?", field), id).And("userendid in ("+db.LegacySyncUserEnds+")", uid).Exec(); err != nil {
+			return fmt.Errorf("userend_%s: %w", collection, err)
+		}
+		if _, err := sess.Exec(fmt.Sprintf("insert into userend_%s (userendid, %s, dirty) select ue.id, ?, true from userends ue where ue.id in (%s) and not exists(select 1 from userend_%s b where b.userendid = ue.id and b.%s = ?)", collection, field, db.LegacySyncUserEnds, collection, field), id, uid, id); err != nil {
+			return fmt.Errorf("userend_%s: %w", collection, err)
+		}
+	}
+	return nil
+}
+
+type restoreRequest struct {
+	Type string    `json:"type"`
+	ID   uuid.UUID `json:"id"`
+}
+
+type restoreResponse struct {
+	Restored map[string][]uuid.UUID `json:"restored"`
+}
+
+var trashTypes = map[string]bool{
+	"boxes":       true,
+	"plants":      true,
+	"feedentries": true,
+	"feedmedias":  true,
+}
+
+// restoreHandler - type is the collection name, as in /deletes
+func restoreHandler() httprouter.Handle {
+	s := middleware.NewStack()
+
+	s.Use(middlewares.DecodeJSON(func() interface{} { return &restoreRequest{} }))
+
+	return s.Wrap(func(w http.ResponseWriter, r *http.Request, p httprouter.Params) {
+		sess := r.Context().Value(middlewares.SessContextKey{}).(sqlbuilder.Database)
+		uid := r.Context().Value(middlewares.UserIDContextKey{}).(uuid.UUID)
+		req := r.Context().Value(middlewares.ObjectContextKey{}).(*restoreRequest)
+
+		if !trashTypes[req.Type] {
+			errorMsg := fmt.Sprintf("Unknown type %s", req.Type)
+			logrus.Errorf("%s in restoreHandler - uid: %s", errorMsg, uid)
+			apierrors.Write(w, apierrors.BadRequest(errorMsg))
+			return
+		}
+
+		o := struct {
+			DeletedAt     time.Time `db:"deletedat"`
+			ParentDeleted bool      `db:"parent_deleted"`
+		}{}
+		parent := "false"
+		if cond, ok := trashParents[req.Type]; ok {
+			parent = cond
+		}
+		selector := sess.Select("o.deletedat").Columns(udb.Raw(fmt.Sprintf("%s as parent_deleted", parent))).From(fmt.Sprintf("%s o", req.Type)).
+			Where("o.id = ?", req.ID).And("o.userid = ?", uid).And("o.deleted = ?", true).And("o.deletedat >= ?", trashRetentionStart())
+		if err := selector.One(&o); err == udb.ErrNoMoreRows {
+			apierrors.Write(w, apierrors.NotFound("Not found"))
+			return
+		} else if err != nil {
+			logrus.Errorf("selector.One in restoreHandler %q - uid: %s req: %+v", err, uid, req)
+			apierrors.Write(w, err)
+			return
+		}
+		if o.ParentDeleted {
+			logrus.Errorf("%s in restoreHandler - uid: %s req: %+v", errTrashParentDeleted, uid, req)
+			apierrors.Write(w, apierrors.Conflict(errTrashParentDeleted.Error()))
+			return
+		}
+
+		response := restoreResponse{Restored: map[string][]uuid.UUID{}}
+		if err := sess.Tx(r.Context(), func(tx sqlbuilder.Tx) error {
+			from, to := o.DeletedAt.Add(-trashCascadeWindow), o.DeletedAt.Add(trashCascadeWindow)
+			if err := restoreObject(tx, uid, req.Type, req.ID, from, to, response.Restored); err != nil {
+				return err
+			}
+			for collection, ids := range response.Restored {
+				if err := dirtyRestoredObjects(tx, uid, collection, ids); err != nil {
+					return err
+				}
+			}
+			return nil
+		}); err != nil {
+			logrus.Errorf("sess.Tx in restoreHandler %q - uid: %s req: %+v", err, uid, req)
+			apierrors.Write(w, err)
+			return
+		}
+		for collection, ids := range response.Restored {
+			fmiddlewares.NotifyUserEnds(r, uid, uuid.Nil, false, collection, ids...)
+		}
+
+		if err := json.NewEncoder(w).Encode(response); err != nil {
+			logrus.Errorf("json.NewEncoder in restoreHandler %q - uid: %s", err, uid)
+			apierrors.Write(w, err)
+			return
+		}
+	})
+}
@@ -28,6 +28,7 @@ import (
 	"time"
 
 	"github.com/SuperGreenLab/AppBackend/internal/data/prometheus"
+	"github.com/SuperGreenLab/AppBackend/internal/server/apierrors"
 	"github.com/julienschmidt/httprouter"
 	log "github.com/sirupsen/logrus"
 )
@@ -43,7 +44,7 @@ func ServeMetricsHandler(w http.ResponseWriter, r *http.Request, p httprouter.Pa
 	q := r.URL.Query().Get("q")
 	if q == "" {
 		log.Error("q parameter error missing")
-		w.WriteHeader(http.StatusNotFound)
+		apierrors.Write(w, apierrors.BadRequest("Invalid q parameter"))
 		return
 	}
 	q = queryFilter.ReplaceAllString(q, "")
@@ -54,7 +55,7 @@ func ServeMetricsHandler(w http.ResponseWriter, r *http.Request, p httprouter.Pa
 		t, err := strconv.Atoi(r.URL.Query().Get("t"))
 		if err != nil {
 			log.Errorf("t parameter error: %s\n", err)
-			w.WriteHeader(http.StatusNotFound)
+			apierrors.Write(w, apierrors.BadRequest("Invalid t parameter"))
 			return
 		}
 		timeFrom = time.Now().Unix() - 60*60*int64(t)
@@ -62,14 +63,14 @@ func ServeMetricsHandler(w http.ResponseWriter, r *http.Request, p httprouter.Pa
 		t1, err := strconv.Atoi(r.URL.Query().Get("t1"))
 		if err != nil {
 			log.Errorf("t1 parameter error: %s\n", err)
-			w.WriteHeader(http.StatusNotFound)
+			apierrors.Write(w, apierrors.BadRequest("Invalid t1 parameter"))
 			return
 		}
 
 		t2, err := strconv.Atoi(r.URL.Query().Get("t2"))
 		if err != nil {
 			log.Errorf("t2 parameter error: %s\n", err)
-			w.WriteHeader(http.StatusNotFound)
+			apierrors.Write(w, apierrors.BadRequest("Invalid t2 parameter"))
 			return
 		}
 		timeFrom = time.Now().Unix() - 60*60*int64(t1)
@@ -78,14 +79,14 @@ func ServeMetricsHandler(w http.ResponseWriter, r *http.Request, p httprouter.Pa
 		timeFrom, err = strconv.ParseInt(r.URL.Query().Get("timeFrom"), 10, 64)
 		if err != nil {
 			log.Errorf("timeFrom parameter error: %s\n", err)
-			w.WriteHeader(http.StatusNotFound)
+			apierrors.Write(w, apierrors.BadRequest("Invalid timeFrom parameter"))
 			return
 		}
 
 		timeTo, err = strconv.ParseInt(r.URL.Query().Get("timeTo"), 10, 64)
 		if err != nil {
 			log.Errorf("timeTo parameter error: %s\n", err)
-			w.WriteHeader(http.StatusNotFound)
+			apierrors.Write(w, apierrors.BadRequest("Invalid timeTo parameter"))
 			return
 		}
 	}
@@ -108,7 +109,7 @@ func ServeMetricsHandler(w http.ResponseWriter, r *http.Request, p httprouter.Pa
 	cid := r.URL.Query().Get("cid")
 	if cid == "" {
 		log.Errorf("cid parameter error: %s\n", err)
-		w.WriteHeader(http.StatusNotFound)
+		apierrors.Write(w, apierrors.BadRequest("Invalid cid parameter"))
 		return
 	}
 	cid = cidFilter.ReplaceAllString(cid, "")
@@ -117,13 +118,13 @@ func ServeMetricsHandler(w http.ResponseWriter, r *http.Request, p httprouter.Pa
 
 	if err != nil {
 		log.Errorf("prometheus query failed: %s\n", err)
-		w.WriteHeader(http.StatusInternalServerError)
+		apierrors.Write(w, err)
 		return
 	}
 
 	if rr.Status != "success" {
-		log.Errorf("cid parameter error: %s\n", rr.Status)
-		w.WriteHeader(http.StatusNotFound)
+		log.Errorf("prometheus query status: %s\n", rr.Status)
+		apierrors.Write(w, apierrors.Internal())
 		return
 	}
 
@@ -131,7 +132,7 @@ func ServeMetricsHandler(w http.ResponseWriter, r *http.Request, p httprouter.Pa
 
 	js, err := json.Marshal(sr)
 	if err != nil {
-		http.Error(w, err.Error(), http.StatusInternalServerError)
+		apierrors.Write(w, err)
 		return
 	}
 
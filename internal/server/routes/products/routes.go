@@ -28,9 +28,11 @@ func Init(router *httprouter.Router) {
 	anon := middlewares.AnonStack()
 	auth := middlewares.AuthStack()
 
-	router.POST("/product", auth.Wrap(createProductsHandler))
-	router.POST("/supplier", auth.Wrap(createSuppliersHandler))
-	router.POST("/productsupplier", auth.Wrap(createProductSuppliersHandler))
+	productsWrite := middlewares.RequireScope(middlewares.ScopeProductsWrite)
+
+	router.POST("/product", auth.Wrap(productsWrite(createProductsHandler)))
+	router.POST("/supplier", auth.Wrap(productsWrite(createSuppliersHandler)))
+	router.POST("/productsupplier", auth.Wrap(productsWrite(createProductSuppliersHandler)))
 
 	router.GET("/products/search", anon.Wrap(searchProducts))
 }
@@ -23,6 +23,7 @@ import (
 	"net/http"
 
 	"github.com/SuperGreenLab/AppBackend/internal/data/db"
+	"github.com/SuperGreenLab/AppBackend/internal/server/apierrors"
 	"github.com/SuperGreenLab/AppBackend/internal/server/middlewares"
 	"github.com/julienschmidt/httprouter"
 	"github.com/sirupsen/logrus"
@@ -36,7 +37,7 @@ type searchProductsResult struct {
 func searchProducts(w http.ResponseWriter, r *http.Request, p httprouter.Params) {
 	terms := r.URL.Query().Get("terms")
 	if terms == "" {
-		http.Error(w, "missing 'terms' parameter", http.StatusInternalServerError)
+		apierrors.Write(w, apierrors.BadRequest("Missing 'terms' parameter"))
 		return
 	}
 	category := r.URL.Query().Get("category")
@@ -50,12 +51,12 @@ func searchProducts(w http.ResponseWriter, r *http.Request, p httprouter.Params)
 	products := []db.Products{}
 	if err := selector.All(&products); err != nil {
 		logrus.Errorf("selector.All in searchProducts %q", err)
-		http.Error(w, err.Error(), http.StatusInternalServerError)
+		apierrors.Write(w, err)
 		return
 	}
 	if err := json.NewEncoder(w).Encode(searchProductsResult{products}); err != nil {
 		logrus.Errorf("json.NewEncoder in searchProducts %q - %+v", err, products)
-		http.Error(w, err.Error(), http.StatusInternalServerError)
+		apierrors.Write(w, err)
 		return
 	}
 }
@@ -0,0 +1,168 @@
+/*
+ * Copyright (C) 2021  SuperGreenLab <towelie@supergreenlab.com>
+ * Author: Constantin Clauzel <constantin.clauzel@gmail.com>
+ *
+ * This program is free software: you can redistribute it and/or modify
+ * it under the terms of the GNU General Public License as published by
+ * the Free Software Foundation, either version 3 of the License, or
+ * (at your option) any later version.
+ *
+ * This program is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ * GNU General Public License for more details.
+ *
+ * You should have received a copy of the GNU General Public License
+ * along with this program.  If not, see <http://www.gnu.org/licenses/>.
+ */
+
+package users
+
+import (
+	"encoding/json"
+	"net/http"
+	"strings"
+
+	"github.com/SuperGreenLab/AppBackend/internal/data/db"
+	"github.com/SuperGreenLab/AppBackend/internal/server/apierrors"
+	"github.com/SuperGreenLab/AppBackend/internal/server/middlewares"
+	"github.com/SuperGreenLab/AppBackend/internal/server/tools"
+	"github.com/gofrs/uuid"
+	"github.com/julienschmidt/httprouter"
+	"github.com/rileyr/middleware"
+	"github.com/sirupsen/logrus"
+	"upper.io/db.v3/lib/sqlbuilder"
+	"upper.io/db.v3/postgresql"
+)
+
+type createAPIKeyParams struct {
+	Name   string   `json:"name"`
+	Scopes []string `json:"scopes"`
+}
+
+type createAPIKeyResult struct {
+	ID  uuid.UUID `json:"id"`
+	Key string    `json:"key"`
+}
+
+func validAPIKeyScope(scope string) bool {
+	for _, s := range middlewares.APIKeyScopes {
+		if s == scope {
+			return true
+		}
+	}
+	return false
+}
+
+// createAPIKeyHandler - the key is only returned once, only its hash is stored
+func createAPIKeyHandler() httprouter.Handle {
+	s := middleware.NewStack()
+
+	s.Use(middlewares.DecodeJSON(func() interface{} { return &createAPIKeyParams{} }))
+
+	return s.Wrap(func(w http.ResponseWriter, r *http.Request, p httprouter.Params) {
+		cakp := r.Context().Value(middlewares.ObjectContextKey{}).(*createAPIKeyParams)
+		sess := r.Context().Value(middlewares.SessContextKey{}).(sqlbuilder.Database)
+		uid := r.Context().Value(middlewares.UserIDContextKey{}).(uuid.UUID)
+
+		cakp.Name = strings.TrimSpace(cakp.Name)
+		if len(cakp.Name) == 0 || len(cakp.Name) > 64 {
+			errorMsg := "Name length should be between 1 and 64 caracters"
+			logrus.Errorf("%s - %+v", errorMsg, cakp)
+			apierrors.Write(w, apierrors.BadRequest(errorMsg))
+			return
+		}
+		if len(cakp.Scopes) == 0 {
+			errorMsg := "At least one scope is required"
+			logrus.Errorf("%s - %+v", errorMsg, cakp)
+			apierrors.Write(w, apierrors.BadRequest(errorMsg))
+			return
+		}
+		for _, scope := range cakp.Scopes {
+			if !validAPIKeyScope(scope) {
+				errorMsg := "Unknown scope " + scope
+				logrus.Errorf("%s - %+v", errorMsg, cakp)
+				apierrors.Write(w, apierrors.BadRequest(errorMsg))
+				return
+			}
+		}
+
+		token, err := tools.NewRandomToken()
+		if err != nil {
+			logrus.Errorf("tools.NewRandomToken in createAPIKeyHandler %q - %+v", err, cakp)
+			apierrors.Write(w, err)
+			return
+		}
+		key := middlewares.APIKeyPrefix + token
+
+		apiKey := db.APIKey{
+			UserID: uid,
+			Name:   cakp.Name,
+			Prefix: key[:len(middlewares.APIKeyPrefix)+6],
+			Key:    tools.HashToken(key),
+			Scopes: postgresql.StringArray(cakp.Scopes),
+		}
+		id, err := sess.Collection("apikeys").Insert(apiKey)
+		if err != nil {
+			logrus.Errorf("sess.Collection in createAPIKeyHandler %q - %+v", err, cakp)
+			apierrors.Write(w, err)
+			return
+		}
+
+		res := createAPIKeyResult{ID: uuid.FromStringOrNil(string(id.([]uint8))), Key: key}
+		if err := json.NewEncoder(w).Encode(res); err != nil {
+			logrus.Errorf("json.NewEncoder in createAPIKeyHandler %q", err)
+			apierrors.Write(w, err)
+			return
+		}
+	})
+}
+
+type apiKeysResult struct {
+	APIKeys []db.APIKey `json:"apiKeys"`
+}
+
+func listAPIKeysHandler(w http.ResponseWriter, r *http.Request, p httprouter.Params) {
+	sess := r.Context().Value(middlewares.SessContextKey{}).(sqlbuilder.Database)
+	uid := r.Context().Value(middlewares.UserIDContextKey{}).(uuid.UUID)
+
+	res := apiKeysResult{APIKeys: []db.APIKey{}}
+	if err := sess.Select("*").From("apikeys").Where("userid = ?", uid).OrderBy("cat desc").All(&res.APIKeys); err != nil {
+		logrus.Errorf("sess.Select in listAPIKeysHandler %q - uid: %s", err, uid)
+		apierrors.Write(w, err)
+		return
+	}
+
+	if err := json.NewEncoder(w).Encode(res); err != nil {
+		logrus.Errorf("json.NewEncoder in listAPIKeysHandler %q", err)
+		apierrors.Write(w, err)
+		return
+	}
+}
+
+func deleteAPIKeyHandler(w http.ResponseWriter, r *http.Request, p httprouter.Params) {
+	sess := r.Context().Value(middlewares.SessContextKey{}).(sqlbuilder.Database)
+	uid := r.Context().Value(middlewares.UserIDContextKey{}).(uuid.UUID)
+
+	id, err := uuid.FromString(p.ByName("id"))
+	if err != nil {
+		logrus.Errorf("uuid.FromString in deleteAPIKeyHandler %q - id: %s", err, p.ByName("id"))
+		apierrors.Write(w, apierrors.BadRequest("Invalid id"))
+		return
+	}
+
+	res, err := sess.DeleteFrom("apikeys").Where("id = ?", id).And("userid = ?", uid).Exec()
+	if err != nil {
+		logrus.Errorf("sess.DeleteFrom in deleteAPIKeyHandler %q - id: %s uid: %s", err, id, uid)
+		apierrors.Write(w, err)
+		return
+	}
+	if n, err := res.RowsAffected(); err != nil || n == 0 {
+		errorMsg := "Unknown API key"
+		logrus.Errorf("%s - id: %s uid: %s", errorMsg, id, uid)
+		apierrors.Write(w, apierrors.NotFound(errorMsg))
+		return
+	}
+
+	w.WriteHeader(http.StatusOK)
+}
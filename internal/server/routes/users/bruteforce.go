@@ -0,0 +1,174 @@
+/*
+ * Copyright (C) 2021  SuperGreenLab <towelie@supergreenlab.com>
+ * Author: Constantin Clauzel <constantin.clauzel@gmail.com>
+ *
+ * This program is free software: you can redistribute it and/or modify
+ * it under the terms of the GNU General Public License as published by
+ * the Free Software Foundation, either version 3 of the License, or
+ * (at your option) any later version.
+ *
+ * This program is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ * GNU General Public License for more details.
+ *
+ * You should have received a copy of the GNU General Public License
+ * along with this program.  If not, see <http://www.gnu.org/licenses/>.
+ */
+
+package users
+
+import (
+	"fmt"
+	"math"
+	"net"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/SuperGreenLab/AppBackend/internal/data/kv"
+	"github.com/SuperGreenLab/AppBackend/internal/server/apierrors"
+	"github.com/SuperGreenLab/AppBackend/internal/server/middlewares"
+	"github.com/SuperGreenLab/AppBackend/internal/services/prometheus"
+	"github.com/gofrs/uuid"
+	"github.com/julienschmidt/httprouter"
+	"github.com/sirupsen/logrus"
+	"github.com/spf13/pflag"
+	"github.com/spf13/viper"
+)
+
+var (
+	_ = pflag.String("loginmaxattempts", "5", "Failed logins allowed for a handle before it gets locked")
+	_ = pflag.String("loginipmaxattempts", "20", "Failed logins allowed for an IP before it gets locked")
+	_ = pflag.String("loginlockout", "1m", "First lockout duration, doubled on each new failure")
+	_ = pflag.String("loginmaxlockout", "1h", "Maximum lockout duration")
+	_ = pflag.String("trustcfconnectingip", "false", "Use the CF-Connecting-IP header as client IP, only set when behind cloudflare")
+)
+
+func init() {
+	viper.SetDefault("LoginMaxAttempts", "5")
+	viper.SetDefault("LoginIPMaxAttempts", "20")
+	viper.SetDefault("LoginLockout", "1m")
+	viper.SetDefault("LoginMaxLockout", "1h")
+	viper.SetDefault("TrustCFConnectingIP", "false")
+}
+
+// ErrTooManyAttempts - error code sent with the 429 responses
+const ErrTooManyAttempts = apierrors.CodeTooManyAttempts
+
+type tooManyAttemptsDetails struct {
+	RetryAfter int `json:"retryAfter"`
+}
+
+// requestIP - CF-Connecting-IP can be set by any client, it's only honored when we're behind cloudflare
+func requestIP(r *http.Request) string {
+	if viper.GetString("TrustCFConnectingIP") == "true" {
+		if ip := r.Header.Get("CF-Connecting-IP"); ip != "" {
+			return ip
+		}
+	}
+	host, _, err := net.SplitHostPort(r.RemoteAddr)
+	if err != nil {
+		return r.RemoteAddr
+	}
+	return host
+}
+
+func handleKey(handle string) string {
+	return fmt.Sprintf("HANDLE.%s", handle)
+}
+
+// passwordResetKey - each reset request counts as a failure, so a handle's inbox can't be flooded
+func passwordResetKey(handle string) string {
+	return fmt.Sprintf("RESET.%s", handle)
+}
+
+func twoFactorKey(uid uuid.UUID) string {
+	return fmt.Sprintf("2FA.%s", uid)
+}
+
+func ipKey(r *http.Request) string {
+	return fmt.Sprintf("IP.%s", requestIP(r))
+}
+
+func loginMaxAttempts() (int64, int64) {
+	return viper.GetInt64("LoginMaxAttempts"), viper.GetInt64("LoginIPMaxAttempts")
+}
+
+// lockoutDuration - exponential backoff once the max attempts is reached
+func lockoutDuration(failures, maxAttempts int64) time.Duration {
+	if failures < maxAttempts {
+		return 0
+	}
+	base, max := viper.GetDuration("LoginLockout"), viper.GetDuration("LoginMaxLockout")
+	d := time.Duration(float64(base) * math.Pow(2, float64(failures-maxAttempts)))
+	if d > max || d <= 0 {
+		d = max
+	}
+	return d
+}
+
+func tooManyAttempts(w http.ResponseWriter, retryAfter time.Duration) {
+	seconds := int(math.Ceil(retryAfter.Seconds()))
+	w.Header().Set("Retry-After", strconv.Itoa(seconds))
+	apierrors.Write(w, apierrors.New(http.StatusTooManyRequests, ErrTooManyAttempts, "Too many attempts").WithDetails(tooManyAttemptsDetails{RetryAfter: seconds}))
+}
+
+// loginThrottle - rejects the login attempts of locked handles and IPs
+func loginThrottle(fn httprouter.Handle) httprouter.Handle {
+	return func(w http.ResponseWriter, r *http.Request, p httprouter.Params) {
+		lp := r.Context().Value(middlewares.ObjectContextKey{}).(*loginParams)
+		handle := strings.ToLower(strings.Replace(lp.Handle, " ", "", -1))
+
+		if loginLocked(w, handleKey(handle), ipKey(r)) {
+			return
+		}
+
+		fn(w, r, p)
+	}
+}
+
+// loginLocked - answers with a 429 if one of the keys is locked
+func loginLocked(w http.ResponseWriter, keys ...string) bool {
+	for _, key := range keys {
+		d, err := kv.GetLoginLock(key)
+		if err != nil {
+			logrus.Errorf("kv.GetLoginLock in loginLocked %q - key: %s", err, key)
+			continue
+		}
+		if d > 0 {
+			prometheus.LoginFailed("locked")
+			logrus.Warnf("Login locked - key: %s retryAfter: %s", key, d)
+			tooManyAttempts(w, d)
+			return true
+		}
+	}
+	return false
+}
+
+// loginFailed - counts the failure for both the key and the IP, and locks them once they reach their max attempts
+func loginFailed(r *http.Request, failedKey, reason string) {
+	prometheus.LoginFailed(reason)
+
+	maxHandle, maxIP := loginMaxAttempts()
+	for key, maxAttempts := range map[string]int64{failedKey: maxHandle, ipKey(r): maxIP} {
+		failures, err := kv.IncrLoginFailures(key, 24*time.Hour)
+		if err != nil {
+			logrus.Errorf("kv.IncrLoginFailures in loginFailed %q - key: %s", err, key)
+			continue
+		}
+		if d := lockoutDuration(failures, maxAttempts); d > 0 {
+			if err := kv.SetLoginLock(key, d); err != nil {
+				logrus.Errorf("kv.SetLoginLock in loginFailed %q - key: %s", err, key)
+			}
+		}
+	}
+}
+
+// loginSucceeded - only the key is reset, a successful login doesn't clear an IP that tried other handles
+func loginSucceeded(key string) {
+	if err := kv.ResetLoginFailures(key); err != nil {
+		logrus.Errorf("kv.ResetLoginFailures in loginSucceeded %q - key: %s", err, key)
+	}
+}
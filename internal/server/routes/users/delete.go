@@ -0,0 +1,93 @@
+/*
+ * Copyright (C) 2021  SuperGreenLab <towelie@supergreenlab.com>
+ * Author: Constantin Clauzel <constantin.clauzel@gmail.com>
+ *
+ * This program is free software: you can redistribute it and/or modify
+ * it under the terms of the GNU General Public License as published by
+ * the Free Software Foundation, either version 3 of the License, or
+ * (at your option) any later version.
+ *
+ * This program is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ * GNU General Public License for more details.
+ *
+ * You should have received a copy of the GNU General Public License
+ * along with this program.  If not, see <http://www.gnu.org/licenses/>.
+ */
+
+package users
+
+import (
+	"net/http"
+	"time"
+
+	"github.com/SuperGreenLab/AppBackend/internal/data/db"
+	"github.com/SuperGreenLab/AppBackend/internal/server/apierrors"
+	"github.com/SuperGreenLab/AppBackend/internal/server/middlewares"
+	"github.com/gofrs/uuid"
+	"github.com/julienschmidt/httprouter"
+	"github.com/rileyr/middleware"
+	"github.com/sirupsen/logrus"
+	"github.com/spf13/pflag"
+	"github.com/spf13/viper"
+	"golang.org/x/crypto/bcrypt"
+	"upper.io/db.v3/lib/sqlbuilder"
+)
+
+var (
+	_ = pflag.String("userpurgedelay", "72h", "Delay between the account deletion and the purge of the user's data")
+)
+
+func init() {
+	viper.SetDefault("UserPurgeDelay", "72h")
+}
+
+type deleteUserParams struct {
+	Password string `json:"password"`
+}
+
+// deleteUserHandler - logs the user out everywhere, the purge service then removes everything they own
+func deleteUserHandler() httprouter.Handle {
+	s := middleware.NewStack()
+
+	s.Use(middlewares.DecodeJSON(func() interface{} { return &deleteUserParams{} }))
+
+	return s.Wrap(func(w http.ResponseWriter, r *http.Request, p httprouter.Params) {
+		dup := r.Context().Value(middlewares.ObjectContextKey{}).(*deleteUserParams)
+		sess := r.Context().Value(middlewares.SessContextKey{}).(sqlbuilder.Database)
+		uid := r.Context().Value(middlewares.UserIDContextKey{}).(uuid.UUID)
+
+		u := db.User{}
+		if err := sess.Select("id", "password").From("users").Where("id = ?", uid).And("deleted = ?", false).One(&u); err != nil {
+			logrus.Errorf("sess.Select in deleteUserHandler %q - uid: %s", err, uid)
+			apierrors.Write(w, apierrors.Forbidden("Access denied"))
+			return
+		}
+		if err := bcrypt.CompareHashAndPassword([]byte(u.Password), []byte(dup.Password)); err != nil {
+			logrus.Errorf("bcrypt.CompareHashAndPassword in deleteUserHandler %q - uid: %s", err, uid)
+			apierrors.Write(w, apierrors.Forbidden("Access denied"))
+			return
+		}
+
+		if err := sess.Tx(r.Context(), func(tx sqlbuilder.Tx) error {
+			if _, err := tx.Exec("update users set deleted = true, purgeat = ? where id = ?", time.Now().Add(viper.GetDuration("UserPurgeDelay")), uid); err != nil {
+				return err
+			}
+			if _, err := tx.Update("refreshtokens").Set("revoked", true).Where("userid = ?", uid).Exec(); err != nil {
+				return err
+			}
+			if _, err := tx.Update("userends").Set("revoked", true, "notification_token", nil).Where("userid = ?", uid).Exec(); err != nil {
+				return err
+			}
+			_, err := tx.DeleteFrom("apikeys").Where("userid = ?", uid).Exec()
+			return err
+		}); err != nil {
+			logrus.Errorf("sess.Tx in deleteUserHandler %q - uid: %s", err, uid)
+			apierrors.Write(w, err)
+			return
+		}
+
+		w.WriteHeader(http.StatusOK)
+	})
+}
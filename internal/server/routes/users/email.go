@@ -0,0 +1,193 @@
+/*
+ * Copyright (C) 2021  SuperGreenLab <towelie@supergreenlab.com>
+ * Author: Constantin Clauzel <constantin.clauzel@gmail.com>
+ *
+ * This program is free software: you can redistribute it and/or modify
+ * it under the terms of the GNU General Public License as published by
+ * the Free Software Foundation, either version 3 of the License, or
+ * (at your option) any later version.
+ *
+ * This program is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ * GNU General Public License for more details.
+ *
+ * You should have received a copy of the GNU General Public License
+ * along with this program.  If not, see <http://www.gnu.org/licenses/>.
+ */
+
+package users
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"net/mail"
+	"strings"
+	"time"
+
+	"github.com/SuperGreenLab/AppBackend/internal/data/db"
+	"github.com/SuperGreenLab/AppBackend/internal/server/apierrors"
+	"github.com/SuperGreenLab/AppBackend/internal/server/middlewares"
+	"github.com/SuperGreenLab/AppBackend/internal/server/tools"
+	"github.com/SuperGreenLab/AppBackend/internal/services/mailer"
+	"github.com/gofrs/uuid"
+	"github.com/julienschmidt/httprouter"
+	"github.com/rileyr/middleware"
+	"github.com/sirupsen/logrus"
+	"github.com/spf13/pflag"
+	"github.com/spf13/viper"
+	"gopkg.in/guregu/null.v3"
+	"upper.io/db.v3/lib/sqlbuilder"
+)
+
+var (
+	_ = pflag.String("websiteurl", "https://www.supergreenlab.com", "Website base url, used for the links sent by email")
+)
+
+func init() {
+	viper.SetDefault("WebsiteURL", "https://www.supergreenlab.com")
+}
+
+var errInvalidUserToken = errors.New("Invalid or expired token")
+
+func createUserToken(sess sqlbuilder.Database, uid uuid.UUID, tokenType string, email null.String, ttl time.Duration) (string, error) {
+	token, err := tools.NewRandomToken()
+	if err != nil {
+		return "", err
+	}
+	ut := db.UserToken{
+		UserID:  uid,
+		Type:    tokenType,
+		Token:   tools.HashToken(token),
+		Email:   email,
+		Expires: time.Now().Add(ttl),
+	}
+	if _, err := sess.Collection("usertokens").Insert(ut); err != nil {
+		return "", err
+	}
+	return token, nil
+}
+
+// useUserToken - marks the token as used, fails if it was already used, expired or of another type
+func useUserToken(sess sqlbuilder.Database, token, tokenType string) (db.UserToken, error) {
+	ut := db.UserToken{}
+	if err := sess.Select("*").From("usertokens").Where("token = ?", tools.HashToken(token)).And("type = ?", tokenType).One(&ut); err != nil {
+		return ut, errInvalidUserToken
+	}
+	if ut.Used || ut.Expires.Before(time.Now()) {
+		return ut, errInvalidUserToken
+	}
+	res, err := sess.Update("usertokens").Set("used", true).Where("id = ?", ut.ID).And("used = ?", false).Exec()
+	if err != nil {
+		return ut, err
+	}
+	if n, err := res.RowsAffected(); err != nil || n == 0 {
+		return ut, errInvalidUserToken
+	}
+	return ut, nil
+}
+
+type setEmailParams struct {
+	Email string `json:"email"`
+}
+
+func setEmailHandler() httprouter.Handle {
+	s := middleware.NewStack()
+
+	s.Use(middlewares.DecodeJSON(func() interface{} { return &setEmailParams{} }))
+
+	return s.Wrap(func(w http.ResponseWriter, r *http.Request, p httprouter.Params) {
+		sep := r.Context().Value(middlewares.ObjectContextKey{}).(*setEmailParams)
+		sess := r.Context().Value(middlewares.SessContextKey{}).(sqlbuilder.Database)
+		uid := r.Context().Value(middlewares.UserIDContextKey{}).(uuid.UUID)
+
+		addr, err := mail.ParseAddress(strings.TrimSpace(sep.Email))
+		if err != nil || addr.Name != "" {
+			errorMsg := "Invalid email"
+			logrus.Errorf("%s - uid: %s email: %s", errorMsg, uid, sep.Email)
+			apierrors.Write(w, apierrors.BadRequest(errorMsg))
+			return
+		}
+		email := addr.Address
+
+		n, err := sess.Collection("users").Find().Where("lower(email) = lower(?)", email).And("id != ?", uid).Count()
+		if err != nil {
+			logrus.Errorf("sess.Collection in setEmailHandler %q - uid: %s", err, uid)
+			apierrors.Write(w, err)
+			return
+		}
+		if n > 0 {
+			errorMsg := "Email already used"
+			logrus.Errorf("%s - uid: %s email: %s", errorMsg, uid, email)
+			apierrors.Write(w, apierrors.BadRequest(errorMsg))
+			return
+		}
+
+		if _, err := sess.Update("users").Set("email", email, "emailverified", false).Where("id = ?", uid).Exec(); err != nil {
+			logrus.Errorf("sess.Update in setEmailHandler %q - uid: %s", err, uid)
+			apierrors.Write(w, err)
+			return
+		}
+
+		token, err := createUserToken(sess, uid, db.UserTokenEmailVerification, null.StringFrom(email), 24*time.Hour)
+		if err != nil {
+			logrus.Errorf("createUserToken in setEmailHandler %q - uid: %s", err, uid)
+			apierrors.Write(w, err)
+			return
+		}
+
+		if err := mailer.Send(mailer.Mail{
+			To:      email,
+			Subject: "Verify your email",
+			Body:    fmt.Sprintf("Hi,\n\nPlease verify your email by following this link:\n\n%s/verify-email?token=%s\n\nThe link expires in 24 hours.\n\nThe SuperGreenLab team", viper.GetString("WebsiteURL"), token),
+		}); err != nil {
+			logrus.Errorf("mailer.Send in setEmailHandler %q - uid: %s", err, uid)
+			apierrors.Write(w, err)
+			return
+		}
+
+		w.WriteHeader(http.StatusOK)
+	})
+}
+
+type verifyEmailParams struct {
+	Token string `json:"token"`
+}
+
+func verifyEmailHandler() httprouter.Handle {
+	s := middleware.NewStack()
+
+	s.Use(middlewares.DecodeJSON(func() interface{} { return &verifyEmailParams{} }))
+
+	return s.Wrap(func(w http.ResponseWriter, r *http.Request, p httprouter.Params) {
+		vep := r.Context().Value(middlewares.ObjectContextKey{}).(*verifyEmailParams)
+		sess := r.Context().Value(middlewares.SessContextKey{}).(sqlbuilder.Database)
+
+		ut, err := useUserToken(sess, vep.Token, db.UserTokenEmailVerification)
+		if err == errInvalidUserToken {
+			logrus.Errorf("useUserToken in verifyEmailHandler %q", err)
+			apierrors.Write(w, apierrors.BadRequest(err.Error()))
+			return
+		} else if err != nil {
+			logrus.Errorf("useUserToken in verifyEmailHandler %q", err)
+			apierrors.Write(w, err)
+			return
+		}
+
+		// The email might have been changed since the token was sent
+		res, err := sess.Update("users").Set("emailverified", true).Where("id = ?", ut.UserID).And("email = ?", ut.Email).Exec()
+		if err != nil {
+			logrus.Errorf("sess.Update in verifyEmailHandler %q - uid: %s", err, ut.UserID)
+			apierrors.Write(w, err)
+			return
+		}
+		if n, err := res.RowsAffected(); err != nil || n == 0 {
+			logrus.Errorf("%s - uid: %s", errInvalidUserToken, ut.UserID)
+			apierrors.Write(w, apierrors.BadRequest(errInvalidUserToken.Error()))
+			return
+		}
+
+		w.WriteHeader(http.StatusOK)
+	})
+}
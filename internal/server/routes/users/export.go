@@ -0,0 +1,106 @@
+/*
+ * Copyright (C) 2021  SuperGreenLab <towelie@supergreenlab.com>
+ * Author: Constantin Clauzel <constantin.clauzel@gmail.com>
+ *
+ * This program is free software: you can redistribute it and/or modify
+ * it under the terms of the GNU General Public License as published by
+ * the Free Software Foundation, either version 3 of the License, or
+ * (at your option) any later version.
+ *
+ * This program is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ * GNU General Public License for more details.
+ *
+ * You should have received a copy of the GNU General Public License
+ * along with this program.  If not, see <http://www.gnu.org/licenses/>.
+ */
+
+package users
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"time"
+
+	"github.com/SuperGreenLab/AppBackend/internal/data/db"
+	"github.com/SuperGreenLab/AppBackend/internal/data/storage"
+	"github.com/SuperGreenLab/AppBackend/internal/server/apierrors"
+	"github.com/SuperGreenLab/AppBackend/internal/server/middlewares"
+	"github.com/SuperGreenLab/AppBackend/internal/services/pubsub"
+	"github.com/gofrs/uuid"
+	"github.com/julienschmidt/httprouter"
+	"github.com/lib/pq"
+	"github.com/sirupsen/logrus"
+	"upper.io/db.v3/lib/sqlbuilder"
+)
+
+// createExportHandler - the archive is built by the exports service, its progress is available on GET /user/exports
+func createExportHandler(w http.ResponseWriter, r *http.Request, p httprouter.Params) {
+	sess := r.Context().Value(middlewares.SessContextKey{}).(sqlbuilder.Database)
+	uid := r.Context().Value(middlewares.UserIDContextKey{}).(uuid.UUID)
+
+	// ex_uid_in_progress only allows one pending or running export per user
+	e := &db.Export{UserID: uid, Status: db.ExportPending}
+	res, err := sess.Collection("exports").Insert(e)
+	if err != nil {
+		var pqErr *pq.Error
+		if errors.As(err, &pqErr) && pqErr.Code == "23505" {
+			errorMsg := "An export is already in progress"
+			logrus.Errorf("%s - uid: %s", errorMsg, uid)
+			apierrors.Write(w, apierrors.Conflict(errorMsg))
+			return
+		}
+		logrus.Errorf("sess.Collection in createExportHandler %q - uid: %s", err, uid)
+		apierrors.Write(w, err)
+		return
+	}
+	id := uuid.FromStringOrNil(string(res.([]uint8)))
+
+	middlewares.AfterCommit(r, func() {
+		if err := pubsub.PublishObject("insert.exports", middlewares.InsertMessage{ID: id, Object: e}); err != nil {
+			logrus.Errorf("pubsub.PublishObject in createExportHandler %q - uid: %s", err, uid)
+		}
+	})
+
+	ctx := context.WithValue(r.Context(), middlewares.InsertedIDContextKey{}, id)
+	middlewares.OutputObjectID(w, r.WithContext(ctx), p)
+}
+
+type exportsResult struct {
+	Exports []db.Export `json:"exports"`
+}
+
+// listExportsHandler - finished exports come with a presigned download url
+func listExportsHandler(w http.ResponseWriter, r *http.Request, p httprouter.Params) {
+	sess := r.Context().Value(middlewares.SessContextKey{}).(sqlbuilder.Database)
+	uid := r.Context().Value(middlewares.UserIDContextKey{}).(uuid.UUID)
+
+	res := exportsResult{Exports: []db.Export{}}
+	if err := sess.Select("*").From("exports").Where("userid = ?", uid).OrderBy("cat desc").All(&res.Exports); err != nil {
+		logrus.Errorf("sess.Select in listExportsHandler %q - uid: %s", err, uid)
+		apierrors.Write(w, err)
+		return
+	}
+
+	expiry := time.Second * 60 * 60
+	for i, e := range res.Exports {
+		if e.Status != db.ExportDone || !e.FilePath.Valid {
+			continue
+		}
+		url1, err := storage.Client.PresignedGetObject("exports", e.FilePath.String, expiry, nil)
+		if err != nil {
+			logrus.Errorf("storage.Client.PresignedGetObject in listExportsHandler %q - uid: %s", err, uid)
+			continue
+		}
+		res.Exports[i].URL = url1.RequestURI()
+	}
+
+	if err := json.NewEncoder(w).Encode(res); err != nil {
+		logrus.Errorf("json.NewEncoder in listExportsHandler %q - uid: %s", err, uid)
+		apierrors.Write(w, err)
+		return
+	}
+}
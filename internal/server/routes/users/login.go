@@ -28,16 +28,17 @@ import (
 
 	"github.com/SuperGreenLab/AppBackend/internal/data/db"
 	"github.com/SuperGreenLab/AppBackend/internal/data/storage"
+	"github.com/SuperGreenLab/AppBackend/internal/server/apierrors"
 	"github.com/gofrs/uuid"
 	"gopkg.in/guregu/null.v3"
 
 	"github.com/SuperGreenLab/AppBackend/internal/server/middlewares"
+	"github.com/SuperGreenLab/AppBackend/internal/server/tools"
 
 	"github.com/dgrijalva/jwt-go"
 	"github.com/julienschmidt/httprouter"
 	"github.com/rileyr/middleware"
 	"github.com/sirupsen/logrus"
-	"github.com/spf13/viper"
 	"golang.org/x/crypto/bcrypt"
 	"upper.io/db.v3/lib/sqlbuilder"
 )
@@ -51,47 +52,75 @@ func loginHandler() httprouter.Handle {
 	s := middleware.NewStack()
 
 	s.Use(middlewares.DecodeJSON(func() interface{} { return &loginParams{} }))
+	s.Use(loginThrottle)
 
 	return s.Wrap(func(w http.ResponseWriter, r *http.Request, p httprouter.Params) {
-		hmacSampleSecret := []byte(viper.GetString("JWTSecret"))
 		lp := r.Context().Value(middlewares.ObjectContextKey{}).(*loginParams)
 		sess := r.Context().Value(middlewares.SessContextKey{}).(sqlbuilder.Database)
 
 		lp.Handle = strings.ToLower(strings.Replace(lp.Handle, " ", "", -1))
 
 		u := db.User{}
-		err := sess.Select("id", "password").From("users").Where("lower(replace(nickname, ' ', '')) = ?", lp.Handle).One(&u)
+		err := sess.Select("id", "password").From("users").Where("lower(replace(nickname, ' ', '')) = ?", lp.Handle).And("deleted = ?", false).One(&u)
 		if err != nil {
 			lp.Password = ""
 			logrus.Errorf("sess.Select in loginHandler %q - %+v", err, lp)
-			http.Error(w, "Access denied", http.StatusBadRequest)
+			loginFailed(r, handleKey(lp.Handle), "unknown_handle")
+			apierrors.Write(w, apierrors.Forbidden("Access denied"))
 			return
 		}
 		err = bcrypt.CompareHashAndPassword([]byte(u.Password), []byte(lp.Password))
 		if err != nil {
 			lp.Password = ""
 			logrus.Errorf("bcrypt.CompareHashAndPassword in loginHandler %q - %+v", err, lp)
-			http.Error(w, "Access denied", http.StatusBadRequest)
+			loginFailed(r, handleKey(lp.Handle), "wrong_password")
+			apierrors.Write(w, apierrors.Forbidden("Access denied"))
 			return
 		}
+		loginSucceeded(handleKey(lp.Handle))
 
-		token := jwt.NewWithClaims(jwt.SigningMethodHS256, jwt.MapClaims{
-			"userID": u.ID.UUID.String(),
-		})
-		tokenString, err := token.SignedString(hmacSampleSecret)
+		totpEnabled, err := hasTOTPEnabled(sess, u.ID.UUID)
 		if err != nil {
 			lp.Password = ""
-			logrus.Errorf("token.SignedString in loginHandler %q - %+v", err, lp)
-			http.Error(w, err.Error(), http.StatusInternalServerError)
+			logrus.Errorf("hasTOTPEnabled in loginHandler %q - %+v", err, lp)
+			apierrors.Write(w, err)
+			return
+		}
+		if totpEnabled {
+			challenge(w, u.ID.UUID)
 			return
 		}
 
-		w.Header().Set("x-sgl-token", tokenString)
+		if err := setLoginTokens(w, sess, u.ID.UUID); err != nil {
+			lp.Password = ""
+			logrus.Errorf("setLoginTokens in loginHandler %q - %+v", err, lp)
+			apierrors.Write(w, err)
+			return
+		}
 
 		w.WriteHeader(http.StatusOK)
 	})
 }
 
+// setLoginTokens - sets the x-sgl-token and x-sgl-refresh-token headers of a successful login
+func setLoginTokens(w http.ResponseWriter, sess sqlbuilder.Database, uid uuid.UUID) error {
+	tokenString, err := tools.NewAccessToken(jwt.MapClaims{
+		"userID": uid.String(),
+	})
+	if err != nil {
+		return err
+	}
+
+	refreshToken, err := tools.CreateRefreshToken(sess, uid, uuid.NullUUID{})
+	if err != nil {
+		return err
+	}
+
+	w.Header().Set("x-sgl-token", tokenString)
+	w.Header().Set("x-sgl-refresh-token", refreshToken)
+	return nil
+}
+
 var createUserHandler = middlewares.InsertEndpoint(
 	"users",
 	func() interface{} { return &db.User{} },
@@ -100,29 +129,21 @@ var createUserHandler = middlewares.InsertEndpoint(
 			return func(w http.ResponseWriter, r *http.Request, p httprouter.Params) {
 				u := r.Context().Value(middlewares.ObjectContextKey{}).(*db.User)
 				sess := r.Context().Value(middlewares.SessContextKey{}).(sqlbuilder.Database)
-				u.Nickname = strings.Trim(u.Nickname, " ")
-				if len(u.Nickname) < 4 || len(u.Nickname) > 21 {
-					errorMsg := "Nickname length should be between 5 and 21 caracters"
-					u.Password = ""
-					logrus.Errorf("%q - %+v", errorMsg, u)
-					http.Error(w, errorMsg, http.StatusBadRequest)
-					return
-				}
+				// Emails are set and verified through PUT /user/email
+				u.Email = null.String{}
+				u.EmailVerified = false
 
-				nickname := strings.ToLower(strings.Replace(u.Nickname, " ", "", -1))
-				n, err := sess.Collection("users").Find().Where("lower(replace(nickname, ' ', '')) = ?", nickname).Count() // TODO this is stupid
-				if err != nil {
+				nickname, err := checkNickname(sess, u.Nickname, uuid.NullUUID{})
+				u.Nickname = nickname
+				if err == errNicknameLength || err == errNicknameTaken {
 					u.Password = ""
 					logrus.Errorf("%q - %+v", err, u)
-					http.Error(w, err.Error(), http.StatusInternalServerError)
+					apierrors.Write(w, apierrors.BadRequest(err.Error()))
 					return
-				}
-
-				if n > 0 {
-					errorMsg := "User already exists"
+				} else if err != nil {
 					u.Password = ""
-					logrus.Errorf("%q - %+v", errorMsg, u)
-					http.Error(w, errorMsg, http.StatusBadRequest)
+					logrus.Errorf("%q - %+v", err, u)
+					apierrors.Write(w, err)
 					return
 				}
 
@@ -130,7 +151,7 @@ var createUserHandler = middlewares.InsertEndpoint(
 				u.Password = string(bc)
 				if err != nil {
 					logrus.Errorf("bcrypt.GenerateFromPassword in createUserHandler %q - %+v", err, u)
-					http.Error(w, err.Error(), http.StatusInternalServerError)
+					apierrors.Write(w, err)
 					return
 				}
 				fn(w, r, p)
@@ -153,7 +174,7 @@ var updateUserHandler = middlewares.UpdateEndpoint(
 				user := &db.User{}
 				if err := sess.Select("*").From("users").Where("id = ?", uid).One(user); err != nil {
 					logrus.Errorf("sess.Select in updateUserHandler %q - %+v", err, u)
-					http.Error(w, err.Error(), http.StatusInternalServerError)
+					apierrors.Write(w, err)
 					return
 				}
 				user.Pic = u.Pic
@@ -174,7 +195,7 @@ func meHandler(w http.ResponseWriter, r *http.Request, p httprouter.Params) {
 	err := sess.Collection("users").Find().Where("id = ?", uid).One(&user)
 	if err != nil {
 		logrus.Errorln(err.Error())
-		http.Error(w, err.Error(), http.StatusInternalServerError)
+		apierrors.Write(w, err)
 		return
 	}
 	user.Password = "" // TODO split model private/public fields?
@@ -192,7 +213,7 @@ func meHandler(w http.ResponseWriter, r *http.Request, p httprouter.Params) {
 
 	if err := json.NewEncoder(w).Encode(user); err != nil {
 		logrus.Errorf("json.NewEncoder in meHandler %q - %+v", err, user)
-		http.Error(w, err.Error(), http.StatusInternalServerError)
+		apierrors.Write(w, err)
 		return
 	}
 }
@@ -210,14 +231,14 @@ func profilePicUploadURLHandler(w http.ResponseWriter, r *http.Request, p httpro
 	url1, err := storage.Client.PresignedPutObject("users", path, expiry)
 	if err != nil {
 		logrus.Errorln(err)
-		http.Error(w, err.Error(), http.StatusInternalServerError)
+		apierrors.Write(w, err)
 		return
 	}
 	res.FilePath = url1.RequestURI()
 
 	if err := json.NewEncoder(w).Encode(res); err != nil {
 		logrus.Errorln(err)
-		http.Error(w, err.Error(), http.StatusInternalServerError)
+		apierrors.Write(w, err)
 		return
 	}
 }
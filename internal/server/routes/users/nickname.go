@@ -0,0 +1,153 @@
+/*
+ * Copyright (C) 2021  SuperGreenLab <towelie@supergreenlab.com>
+ * Author: Constantin Clauzel <constantin.clauzel@gmail.com>
+ *
+ * This program is free software: you can redistribute it and/or modify
+ * it under the terms of the GNU General Public License as published by
+ * the Free Software Foundation, either version 3 of the License, or
+ * (at your option) any later version.
+ *
+ * This program is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ * GNU General Public License for more details.
+ *
+ * You should have received a copy of the GNU General Public License
+ * along with this program.  If not, see <http://www.gnu.org/licenses/>.
+ */
+
+package users
+
+import (
+	"errors"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/SuperGreenLab/AppBackend/internal/data/db"
+	"github.com/SuperGreenLab/AppBackend/internal/server/apierrors"
+	"github.com/SuperGreenLab/AppBackend/internal/server/middlewares"
+	"github.com/gofrs/uuid"
+	"github.com/julienschmidt/httprouter"
+	"github.com/rileyr/middleware"
+	"github.com/sirupsen/logrus"
+	"github.com/spf13/pflag"
+	"github.com/spf13/viper"
+	udb "upper.io/db.v3"
+	"upper.io/db.v3/lib/sqlbuilder"
+)
+
+var (
+	_ = pflag.String("nicknamechangedelay", "720h", "Minimum delay between two nickname changes")
+)
+
+func init() {
+	viper.SetDefault("NicknameChangeDelay", "720h")
+}
+
+var (
+	errNicknameLength = errors.New("Nickname length should be between 5 and 21 caracters")
+	errNicknameTaken  = errors.New("User already exists")
+)
+
+// checkNickname - returns the trimmed nickname, old nicknames of other users are reserved so mentions keep resolving.
+// uid is null when there is no user yet, uuid.Nil is the anonymous user and must never be skipped
+func checkNickname(sess sqlbuilder.Database, nickname string, uid uuid.NullUUID) (string, error) {
+	nickname = strings.Trim(nickname, " ")
+	if len(nickname) < 4 || len(nickname) > 21 {
+		return nickname, errNicknameLength
+	}
+
+	handle := strings.ToLower(strings.Replace(nickname, " ", "", -1))
+	users := sess.Collection("users").Find().Where("lower(replace(nickname, ' ', '')) = ?", handle)
+	if uid.Valid {
+		users = users.And("id != ?", uid.UUID)
+	}
+	n, err := users.Count() // TODO this is stupid
+	if err != nil {
+		return nickname, err
+	}
+	if n > 0 {
+		return nickname, errNicknameTaken
+	}
+
+	nicknames := sess.Collection("nicknames").Find().Where("lower(replace(nickname, ' ', '')) = ?", handle)
+	if uid.Valid {
+		nicknames = nicknames.And("userid != ?", uid.UUID)
+	}
+	n, err = nicknames.Count()
+	if err != nil {
+		return nickname, err
+	}
+	if n > 0 {
+		return nickname, errNicknameTaken
+	}
+	return nickname, nil
+}
+
+type setNicknameParams struct {
+	Nickname string `json:"nickname"`
+}
+
+// setNicknameHandler - the previous nickname is kept in the nicknames table
+func setNicknameHandler() httprouter.Handle {
+	s := middleware.NewStack()
+
+	s.Use(middlewares.DecodeJSON(func() interface{} { return &setNicknameParams{} }))
+
+	return s.Wrap(func(w http.ResponseWriter, r *http.Request, p httprouter.Params) {
+		snp := r.Context().Value(middlewares.ObjectContextKey{}).(*setNicknameParams)
+		sess := r.Context().Value(middlewares.SessContextKey{}).(sqlbuilder.Database)
+		uid := r.Context().Value(middlewares.UserIDContextKey{}).(uuid.UUID)
+
+		u := db.User{}
+		if err := sess.Select("id", "nickname").From("users").Where("id = ?", uid).And("deleted = ?", false).One(&u); err != nil {
+			logrus.Errorf("sess.Select in setNicknameHandler %q - uid: %s", err, uid)
+			apierrors.Write(w, err)
+			return
+		}
+
+		nickname, err := checkNickname(sess, snp.Nickname, uuid.NullUUID{UUID: uid, Valid: true})
+		if err == errNicknameLength || err == errNicknameTaken {
+			logrus.Errorf("checkNickname in setNicknameHandler %q - uid: %s nickname: %s", err, uid, snp.Nickname)
+			apierrors.Write(w, apierrors.BadRequest(err.Error()))
+			return
+		} else if err != nil {
+			logrus.Errorf("checkNickname in setNicknameHandler %q - uid: %s", err, uid)
+			apierrors.Write(w, err)
+			return
+		}
+		if nickname == u.Nickname {
+			w.WriteHeader(http.StatusOK)
+			return
+		}
+
+		last := db.Nickname{}
+		err = sess.Select("cat").From("nicknames").Where("userid = ?", uid).OrderBy("cat DESC").One(&last)
+		if err != nil && err != udb.ErrNoMoreRows {
+			logrus.Errorf("sess.Select in setNicknameHandler %q - uid: %s", err, uid)
+			apierrors.Write(w, err)
+			return
+		} else if err == nil {
+			if d := time.Until(last.CreatedAt.Add(viper.GetDuration("NicknameChangeDelay"))); d > 0 {
+				logrus.Warnf("Nickname changed too recently - uid: %s retryAfter: %s", uid, d)
+				tooManyAttempts(w, d)
+				return
+			}
+		}
+
+		if err := sess.Tx(r.Context(), func(tx sqlbuilder.Tx) error {
+			if _, err := tx.InsertInto("nicknames").Values(db.Nickname{UserID: uid, Nickname: u.Nickname}).Exec(); err != nil {
+				return err
+			}
+			_, err := tx.Update("users").Set("nickname", nickname).Where("id = ?", uid).Exec()
+			return err
+		}); err != nil {
+			logrus.Errorf("sess.Tx in setNicknameHandler %q - uid: %s", err, uid)
+			apierrors.Write(w, err)
+			return
+		}
+
+		w.WriteHeader(http.StatusOK)
+	})
+}
@@ -0,0 +1,147 @@
+/*
+ * Copyright (C) 2021  SuperGreenLab <towelie@supergreenlab.com>
+ * Author: Constantin Clauzel <constantin.clauzel@gmail.com>
+ *
+ * This program is free software: you can redistribute it and/or modify
+ * it under the terms of the GNU General Public License as published by
+ * the Free Software Foundation, either version 3 of the License, or
+ * (at your option) any later version.
+ *
+ * This program is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ * GNU General Public License for more details.
+ *
+ * You should have received a copy of the GNU General Public License
+ * along with this program.  If not, see <http://www.gnu.org/licenses/>.
+ */
+
+package users
+
+import (
+	"fmt"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/SuperGreenLab/AppBackend/internal/data/db"
+	"github.com/SuperGreenLab/AppBackend/internal/server/apierrors"
+	"github.com/SuperGreenLab/AppBackend/internal/server/middlewares"
+	"github.com/SuperGreenLab/AppBackend/internal/services/mailer"
+	"github.com/julienschmidt/httprouter"
+	"github.com/rileyr/middleware"
+	"github.com/sirupsen/logrus"
+	"github.com/spf13/viper"
+	"golang.org/x/crypto/bcrypt"
+	"gopkg.in/guregu/null.v3"
+	udb "upper.io/db.v3"
+	"upper.io/db.v3/lib/sqlbuilder"
+)
+
+type forgotPasswordParams struct {
+	Handle string `json:"handle"`
+}
+
+// forgotPasswordHandler - always answers 200, whether the user exists or not
+func forgotPasswordHandler() httprouter.Handle {
+	s := middleware.NewStack()
+
+	s.Use(middlewares.DecodeJSON(func() interface{} { return &forgotPasswordParams{} }))
+
+	return s.Wrap(func(w http.ResponseWriter, r *http.Request, p httprouter.Params) {
+		fpp := r.Context().Value(middlewares.ObjectContextKey{}).(*forgotPasswordParams)
+		sess := r.Context().Value(middlewares.SessContextKey{}).(sqlbuilder.Database)
+
+		handle := strings.ToLower(strings.Replace(fpp.Handle, " ", "", -1))
+
+		if loginLocked(w, passwordResetKey(handle), ipKey(r)) {
+			return
+		}
+		loginFailed(r, passwordResetKey(handle), "password_reset")
+
+		// A nickname can be equal to another user's email, the email always wins
+		u := db.User{}
+		err := sess.Select("id", "nickname", "email").From("users").Where("emailverified = ?", true).And("deleted = ?", false).And("lower(email) = ?", handle).One(&u)
+		if err == udb.ErrNoMoreRows {
+			err = sess.Select("id", "nickname", "email").From("users").Where("emailverified = ?", true).And("deleted = ?", false).And("lower(replace(nickname, ' ', '')) = ?", handle).One(&u)
+		}
+		if err != nil {
+			logrus.Errorf("sess.Select in forgotPasswordHandler %q - %+v", err, fpp)
+			w.WriteHeader(http.StatusOK)
+			return
+		}
+
+		token, err := createUserToken(sess, u.ID.UUID, db.UserTokenPasswordReset, null.String{}, time.Hour)
+		if err != nil {
+			logrus.Errorf("createUserToken in forgotPasswordHandler %q - uid: %s", err, u.ID.UUID)
+			apierrors.Write(w, err)
+			return
+		}
+
+		if err := mailer.Send(mailer.Mail{
+			To:      u.Email.String,
+			Subject: "Reset your password",
+			Body:    fmt.Sprintf("Hi %s,\n\nSomeone asked to reset the password of your account, follow this link to choose a new one:\n\n%s/reset-password?token=%s\n\nThe link expires in one hour, just ignore this email if you did not ask for it.\n\nThe SuperGreenLab team", u.Nickname, viper.GetString("WebsiteURL"), token),
+		}); err != nil {
+			logrus.Errorf("mailer.Send in forgotPasswordHandler %q - uid: %s", err, u.ID.UUID)
+			apierrors.Write(w, err)
+			return
+		}
+
+		w.WriteHeader(http.StatusOK)
+	})
+}
+
+type resetPasswordParams struct {
+	Token    string `json:"token"`
+	Password string `json:"password"`
+}
+
+func resetPasswordHandler() httprouter.Handle {
+	s := middleware.NewStack()
+
+	s.Use(middlewares.DecodeJSON(func() interface{} { return &resetPasswordParams{} }))
+
+	return s.Wrap(func(w http.ResponseWriter, r *http.Request, p httprouter.Params) {
+		rpp := r.Context().Value(middlewares.ObjectContextKey{}).(*resetPasswordParams)
+		sess := r.Context().Value(middlewares.SessContextKey{}).(sqlbuilder.Database)
+
+		if rpp.Password == "" {
+			errorMsg := "Password can't be empty"
+			logrus.Errorf("%s", errorMsg)
+			apierrors.Write(w, apierrors.BadRequest(errorMsg))
+			return
+		}
+
+		ut, err := useUserToken(sess, rpp.Token, db.UserTokenPasswordReset)
+		if err == errInvalidUserToken {
+			logrus.Errorf("useUserToken in resetPasswordHandler %q", err)
+			apierrors.Write(w, apierrors.BadRequest(err.Error()))
+			return
+		} else if err != nil {
+			logrus.Errorf("useUserToken in resetPasswordHandler %q", err)
+			apierrors.Write(w, err)
+			return
+		}
+
+		bc, err := bcrypt.GenerateFromPassword([]byte(rpp.Password), 8)
+		if err != nil {
+			logrus.Errorf("bcrypt.GenerateFromPassword in resetPasswordHandler %q - uid: %s", err, ut.UserID)
+			apierrors.Write(w, err)
+			return
+		}
+
+		if _, err := sess.Update("users").Set("password", string(bc)).Where("id = ?", ut.UserID).Exec(); err != nil {
+			logrus.Errorf("sess.Update in resetPasswordHandler %q - uid: %s", err, ut.UserID)
+			apierrors.Write(w, err)
+			return
+		}
+
+		// Logs out every device once their access token expires
+		if _, err := sess.Update("refreshtokens").Set("revoked", true).Where("userid = ?", ut.UserID).Exec(); err != nil {
+			logrus.Errorf("sess.Update in resetPasswordHandler %q - uid: %s", err, ut.UserID)
+		}
+
+		w.WriteHeader(http.StatusOK)
+	})
+}
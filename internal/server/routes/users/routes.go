@@ -20,6 +20,7 @@ package users
 
 import (
 	cmiddlewares "github.com/SuperGreenLab/AppBackend/internal/server/middlewares"
+	fmiddlewares "github.com/SuperGreenLab/AppBackend/internal/server/routes/feeds/middlewares"
 	"github.com/julienschmidt/httprouter"
 )
 
@@ -27,13 +28,40 @@ import (
 func Init(router *httprouter.Router) {
 	anon := cmiddlewares.AnonStack()
 	auth := cmiddlewares.AuthStack()
+	authWithUserEnd := fmiddlewares.AuthStackWithOptUserEnd()
+
+	userRead := cmiddlewares.RequireScope(cmiddlewares.ScopeUserRead)
+	userWrite := cmiddlewares.RequireScope(cmiddlewares.ScopeUserWrite)
+	account := cmiddlewares.RequireScope(cmiddlewares.ScopeAccount)
 
 	router.POST("/login", anon.Wrap(loginHandler()))
+	router.POST("/login/2fa", anon.Wrap(login2FAHandler()))
 	router.POST("/user", anon.Wrap(createUserHandler))
+	router.POST("/token/refresh", anon.Wrap(refreshTokenHandler()))
+	router.POST("/user/password/forgot", anon.Wrap(forgotPasswordHandler()))
+	router.POST("/user/password/reset", anon.Wrap(resetPasswordHandler()))
+	router.POST("/user/email/verify", anon.Wrap(verifyEmailHandler()))
+
+	router.PUT("/user", auth.Wrap(userWrite(updateUserHandler)))
+	router.PUT("/user/email", auth.Wrap(account(setEmailHandler())))
+	router.PUT("/user/nickname", auth.Wrap(userWrite(setNicknameHandler())))
+	router.GET("/users/me", auth.Wrap(userRead(meHandler))) // TODO remove this one:/
+	router.GET("/user/me", auth.Wrap(userRead(meHandler)))
+	router.DELETE("/user/me", auth.Wrap(account(deleteUserHandler())))
+
+	router.GET("/user/sessions", authWithUserEnd.Wrap(account(listSessionsHandler)))
+	router.DELETE("/user/sessions/:id", authWithUserEnd.Wrap(account(revokeSessionHandler)))
+
+	router.POST("/user/2fa/enroll", auth.Wrap(account(enrollTOTPHandler)))
+	router.POST("/user/2fa/verify", auth.Wrap(account(verifyTOTPHandler())))
+	router.POST("/user/2fa/disable", auth.Wrap(account(disableTOTPHandler())))
+
+	router.POST("/user/export", auth.Wrap(account(cmiddlewares.Transaction(createExportHandler))))
+	router.GET("/user/exports", auth.Wrap(account(listExportsHandler)))
 
-	router.PUT("/user", auth.Wrap(updateUserHandler))
-	router.GET("/users/me", auth.Wrap(meHandler)) // TODO remove this one:/
-	router.GET("/user/me", auth.Wrap(meHandler))
+	router.GET("/apikeys", auth.Wrap(account(listAPIKeysHandler)))
+	router.POST("/apikey", auth.Wrap(account(createAPIKeyHandler())))
+	router.DELETE("/apikey/:id", auth.Wrap(account(deleteAPIKeyHandler)))
 
-	router.POST("/profilePicUploadURL", auth.Wrap(profilePicUploadURLHandler))
+	router.POST("/profilePicUploadURL", auth.Wrap(userWrite(profilePicUploadURLHandler)))
 }
@@ -0,0 +1,112 @@
+/*
+ * Copyright (C) 2021  SuperGreenLab <towelie@supergreenlab.com>
+ * Author: Constantin Clauzel <constantin.clauzel@gmail.com>
+ *
+ * This program is free software: you can redistribute it and/or modify
+ * it under the terms of the GNU General Public License as published by
+ * the Free Software Foundation, either version 3 of the License, or
+ * (at your option) any later version.
+ *
+ * This program is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ * GNU General Public License for more details.
+ *
+ * You should have received a copy of the GNU General Public License
+ * along with this program.  If not, see <http://www.gnu.org/licenses/>.
+ */
+
+package users
+
+import (
+	"encoding/json"
+	"net/http"
+	"time"
+
+	"github.com/SuperGreenLab/AppBackend/internal/data/db"
+	"github.com/SuperGreenLab/AppBackend/internal/server/apierrors"
+	"github.com/SuperGreenLab/AppBackend/internal/server/middlewares"
+	fmiddlewares "github.com/SuperGreenLab/AppBackend/internal/server/routes/feeds/middlewares"
+	"github.com/gofrs/uuid"
+	"github.com/julienschmidt/httprouter"
+	"github.com/sirupsen/logrus"
+	"gopkg.in/guregu/null.v3"
+	"upper.io/db.v3/lib/sqlbuilder"
+)
+
+type session struct {
+	ID                   uuid.UUID `json:"id"`
+	LastSeen             null.Time `json:"lastSeen"`
+	HasNotificationToken bool      `json:"hasNotificationToken"`
+	Current              bool      `json:"current"`
+	CreatedAt            time.Time `json:"cat"`
+}
+
+type sessionsResult struct {
+	Sessions []session `json:"sessions"`
+}
+
+func listSessionsHandler(w http.ResponseWriter, r *http.Request, p httprouter.Params) {
+	sess := r.Context().Value(middlewares.SessContextKey{}).(sqlbuilder.Database)
+	uid := r.Context().Value(middlewares.UserIDContextKey{}).(uuid.UUID)
+	ueid, _ := r.Context().Value(fmiddlewares.UserEndIDContextKey{}).(uuid.UUID)
+
+	userEnds := []db.UserEnd{}
+	if err := sess.Select("*").From("userends").Where("userid = ?", uid).And("revoked = ?", false).OrderBy("lastseen desc nulls last", "cat desc").All(&userEnds); err != nil {
+		logrus.Errorf("sess.Select in listSessionsHandler %q - uid: %s", err, uid)
+		apierrors.Write(w, err)
+		return
+	}
+
+	res := sessionsResult{Sessions: make([]session, 0, len(userEnds))}
+	for _, ue := range userEnds {
+		res.Sessions = append(res.Sessions, session{
+			ID:                   ue.ID.UUID,
+			LastSeen:             ue.LastSeen,
+			HasNotificationToken: ue.NotificationToken.Valid && ue.NotificationToken.String != "",
+			Current:              ue.ID.UUID == ueid,
+			CreatedAt:            ue.CreatedAt,
+		})
+	}
+
+	if err := json.NewEncoder(w).Encode(res); err != nil {
+		logrus.Errorf("json.NewEncoder in listSessionsHandler %q - %+v", err, res)
+		apierrors.Write(w, err)
+		return
+	}
+}
+
+func revokeSessionHandler(w http.ResponseWriter, r *http.Request, p httprouter.Params) {
+	sess := r.Context().Value(middlewares.SessContextKey{}).(sqlbuilder.Database)
+	uid := r.Context().Value(middlewares.UserIDContextKey{}).(uuid.UUID)
+
+	id, err := uuid.FromString(p.ByName("id"))
+	if err != nil {
+		logrus.Errorf("uuid.FromString in revokeSessionHandler %q - id: %s", err, p.ByName("id"))
+		apierrors.Write(w, apierrors.BadRequest("Invalid id"))
+		return
+	}
+
+	n, err := sess.Collection("userends").Find().Where("id = ?", id).And("userid = ?", uid).And("revoked = ?", false).Count()
+	if err != nil {
+		logrus.Errorf("sess.Collection in revokeSessionHandler %q - id: %s uid: %s", err, id, uid)
+		apierrors.Write(w, err)
+		return
+	}
+	if n == 0 {
+		errorMsg := "Unknown session"
+		logrus.Errorf("%s - id: %s uid: %s", errorMsg, id, uid)
+		apierrors.Write(w, apierrors.NotFound(errorMsg))
+		return
+	}
+
+	if err := sess.Tx(r.Context(), func(tx sqlbuilder.Tx) error {
+		return db.RevokeUserEnd(tx, id)
+	}); err != nil {
+		logrus.Errorf("db.RevokeUserEnd in revokeSessionHandler %q - id: %s uid: %s", err, id, uid)
+		apierrors.Write(w, err)
+		return
+	}
+
+	w.WriteHeader(http.StatusOK)
+}
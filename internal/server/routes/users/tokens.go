@@ -0,0 +1,113 @@
+/*
+ * Copyright (C) 2021  SuperGreenLab <towelie@supergreenlab.com>
+ * Author: Constantin Clauzel <constantin.clauzel@gmail.com>
+ *
+ * This program is free software: you can redistribute it and/or modify
+ * it under the terms of the GNU General Public License as published by
+ * the Free Software Foundation, either version 3 of the License, or
+ * (at your option) any later version.
+ *
+ * This program is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ * GNU General Public License for more details.
+ *
+ * You should have received a copy of the GNU General Public License
+ * along with this program.  If not, see <http://www.gnu.org/licenses/>.
+ */
+
+package users
+
+import (
+	"net/http"
+	"time"
+
+	"github.com/SuperGreenLab/AppBackend/internal/data/db"
+	"github.com/SuperGreenLab/AppBackend/internal/server/apierrors"
+	"github.com/SuperGreenLab/AppBackend/internal/server/middlewares"
+	"github.com/SuperGreenLab/AppBackend/internal/server/tools"
+	"github.com/dgrijalva/jwt-go"
+	"github.com/julienschmidt/httprouter"
+	"github.com/rileyr/middleware"
+	"github.com/sirupsen/logrus"
+	"upper.io/db.v3/lib/sqlbuilder"
+)
+
+type refreshTokenParams struct {
+	RefreshToken string `json:"refreshToken"`
+}
+
+func refreshTokenHandler() httprouter.Handle {
+	s := middleware.NewStack()
+
+	s.Use(middlewares.DecodeJSON(func() interface{} { return &refreshTokenParams{} }))
+
+	return s.Wrap(func(w http.ResponseWriter, r *http.Request, p httprouter.Params) {
+		rtp := r.Context().Value(middlewares.ObjectContextKey{}).(*refreshTokenParams)
+		sess := r.Context().Value(middlewares.SessContextKey{}).(sqlbuilder.Database)
+
+		rt := db.RefreshToken{}
+		err := sess.Select("*").From("refreshtokens").Where("token = ?", tools.HashToken(rtp.RefreshToken)).One(&rt)
+		if err != nil {
+			logrus.Errorf("sess.Select in refreshTokenHandler %q", err)
+			apierrors.Write(w, apierrors.Unauthorized("Invalid refresh token"))
+			return
+		}
+
+		if rt.Expires.Before(time.Now()) {
+			errorMsg := "Refresh token expired"
+			logrus.Errorf("%s - id: %s userID: %s", errorMsg, rt.ID.UUID, rt.UserID)
+			apierrors.Write(w, apierrors.Unauthorized(errorMsg))
+			return
+		}
+
+		// A refresh token can only be used once, a second use means it leaked:
+		// revoke every refresh token of the userend so that both parties have to log in again.
+		res, err := sess.Update("refreshtokens").Set("revoked", true).Where("id = ?", rt.ID).And("revoked = ?", false).Exec()
+		if err != nil {
+			logrus.Errorf("sess.Update in refreshTokenHandler %q - id: %s", err, rt.ID.UUID)
+			apierrors.Write(w, err)
+			return
+		}
+		if n, err := res.RowsAffected(); err != nil || n == 0 {
+			selector := sess.Update("refreshtokens").Set("revoked", true).Where("userid = ?", rt.UserID)
+			if rt.UserEndID.Valid {
+				selector = selector.And("userendid = ?", rt.UserEndID)
+			} else {
+				selector = selector.And("userendid is null")
+			}
+			if _, err := selector.Exec(); err != nil {
+				logrus.Errorf("sess.Update in refreshTokenHandler %q - userID: %s userEndID: %v", err, rt.UserID, rt.UserEndID)
+			}
+			errorMsg := "Refresh token already used"
+			logrus.Errorf("%s - id: %s userID: %s", errorMsg, rt.ID.UUID, rt.UserID)
+			apierrors.Write(w, apierrors.Unauthorized(errorMsg))
+			return
+		}
+
+		claims := jwt.MapClaims{
+			"userID": rt.UserID.String(),
+		}
+		if rt.UserEndID.Valid {
+			claims["userEndID"] = rt.UserEndID.UUID.String()
+		}
+		tokenString, err := tools.NewAccessToken(claims)
+		if err != nil {
+			logrus.Errorf("tools.NewAccessToken in refreshTokenHandler %q - userID: %s", err, rt.UserID)
+			apierrors.Write(w, err)
+			return
+		}
+
+		refreshToken, err := tools.CreateRefreshToken(sess, rt.UserID, rt.UserEndID)
+		if err != nil {
+			logrus.Errorf("tools.CreateRefreshToken in refreshTokenHandler %q - userID: %s", err, rt.UserID)
+			apierrors.Write(w, err)
+			return
+		}
+
+		w.Header().Set("x-sgl-token", tokenString)
+		w.Header().Set("x-sgl-refresh-token", refreshToken)
+
+		w.WriteHeader(http.StatusOK)
+	})
+}
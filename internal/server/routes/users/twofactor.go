@@ -0,0 +1,315 @@
+/*
+ * Copyright (C) 2021  SuperGreenLab <towelie@supergreenlab.com>
+ * Author: Constantin Clauzel <constantin.clauzel@gmail.com>
+ *
+ * This program is free software: you can redistribute it and/or modify
+ * it under the terms of the GNU General Public License as published by
+ * the Free Software Foundation, either version 3 of the License, or
+ * (at your option) any later version.
+ *
+ * This program is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ * GNU General Public License for more details.
+ *
+ * You should have received a copy of the GNU General Public License
+ * along with this program.  If not, see <http://www.gnu.org/licenses/>.
+ */
+
+package users
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/SuperGreenLab/AppBackend/internal/data/db"
+	"github.com/SuperGreenLab/AppBackend/internal/server/apierrors"
+	"github.com/SuperGreenLab/AppBackend/internal/server/middlewares"
+	"github.com/SuperGreenLab/AppBackend/internal/server/tools"
+	"github.com/gofrs/uuid"
+	"github.com/julienschmidt/httprouter"
+	"github.com/rileyr/middleware"
+	"github.com/sirupsen/logrus"
+	"upper.io/db.v3/lib/sqlbuilder"
+)
+
+const (
+	totpIssuer        = "SuperGreenLab"
+	nRecoveryCodes    = 10
+	recoveryCodeChars = 10
+)
+
+func hasTOTPEnabled(sess sqlbuilder.Database, uid uuid.UUID) (bool, error) {
+	n, err := sess.Collection("usertotps").Find().Where("userid = ?", uid).And("enabled = ?", true).Count()
+	return n > 0, err
+}
+
+type challengeResult struct {
+	TwoFactorRequired bool   `json:"twoFactorRequired"`
+	ChallengeToken    string `json:"challengeToken"`
+}
+
+// challenge - sent by /login instead of the tokens when 2FA is enabled, to be exchanged on /login/2fa
+func challenge(w http.ResponseWriter, uid uuid.UUID) {
+	token, err := tools.NewChallengeToken(uid)
+	if err != nil {
+		logrus.Errorf("tools.NewChallengeToken in challenge %q - uid: %s", err, uid)
+		apierrors.Write(w, err)
+		return
+	}
+	res := challengeResult{TwoFactorRequired: true, ChallengeToken: token}
+	if err := json.NewEncoder(w).Encode(res); err != nil {
+		logrus.Errorf("json.NewEncoder in challenge %q - uid: %s", err, uid)
+		apierrors.Write(w, err)
+		return
+	}
+}
+
+func normalizeRecoveryCode(code string) string {
+	return strings.ToLower(strings.NewReplacer("-", "", " ", "").Replace(code))
+}
+
+// createRecoveryCodes - replaces the previous recovery codes of the user
+func createRecoveryCodes(sess sqlbuilder.SQLBuilder, uid uuid.UUID) ([]string, error) {
+	if _, err := sess.DeleteFrom("recoverycodes").Where("userid = ?", uid).Exec(); err != nil {
+		return nil, err
+	}
+	codes := make([]string, 0, nRecoveryCodes)
+	for i := 0; i < nRecoveryCodes; i++ {
+		token, err := tools.NewRandomToken()
+		if err != nil {
+			return nil, err
+		}
+		code := token[:recoveryCodeChars]
+		rc := db.RecoveryCode{
+			UserID: uid,
+			Code:   tools.HashToken(code),
+		}
+		if _, err := sess.InsertInto("recoverycodes").Values(rc).Exec(); err != nil {
+			return nil, err
+		}
+		codes = append(codes, fmt.Sprintf("%s-%s", code[:recoveryCodeChars/2], code[recoveryCodeChars/2:]))
+	}
+	return codes, nil
+}
+
+// checkSecondFactor - accepts a TOTP code or an unused recovery code, codes can't be used twice
+func checkSecondFactor(sess sqlbuilder.Database, uid uuid.UUID, code string) (bool, error) {
+	ut := db.UserTOTP{}
+	if err := sess.Select("*").From("usertotps").Where("userid = ?", uid).And("enabled = ?", true).One(&ut); err != nil {
+		return false, err
+	}
+
+	if step, ok := tools.ValidateTOTP(ut.Secret, code, time.Now()); ok {
+		res, err := sess.Update("usertotps").Set("laststep", step).Where("id = ?", ut.ID).And("laststep < ?", step).Exec()
+		if err != nil {
+			return false, err
+		}
+		n, err := res.RowsAffected()
+		return n > 0, err
+	}
+
+	res, err := sess.Update("recoverycodes").Set("used", true).Where("userid = ?", uid).And("code = ?", tools.HashToken(normalizeRecoveryCode(code))).And("used = ?", false).Exec()
+	if err != nil {
+		return false, err
+	}
+	n, err := res.RowsAffected()
+	return n > 0, err
+}
+
+type enrollTOTPResult struct {
+	Secret string `json:"secret"`
+	URI    string `json:"uri"`
+}
+
+// enrollTOTPHandler - 2FA is only enabled once a first code is verified
+func enrollTOTPHandler(w http.ResponseWriter, r *http.Request, p httprouter.Params) {
+	sess := r.Context().Value(middlewares.SessContextKey{}).(sqlbuilder.Database)
+	uid := r.Context().Value(middlewares.UserIDContextKey{}).(uuid.UUID)
+
+	enabled, err := hasTOTPEnabled(sess, uid)
+	if err != nil {
+		logrus.Errorf("hasTOTPEnabled in enrollTOTPHandler %q - uid: %s", err, uid)
+		apierrors.Write(w, err)
+		return
+	}
+	if enabled {
+		errorMsg := "2FA already enabled"
+		logrus.Errorf("%s - uid: %s", errorMsg, uid)
+		apierrors.Write(w, apierrors.BadRequest(errorMsg))
+		return
+	}
+
+	user, err := db.GetUser(uid)
+	if err != nil {
+		logrus.Errorf("db.GetUser in enrollTOTPHandler %q - uid: %s", err, uid)
+		apierrors.Write(w, err)
+		return
+	}
+
+	secret, err := tools.NewTOTPSecret()
+	if err != nil {
+		logrus.Errorf("tools.NewTOTPSecret in enrollTOTPHandler %q - uid: %s", err, uid)
+		apierrors.Write(w, err)
+		return
+	}
+
+	if _, err := sess.DeleteFrom("usertotps").Where("userid = ?", uid).Exec(); err != nil {
+		logrus.Errorf("sess.DeleteFrom in enrollTOTPHandler %q - uid: %s", err, uid)
+		apierrors.Write(w, err)
+		return
+	}
+	if _, err := sess.Collection("usertotps").Insert(db.UserTOTP{UserID: uid, Secret: secret}); err != nil {
+		logrus.Errorf("sess.Collection in enrollTOTPHandler %q - uid: %s", err, uid)
+		apierrors.Write(w, err)
+		return
+	}
+
+	res := enrollTOTPResult{Secret: secret, URI: tools.TOTPProvisioningURI(secret, totpIssuer, user.Nickname)}
+	if err := json.NewEncoder(w).Encode(res); err != nil {
+		logrus.Errorf("json.NewEncoder in enrollTOTPHandler %q - uid: %s", err, uid)
+		apierrors.Write(w, err)
+		return
+	}
+}
+
+type totpCodeParams struct {
+	Code string `json:"code"`
+}
+
+type recoveryCodesResult struct {
+	RecoveryCodes []string `json:"recoveryCodes"`
+}
+
+// verifyTOTPHandler - enables 2FA and returns the recovery codes, they are only shown once
+func verifyTOTPHandler() httprouter.Handle {
+	s := middleware.NewStack()
+
+	s.Use(middlewares.DecodeJSON(func() interface{} { return &totpCodeParams{} }))
+
+	return s.Wrap(func(w http.ResponseWriter, r *http.Request, p httprouter.Params) {
+		tcp := r.Context().Value(middlewares.ObjectContextKey{}).(*totpCodeParams)
+		sess := r.Context().Value(middlewares.SessContextKey{}).(sqlbuilder.Database)
+		uid := r.Context().Value(middlewares.UserIDContextKey{}).(uuid.UUID)
+
+		ut := db.UserTOTP{}
+		if err := sess.Select("*").From("usertotps").Where("userid = ?", uid).And("enabled = ?", false).One(&ut); err != nil {
+			errorMsg := "No pending 2FA enrollment"
+			logrus.Errorf("sess.Select in verifyTOTPHandler %q - uid: %s", err, uid)
+			apierrors.Write(w, apierrors.BadRequest(errorMsg))
+			return
+		}
+
+		step, ok := tools.ValidateTOTP(ut.Secret, tcp.Code, time.Now())
+		if !ok {
+			errorMsg := "Invalid code"
+			logrus.Errorf("%s - uid: %s", errorMsg, uid)
+			apierrors.Write(w, apierrors.BadRequest(errorMsg))
+			return
+		}
+
+		var codes []string
+		if err := sess.Tx(r.Context(), func(tx sqlbuilder.Tx) error {
+			if _, err := tx.Update("usertotps").Set("enabled", true, "laststep", step).Where("id = ?", ut.ID).Exec(); err != nil {
+				return err
+			}
+			var err error
+			codes, err = createRecoveryCodes(tx, uid)
+			return err
+		}); err != nil {
+			logrus.Errorf("sess.Tx in verifyTOTPHandler %q - uid: %s", err, uid)
+			apierrors.Write(w, err)
+			return
+		}
+
+		if err := json.NewEncoder(w).Encode(recoveryCodesResult{RecoveryCodes: codes}); err != nil {
+			logrus.Errorf("json.NewEncoder in verifyTOTPHandler %q - uid: %s", err, uid)
+			apierrors.Write(w, err)
+			return
+		}
+	})
+}
+
+// disableTOTPHandler - requires a valid TOTP or recovery code
+func disableTOTPHandler() httprouter.Handle {
+	s := middleware.NewStack()
+
+	s.Use(middlewares.DecodeJSON(func() interface{} { return &totpCodeParams{} }))
+
+	return s.Wrap(func(w http.ResponseWriter, r *http.Request, p httprouter.Params) {
+		tcp := r.Context().Value(middlewares.ObjectContextKey{}).(*totpCodeParams)
+		sess := r.Context().Value(middlewares.SessContextKey{}).(sqlbuilder.Database)
+		uid := r.Context().Value(middlewares.UserIDContextKey{}).(uuid.UUID)
+
+		ok, err := checkSecondFactor(sess, uid, tcp.Code)
+		if err != nil || !ok {
+			errorMsg := "Invalid code"
+			logrus.Errorf("checkSecondFactor in disableTOTPHandler %q - uid: %s", err, uid)
+			apierrors.Write(w, apierrors.BadRequest(errorMsg))
+			return
+		}
+
+		if err := sess.Tx(r.Context(), func(tx sqlbuilder.Tx) error {
+			if _, err := tx.DeleteFrom("usertotps").Where("userid = ?", uid).Exec(); err != nil {
+				return err
+			}
+			_, err := tx.DeleteFrom("recoverycodes").Where("userid = ?", uid).Exec()
+			return err
+		}); err != nil {
+			logrus.Errorf("sess.Tx in disableTOTPHandler %q - uid: %s", err, uid)
+			apierrors.Write(w, err)
+			return
+		}
+
+		w.WriteHeader(http.StatusOK)
+	})
+}
+
+type login2FAParams struct {
+	ChallengeToken string `json:"challengeToken"`
+	Code           string `json:"code"`
+}
+
+// login2FAHandler - exchanges the challenge token returned by /login and a TOTP or recovery code for the usual tokens
+func login2FAHandler() httprouter.Handle {
+	s := middleware.NewStack()
+
+	s.Use(middlewares.DecodeJSON(func() interface{} { return &login2FAParams{} }))
+
+	return s.Wrap(func(w http.ResponseWriter, r *http.Request, p httprouter.Params) {
+		lp := r.Context().Value(middlewares.ObjectContextKey{}).(*login2FAParams)
+		sess := r.Context().Value(middlewares.SessContextKey{}).(sqlbuilder.Database)
+
+		uid, err := tools.ParseChallengeToken(lp.ChallengeToken)
+		if err != nil {
+			logrus.Errorf("tools.ParseChallengeToken in login2FAHandler %q", err)
+			apierrors.Write(w, apierrors.Unauthorized("Access denied"))
+			return
+		}
+
+		key := twoFactorKey(uid)
+		if loginLocked(w, key, ipKey(r)) {
+			return
+		}
+
+		ok, err := checkSecondFactor(sess, uid, lp.Code)
+		if err != nil || !ok {
+			logrus.Errorf("checkSecondFactor in login2FAHandler %q - uid: %s", err, uid)
+			loginFailed(r, key, "wrong_2fa_code")
+			apierrors.Write(w, apierrors.Forbidden("Access denied"))
+			return
+		}
+		loginSucceeded(key)
+
+		if err := setLoginTokens(w, sess, uid); err != nil {
+			logrus.Errorf("setLoginTokens in login2FAHandler %q - uid: %s", err, uid)
+			apierrors.Write(w, err)
+			return
+		}
+
+		w.WriteHeader(http.StatusOK)
+	})
+}
@@ -21,6 +21,8 @@ package server
 import (
 	"net/http"
 
+	"github.com/SuperGreenLab/AppBackend/internal/server/apierrors"
+	"github.com/SuperGreenLab/AppBackend/internal/server/middlewares"
 	"github.com/SuperGreenLab/AppBackend/internal/server/routes/products"
 	"github.com/SuperGreenLab/AppBackend/internal/services/prometheus"
 	"github.com/rs/cors"
@@ -49,14 +51,24 @@ func Start() {
 	storage.SetupBucket("feedmedias")
 	storage.SetupBucket("users")
 	storage.SetupBucket("timelapses")
+	storage.SetupBucket("exports")
 
 	router := httprouter.New()
+	router.NotFound = http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		apierrors.Write(w, apierrors.NotFound("Not found"))
+	})
+	router.PanicHandler = func(w http.ResponseWriter, r *http.Request, err interface{}) {
+		log.Errorf("panic in %s %s - %+v", r.Method, r.URL.String(), err)
+		apierrors.Write(w, apierrors.Internal())
+	}
 
 	users.Init(router)
 	metrics.Init(router)
 	feeds.Init(router)
 	products.Init(router)
 
+	handler := middlewares.RequestID(prometheus.NewHTTPTiming(router))
+
 	go func() {
 		if viper.GetString("AddCORS") == "true" {
 			corsOpts := cors.Options{
@@ -71,12 +83,12 @@ func Start() {
 				},
 				AllowedHeaders:   []string{"*"},
 				AllowCredentials: false,
-				ExposedHeaders:   []string{"x-sgl-token"},
+				ExposedHeaders:   []string{"x-sgl-token", "x-sgl-refresh-token", "ETag", "Idempotent-Replayed", apierrors.RequestIDHeader},
 			}
 
-			log.Fatal(http.ListenAndServe(":8080", cors.New(corsOpts).Handler(prometheus.NewHTTPTiming(router))))
+			log.Fatal(http.ListenAndServe(":8080", cors.New(corsOpts).Handler(handler)))
 		} else {
-			log.Fatal(http.ListenAndServe(":8080", prometheus.NewHTTPTiming(router)))
+			log.Fatal(http.ListenAndServe(":8080", handler))
 		}
 	}()
 }
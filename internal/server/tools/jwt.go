@@ -0,0 +1,124 @@
+/*
+ * Copyright (C) 2021  SuperGreenLab <towelie@supergreenlab.com>
+ * Author: Constantin Clauzel <constantin.clauzel@gmail.com>
+ *
+ * This program is free software: you can redistribute it and/or modify
+ * it under the terms of the GNU General Public License as published by
+ * the Free Software Foundation, either version 3 of the License, or
+ * (at your option) any later version.
+ *
+ * This program is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ * GNU General Public License for more details.
+ *
+ * You should have received a copy of the GNU General Public License
+ * along with this program.  If not, see <http://www.gnu.org/licenses/>.
+ */
+
+package tools
+
+import (
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/SuperGreenLab/AppBackend/internal/data/db"
+	"github.com/dgrijalva/jwt-go"
+	"github.com/gofrs/uuid"
+	"github.com/spf13/pflag"
+	"github.com/spf13/viper"
+	"upper.io/db.v3/lib/sqlbuilder"
+)
+
+var (
+	_ = pflag.String("accesstokenttl", "15m", "Lifetime of the access tokens returned in x-sgl-token")
+	_ = pflag.String("refreshtokenttl", "2160h", "Lifetime of the refresh tokens returned in x-sgl-refresh-token")
+)
+
+func init() {
+	viper.SetDefault("AccessTokenTTL", "15m")
+	viper.SetDefault("RefreshTokenTTL", "2160h")
+}
+
+// NewJWT - signs a JWT token with the given claims, expiring after ttl
+func NewJWT(claims jwt.MapClaims, ttl time.Duration) (string, error) {
+	hmacSampleSecret := []byte(viper.GetString("JWTSecret"))
+	now := time.Now()
+	claims["iat"] = now.Unix()
+	claims["exp"] = now.Add(ttl).Unix()
+	token := jwt.NewWithClaims(jwt.SigningMethodHS256, claims)
+	return token.SignedString(hmacSampleSecret)
+}
+
+// ChallengeTokenType - type claim of the tokens returned by /login when 2FA is enabled, only accepted by /login/2fa
+const ChallengeTokenType = "2fa_challenge"
+
+// NewChallengeToken -
+func NewChallengeToken(uid uuid.UUID) (string, error) {
+	return NewJWT(jwt.MapClaims{
+		"type":            ChallengeTokenType,
+		"challengeUserID": uid.String(),
+	}, 5*time.Minute)
+}
+
+// ParseChallengeToken - returns the userID of a valid challenge token
+func ParseChallengeToken(tokenString string) (uuid.UUID, error) {
+	token, err := jwt.Parse(tokenString, func(token *jwt.Token) (interface{}, error) {
+		if _, ok := token.Method.(*jwt.SigningMethodHMAC); !ok {
+			return nil, fmt.Errorf("Unexpected signing method: %v", token.Header["alg"])
+		}
+		return []byte(viper.GetString("JWTSecret")), nil
+	})
+	if err != nil {
+		return uuid.Nil, err
+	}
+	claims, ok := token.Claims.(jwt.MapClaims)
+	if !ok || !token.Valid || claims["type"] != ChallengeTokenType {
+		return uuid.Nil, errors.New("Invalid challenge token")
+	}
+	uid, _ := claims["challengeUserID"].(string)
+	return uuid.FromString(uid)
+}
+
+// NewAccessToken - signs a short-lived access token, as returned in x-sgl-token
+func NewAccessToken(claims jwt.MapClaims) (string, error) {
+	return NewJWT(claims, viper.GetDuration("AccessTokenTTL"))
+}
+
+// NewRandomToken - opaque token, sent once to the user and only stored hashed
+func NewRandomToken() (string, error) {
+	b := make([]byte, 32)
+	if _, err := rand.Read(b); err != nil {
+		return "", err
+	}
+	return hex.EncodeToString(b), nil
+}
+
+// HashToken - refresh, password reset and email verification tokens are only stored hashed
+func HashToken(token string) string {
+	h := sha256.Sum256([]byte(token))
+	return hex.EncodeToString(h[:])
+}
+
+// CreateRefreshToken - generates and persists a new refresh token for the user/userend pair
+func CreateRefreshToken(sess sqlbuilder.Database, uid uuid.UUID, ueid uuid.NullUUID) (string, error) {
+	token, err := NewRandomToken()
+	if err != nil {
+		return "", err
+	}
+
+	rt := db.RefreshToken{
+		UserID:    uid,
+		UserEndID: ueid,
+		Token:     HashToken(token),
+		Expires:   time.Now().Add(viper.GetDuration("RefreshTokenTTL")),
+	}
+	if _, err := sess.Collection("refreshtokens").Insert(rt); err != nil {
+		return "", err
+	}
+	return token, nil
+}
@@ -0,0 +1,60 @@
+/*
+ * Copyright (C) 2021  SuperGreenLab <towelie@supergreenlab.com>
+ * Author: Constantin Clauzel <constantin.clauzel@gmail.com>
+ *
+ * This program is free software: you can redistribute it and/or modify
+ * it under the terms of the GNU General Public License as published by
+ * the Free Software Foundation, either version 3 of the License, or
+ * (at your option) any later version.
+ *
+ * This program is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ * GNU General Public License for more details.
+ *
+ * You should have received a copy of the GNU General Public License
+ * along with this program.  If not, see <http://www.gnu.org/licenses/>.
+ */
+
+package tools
+
+import (
+	"testing"
+	"time"
+)
+
+// RFC 6238 appendix B, SHA1 vectors, truncated to the 6 digits we use
+var totpRFCKey = []byte("12345678901234567890")
+
+var totpRFCVectors = []struct {
+	t    int64
+	code string
+}{
+	{59, "287082"},
+	{1111111109, "081804"},
+	{1111111111, "050471"},
+	{1234567890, "005924"},
+	{2000000000, "279037"},
+	{20000000000, "353130"},
+}
+
+func TestTOTPCodeRFC6238(t *testing.T) {
+	for _, v := range totpRFCVectors {
+		if code := totpCode(totpRFCKey, v.t/totpPeriod); code != v.code {
+			t.Errorf("totpCode at %d: got %s, want %s", v.t, code, v.code)
+		}
+	}
+}
+
+func TestValidateTOTPRFC6238(t *testing.T) {
+	secret := totpEncoding.EncodeToString(totpRFCKey)
+	for _, v := range totpRFCVectors {
+		step, ok := ValidateTOTP(secret, v.code, time.Unix(v.t, 0))
+		if !ok || step != v.t/totpPeriod {
+			t.Errorf("ValidateTOTP at %d: got (%d, %v), want (%d, true)", v.t, step, ok, v.t/totpPeriod)
+		}
+		if _, ok := ValidateTOTP(secret, v.code, time.Unix(v.t+3*totpPeriod, 0)); ok {
+			t.Errorf("ValidateTOTP at %d: code accepted outside of the skew window", v.t)
+		}
+	}
+}
@@ -0,0 +1,239 @@
+/*
+ * Copyright (C) 2021  SuperGreenLab <towelie@supergreenlab.com>
+ * Author: Constantin Clauzel <constantin.clauzel@gmail.com>
+ *
+ * This program is free software: you can redistribute it and/or modify
+ * it under the terms of the GNU General Public License as published by
+ * the Free Software Foundation, either version 3 of the License, or
+ * (at your option) any later version.
+ *
+ * This program is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ * GNU General Public License for more details.
+ *
+ * You should have received a copy of the GNU General Public License
+ * along with this program.  If not, see <http://www.gnu.org/licenses/>.
+ */
+
+package tools
+
+import (
+	"encoding/json"
+	"fmt"
+	"reflect"
+	"strconv"
+	"strings"
+	"sync"
+	"unicode/utf8"
+
+	"github.com/gofrs/uuid"
+	"gopkg.in/guregu/null.v3"
+)
+
+// FieldError - Field is the json name of the field
+type FieldError struct {
+	Field string `json:"field"`
+	Error string `json:"error"`
+}
+
+// ValidationError - returned by Validate when at least one field is invalid
+type ValidationError struct {
+	Errors []FieldError `json:"errors"`
+}
+
+func (ve *ValidationError) Error() string {
+	msgs := []string{}
+	for _, fe := range ve.Errors {
+		msgs = append(msgs, fmt.Sprintf("%s: %s", fe.Field, fe.Error))
+	}
+	return strings.Join(msgs, ", ")
+}
+
+// Validate - checks the `validate:"required,max=64,json"` tags of the struct fields.
+// required: not empty, max: maximum number of characters, json: valid json document.
+// Null values are only checked by required. Malformed tags are returned as a plain error, not a ValidationError.
+func Validate(o interface{}) error {
+	ve := &ValidationError{Errors: []FieldError{}}
+	if err := validateStruct(reflect.ValueOf(o), ve); err != nil {
+		return err
+	}
+	if len(ve.Errors) != 0 {
+		return ve
+	}
+	return nil
+}
+
+// CheckValidateTags - parses the validate tags of the object's type, meant to be called when building the endpoints
+func CheckValidateTags(o interface{}) error {
+	t := reflect.TypeOf(o)
+	for t != nil && t.Kind() == reflect.Ptr {
+		t = t.Elem()
+	}
+	if t == nil || t.Kind() != reflect.Struct {
+		return nil
+	}
+	_, err := structRules(t)
+	return err
+}
+
+type validateRule struct {
+	Name string
+	Max  int
+}
+
+// fieldRules - Embedded fields are validated with the rules of their own type
+type fieldRules struct {
+	Index    int
+	Name     string
+	Embedded bool
+	Rules    []validateRule
+}
+
+// structRulesCache - the tags of each type are only parsed once
+var structRulesCache sync.Map
+
+func parseValidateRule(rule string) (validateRule, error) {
+	vr := validateRule{Name: rule}
+	arg := ""
+	if i := strings.Index(rule, "="); i >= 0 {
+		vr.Name, arg = rule[:i], rule[i+1:]
+	}
+	switch vr.Name {
+	case "required", "json":
+		if arg != "" {
+			return vr, fmt.Errorf("invalid validate rule %q", rule)
+		}
+	case "max":
+		max, err := strconv.Atoi(arg)
+		if err != nil || max < 0 {
+			return vr, fmt.Errorf("invalid validate rule %q", rule)
+		}
+		vr.Max = max
+	default:
+		return vr, fmt.Errorf("unknown validate rule %q", rule)
+	}
+	return vr, nil
+}
+
+func structRules(t reflect.Type) ([]fieldRules, error) {
+	if rules, ok := structRulesCache.Load(t); ok {
+		return rules.([]fieldRules), nil
+	}
+	rules := []fieldRules{}
+	for i := 0; i < t.NumField(); i++ {
+		f := t.Field(i)
+		if f.Anonymous {
+			ft := f.Type
+			for ft.Kind() == reflect.Ptr {
+				ft = ft.Elem()
+			}
+			if ft.Kind() == reflect.Struct {
+				if _, err := structRules(ft); err != nil {
+					return nil, err
+				}
+			}
+			rules = append(rules, fieldRules{Index: i, Embedded: true})
+			continue
+		}
+		tag := f.Tag.Get("validate")
+		if tag == "" {
+			continue
+		}
+		name := strings.Split(f.Tag.Get("json"), ",")[0]
+		if name == "" {
+			name = f.Name
+		}
+		fr := fieldRules{Index: i, Name: name}
+		for _, rule := range strings.Split(tag, ",") {
+			vr, err := parseValidateRule(rule)
+			if err != nil {
+				return nil, fmt.Errorf("%s.%s: %w", t.Name(), f.Name, err)
+			}
+			fr.Rules = append(fr.Rules, vr)
+		}
+		rules = append(rules, fr)
+	}
+	structRulesCache.Store(t, rules)
+	return rules, nil
+}
+
+func validateStruct(v reflect.Value, ve *ValidationError) error {
+	for v.Kind() == reflect.Ptr || v.Kind() == reflect.Interface {
+		if v.IsNil() {
+			return nil
+		}
+		v = v.Elem()
+	}
+	if v.Kind() != reflect.Struct {
+		return nil
+	}
+	rules, err := structRules(v.Type())
+	if err != nil {
+		return err
+	}
+	for _, fr := range rules {
+		if fr.Embedded {
+			if err := validateStruct(v.Field(fr.Index), ve); err != nil {
+				return err
+			}
+			continue
+		}
+		for _, vr := range fr.Rules {
+			if msg := validateField(v.Field(fr.Index), vr); msg != "" {
+				ve.Errors = append(ve.Errors, FieldError{Field: fr.Name, Error: msg})
+				break
+			}
+		}
+	}
+	return nil
+}
+
+// fieldString - the string value of the field, false if null or not a string
+func fieldString(v reflect.Value) (string, bool) {
+	switch fv := v.Interface().(type) {
+	case string:
+		return fv, true
+	case *string:
+		if fv == nil {
+			return "", false
+		}
+		return *fv, true
+	case null.String:
+		return fv.String, fv.Valid
+	}
+	return "", false
+}
+
+func isEmpty(v reflect.Value) bool {
+	switch fv := v.Interface().(type) {
+	case uuid.UUID:
+		return fv == uuid.Nil
+	case uuid.NullUUID:
+		return !fv.Valid || fv.UUID == uuid.Nil
+	case null.String:
+		return !fv.Valid || strings.TrimSpace(fv.String) == ""
+	case string:
+		return strings.TrimSpace(fv) == ""
+	}
+	return v.IsZero()
+}
+
+// validateField - returns the error message, empty if valid
+func validateField(v reflect.Value, vr validateRule) string {
+	switch vr.Name {
+	case "required":
+		if isEmpty(v) {
+			return "is required"
+		}
+	case "max":
+		if s, ok := fieldString(v); ok && utf8.RuneCountInString(s) > vr.Max {
+			return fmt.Sprintf("must be at most %d characters", vr.Max)
+		}
+	case "json":
+		if s, ok := fieldString(v); ok && !json.Valid([]byte(s)) {
+			return "must be valid JSON"
+		}
+	}
+	return ""
+}
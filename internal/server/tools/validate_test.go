@@ -0,0 +1,105 @@
+/*
+ * Copyright (C) 2021  SuperGreenLab <towelie@supergreenlab.com>
+ * Author: Constantin Clauzel <constantin.clauzel@gmail.com>
+ *
+ * This program is free software: you can redistribute it and/or modify
+ * it under the terms of the GNU General Public License as published by
+ * the Free Software Foundation, either version 3 of the License, or
+ * (at your option) any later version.
+ *
+ * This program is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ * GNU General Public License for more details.
+ *
+ * You should have received a copy of the GNU General Public License
+ * along with this program.  If not, see <http://www.gnu.org/licenses/>.
+ */
+
+package tools
+
+import (
+	"errors"
+	"testing"
+)
+
+type validateTagsBase struct {
+	ID string `json:"id" validate:"required"`
+}
+
+type validateTagsValid struct {
+	validateTagsBase
+	Name     string  `json:"name" validate:"required,max=4"`
+	Settings *string `json:"settings" validate:"json"`
+}
+
+type validateTagsUnknown struct {
+	Name string `json:"name" validate:"required,min=2"`
+}
+
+type validateTagsInvalidMax struct {
+	Name string `json:"name" validate:"max=big"`
+}
+
+type validateTagsEmbedded struct {
+	validateTagsUnknown
+}
+
+func TestValidateTags(t *testing.T) {
+	tests := []struct {
+		o     interface{}
+		valid bool
+	}{
+		{&validateTagsValid{}, true},
+		{&validateTagsUnknown{}, false},
+		{&validateTagsInvalidMax{}, false},
+		{&validateTagsEmbedded{}, false},
+		{&[]validateTagsUnknown{}, true},
+	}
+	for _, tt := range tests {
+		if err := CheckValidateTags(tt.o); (err == nil) != tt.valid {
+			t.Errorf("CheckValidateTags(%T): got %v, want valid %v", tt.o, err, tt.valid)
+		}
+		// malformed tags are returned as an error instead of panicking in the request
+		var ve *ValidationError
+		if err := Validate(tt.o); !tt.valid && (err == nil || errors.As(err, &ve)) {
+			t.Errorf("Validate(%T): got %v, want a tag error", tt.o, err)
+		}
+	}
+}
+
+func TestValidate(t *testing.T) {
+	settings, invalidSettings := `{"a":1}`, `{"a":`
+	tests := []struct {
+		o      validateTagsValid
+		fields []string
+	}{
+		{validateTagsValid{validateTagsBase{"1"}, "abcd", &settings}, nil},
+		{validateTagsValid{validateTagsBase{"1"}, "éèàù", nil}, nil},
+		{validateTagsValid{validateTagsBase{""}, "abcde", nil}, []string{"id", "name"}},
+		{validateTagsValid{validateTagsBase{"1"}, " ", &invalidSettings}, []string{"name", "settings"}},
+	}
+	for _, tt := range tests {
+		err := Validate(&tt.o)
+		fields := []string{}
+		var ve *ValidationError
+		if errors.As(err, &ve) {
+			for _, fe := range ve.Errors {
+				fields = append(fields, fe.Field)
+			}
+		} else if err != nil {
+			t.Errorf("Validate(%+v): unexpected error %q", tt.o, err)
+			continue
+		}
+		if len(fields) != len(tt.fields) {
+			t.Errorf("Validate(%+v): got invalid fields %v, want %v", tt.o, fields, tt.fields)
+			continue
+		}
+		for i := range fields {
+			if fields[i] != tt.fields[i] {
+				t.Errorf("Validate(%+v): got invalid fields %v, want %v", tt.o, fields, tt.fields)
+				break
+			}
+		}
+	}
+}
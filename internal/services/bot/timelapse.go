@@ -28,6 +28,7 @@ import (
 	"time"
 
 	"github.com/SuperGreenLab/AppBackend/internal/data/db"
+	"github.com/SuperGreenLab/AppBackend/internal/server/middlewares"
 	"github.com/SuperGreenLab/AppBackend/internal/server/tools"
 	"github.com/SuperGreenLab/AppBackend/internal/services/cron"
 	appbackend "github.com/SuperGreenLab/AppBackend/pkg"
@@ -41,8 +42,13 @@ import (
 var (
 	_ = pflag.String("timelapseworkeraccesskey", "", "")
 	_ = pflag.String("timelapseworkes", "", "List of base urls for timelapse workers, delimited by comas")
+	_ = pflag.String("timelapseworkertokenttl", "6h", "Lifetime of the tokens sent to the timelapse workers, should cover the longest timelapse job")
 )
 
+func init() {
+	viper.SetDefault("TimelapseWorkerTokenTTL", "6h")
+}
+
 type TimelapseRequest struct {
 	ID     uuid.UUID                   `json:"id"`
 	Token  string                      `json:"token"`
@@ -102,15 +108,14 @@ func SendTimelapseRequest(from, to time.Time, timelapse appbackend.Timelapse) er
 
 	requestID := uuid.Must(uuid.NewV4())
 
-	// TODO DRY with internal/server/routes/users/login.go
-	hmacSampleSecret := []byte(viper.GetString("JWTSecret"))
-	token := jwt.NewWithClaims(jwt.SigningMethodHS256, jwt.MapClaims{
+	// The worker only posts the timelapse's feed entry and medias
+	tokenString, err := tools.NewJWT(jwt.MapClaims{
 		"type":   "timelapse_worker",
 		"userID": timelapse.UserID.String(),
-	})
-	tokenString, err := token.SignedString(hmacSampleSecret)
+		"scopes": []string{middlewares.ScopeFeedEntriesWrite},
+	}, viper.GetDuration("TimelapseWorkerTokenTTL"))
 	if err != nil {
-		logrus.Errorf("token.SignedString in loginHandler %q", err)
+		logrus.Errorf("tools.NewJWT in SendTimelapseRequest %q", err)
 		return err
 	}
 
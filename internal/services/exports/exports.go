@@ -0,0 +1,324 @@
+/*
+ * Copyright (C) 2021  SuperGreenLab <towelie@supergreenlab.com>
+ * Author: Constantin Clauzel <constantin.clauzel@gmail.com>
+ *
+ * This program is free software: you can redistribute it and/or modify
+ * it under the terms of the GNU General Public License as published by
+ * the Free Software Foundation, either version 3 of the License, or
+ * (at your option) any later version.
+ *
+ * This program is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ * GNU General Public License for more details.
+ *
+ * You should have received a copy of the GNU General Public License
+ * along with this program.  If not, see <http://www.gnu.org/licenses/>.
+ */
+
+package exports
+
+import (
+	"archive/zip"
+	"encoding/json"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+	"time"
+
+	"github.com/SuperGreenLab/AppBackend/internal/data/db"
+	"github.com/SuperGreenLab/AppBackend/internal/data/storage"
+	"github.com/SuperGreenLab/AppBackend/internal/server/middlewares"
+	"github.com/SuperGreenLab/AppBackend/internal/services/cron"
+	"github.com/SuperGreenLab/AppBackend/internal/services/pubsub"
+	"github.com/gofrs/uuid"
+	"github.com/minio/minio-go"
+	"github.com/sirupsen/logrus"
+	"github.com/spf13/pflag"
+	"github.com/spf13/viper"
+	"gopkg.in/guregu/null.v3"
+)
+
+// Manifest - manifest.json at the root of the archive
+type Manifest struct {
+	UserID       uuid.UUID      `json:"userID"`
+	ExportedAt   time.Time      `json:"exportedAt"`
+	Collections  map[string]int `json:"collections"`
+	Files        []string       `json:"files"`
+	MissingFiles []string       `json:"missingFiles"`
+}
+
+var (
+	_ = pflag.String("exporttimeout", "1h", "Running exports not updated for this long are marked as failed")
+	_ = pflag.String("exportretention", "168h", "Export archives are removed from storage after this delay")
+	_ = pflag.String("exportconcurrency", "2", "Maximum number of exports running at the same time on an instance")
+)
+
+func init() {
+	viper.SetDefault("ExportTimeout", "1h")
+	viper.SetDefault("ExportRetention", "168h")
+	viper.SetDefault("ExportConcurrency", "2")
+}
+
+// exportSlots - limits the exports running at the same time, they're heavy on memory and storage
+var exportSlots chan struct{}
+
+type storageFile struct {
+	Bucket string
+	Path   string
+}
+
+func listenExportsAdded() {
+	ch := pubsub.SubscribeOject("insert.exports")
+	for c := range ch {
+		e := c.(middlewares.InsertMessage).Object.(*db.Export)
+		id := c.(middlewares.InsertMessage).ID
+		goExport(id, e.UserID)
+	}
+}
+
+// exportsJob - picks up the exports whose publish was lost, and fails the ones left running by a dead instance
+func exportsJob() {
+	n, err := db.FailStaleExports(time.Now().Add(-viper.GetDuration("ExportTimeout")))
+	if err != nil {
+		logrus.Errorf("db.FailStaleExports in exportsJob %q", err)
+	} else if n > 0 {
+		logrus.Infof("Failed %d stale exports", n)
+	}
+
+	exports, err := db.GetPendingExports(time.Now().Add(-time.Minute))
+	if err != nil {
+		logrus.Errorf("db.GetPendingExports in exportsJob %q", err)
+		return
+	}
+	for _, e := range exports {
+		goExport(e.ID.UUID, e.UserID)
+	}
+
+	expireExports()
+}
+
+// expireExports - the archives hold all the user's data, they're only kept for ExportRetention
+func expireExports() {
+	exports, err := db.GetExpiredExports(time.Now().Add(-viper.GetDuration("ExportRetention")))
+	if err != nil {
+		logrus.Errorf("db.GetExpiredExports in expireExports %q", err)
+		return
+	}
+	for _, e := range exports {
+		if e.FilePath.Valid {
+			if err := storage.Client.RemoveObject("exports", e.FilePath.String); err != nil {
+				logrus.Errorf("storage.Client.RemoveObject in expireExports %q - id: %s", err, e.ID.UUID)
+				continue
+			}
+		}
+		if err := db.SetExportExpired(e.ID.UUID); err != nil {
+			logrus.Errorf("db.SetExportExpired in expireExports %q - id: %s", err, e.ID.UUID)
+		}
+	}
+}
+
+// goExport - runs the export in the background once a slot is free
+func goExport(id, userID uuid.UUID) {
+	go func() {
+		exportSlots <- struct{}{}
+		defer func() { <-exportSlots }()
+		runExport(id, userID)
+	}()
+}
+
+// heartbeat - keeps the export's uat fresh until done is closed
+func heartbeat(id uuid.UUID, done chan struct{}) {
+	ticker := time.NewTicker(viper.GetDuration("ExportTimeout") / 4)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-done:
+			return
+		case <-ticker.C:
+			if err := db.TouchExport(id); err != nil {
+				logrus.Errorf("db.TouchExport in heartbeat %q - id: %s", err, id)
+			}
+		}
+	}
+}
+
+func runExport(id, userID uuid.UUID) {
+	ok, err := db.ClaimExport(id)
+	if err != nil {
+		logrus.Errorf("db.ClaimExport in runExport %q - id: %s", err, id)
+		return
+	}
+	if !ok {
+		return
+	}
+	done := make(chan struct{})
+	go heartbeat(id, done)
+	filePath, err := export(id, userID)
+	close(done)
+	if err != nil {
+		logrus.Errorf("export in runExport %q - id: %s userID: %s", err, id, userID)
+		if _, err := db.SetExportStatus(id, db.ExportFailed, null.String{}, null.StringFrom(err.Error())); err != nil {
+			logrus.Errorf("db.SetExportStatus in runExport %q - id: %s", err, id)
+		}
+		return
+	}
+	ok, err = db.SetExportStatus(id, db.ExportDone, null.StringFrom(filePath), null.String{})
+	if err != nil {
+		logrus.Errorf("db.SetExportStatus in runExport %q - id: %s", err, id)
+		return
+	}
+	if !ok {
+		// failed as stale meanwhile, the archive won't be listed
+		logrus.Warnf("Export not running anymore - id: %s", id)
+		if err := storage.Client.RemoveObject("exports", filePath); err != nil {
+			logrus.Errorf("storage.Client.RemoveObject in runExport %q - id: %s", err, id)
+		}
+	}
+}
+
+// export - builds the zip archive in a temp file, then uploads it to the exports bucket
+func export(id, userID uuid.UUID) (string, error) {
+	f, err := ioutil.TempFile("", "export-*.zip")
+	if err != nil {
+		return "", err
+	}
+	defer os.Remove(f.Name())
+	defer f.Close()
+
+	zw := zip.NewWriter(f)
+	manifest := Manifest{
+		UserID:       userID,
+		ExportedAt:   time.Now(),
+		Collections:  map[string]int{},
+		Files:        []string{},
+		MissingFiles: []string{},
+	}
+
+	profile, err := db.GetUserProfileExportJSON(userID)
+	if err != nil {
+		return "", fmt.Errorf("users: %w", err)
+	}
+	if err := writeZipFile(zw, "user.json", profile); err != nil {
+		return "", err
+	}
+	files, err := userPicFiles(userID)
+	if err != nil {
+		return "", err
+	}
+
+	for _, table := range db.UserExportTables {
+		b, err := db.GetUserExportJSON(table, userID)
+		if err != nil {
+			return "", fmt.Errorf("%s: %w", table, err)
+		}
+		if err := writeZipFile(zw, fmt.Sprintf("%s.json", table), b); err != nil {
+			return "", err
+		}
+
+		rows := []map[string]interface{}{}
+		if err := json.Unmarshal(b, &rows); err != nil {
+			return "", fmt.Errorf("%s: %w", table, err)
+		}
+		manifest.Collections[table] = len(rows)
+		files = append(files, storageFiles(table, rows)...)
+	}
+
+	for _, sf := range files {
+		name := fmt.Sprintf("files/%s/%s", sf.Bucket, sf.Path)
+		if err := copyStorageFile(zw, name, sf); err != nil {
+			logrus.Warnf("copyStorageFile in export %q - id: %s file: %+v", err, id, sf)
+			manifest.MissingFiles = append(manifest.MissingFiles, name)
+			continue
+		}
+		manifest.Files = append(manifest.Files, name)
+	}
+
+	mb, err := json.MarshalIndent(manifest, "", "  ")
+	if err != nil {
+		return "", err
+	}
+	if err := writeZipFile(zw, "manifest.json", mb); err != nil {
+		return "", err
+	}
+	if err := zw.Close(); err != nil {
+		return "", err
+	}
+
+	filePath := fmt.Sprintf("%s/%s.zip", userID, id)
+	if _, err := storage.Client.FPutObject("exports", filePath, f.Name(), minio.PutObjectOptions{ContentType: "application/zip"}); err != nil {
+		return "", err
+	}
+	return filePath, nil
+}
+
+func userPicFiles(userID uuid.UUID) ([]storageFile, error) {
+	user, err := db.GetUser(userID)
+	if err != nil {
+		return nil, fmt.Errorf("users: %w", err)
+	}
+	if !user.Pic.Valid || user.Pic.String == "" {
+		return []storageFile{}, nil
+	}
+	return []storageFile{{Bucket: "users", Path: user.Pic.String}}, nil
+}
+
+// storageFiles - files referenced by the rows of the table
+func storageFiles(table string, rows []map[string]interface{}) []storageFile {
+	files := []storageFile{}
+	add := func(bucket string, path interface{}) {
+		if p, ok := path.(string); ok && p != "" {
+			files = append(files, storageFile{Bucket: bucket, Path: p})
+		}
+	}
+	for _, row := range rows {
+		switch table {
+		case "feedmedias":
+			add("feedmedias", row["filepath"])
+			add("feedmedias", row["thumbnailpath"])
+		case "timelapseframes":
+			add("timelapses", row["filepath"])
+		}
+	}
+	return files
+}
+
+func writeZipFile(zw *zip.Writer, name string, b []byte) error {
+	w, err := zw.Create(name)
+	if err != nil {
+		return err
+	}
+	_, err = w.Write(b)
+	return err
+}
+
+// copyStorageFile - medias are already compressed, they're stored as is
+func copyStorageFile(zw *zip.Writer, name string, sf storageFile) error {
+	obj, err := storage.Client.GetObject(sf.Bucket, sf.Path, minio.GetObjectOptions{})
+	if err != nil {
+		return err
+	}
+	defer obj.Close()
+	if _, err := obj.Stat(); err != nil {
+		return err
+	}
+
+	w, err := zw.CreateHeader(&zip.FileHeader{Name: name, Method: zip.Store})
+	if err != nil {
+		return err
+	}
+	_, err = io.Copy(w, obj)
+	return err
+}
+
+// Init -
+func Init() {
+	n := viper.GetInt("ExportConcurrency")
+	if n < 1 {
+		n = 1
+	}
+	exportSlots = make(chan struct{}, n)
+	go listenExportsAdded()
+	cron.SetJob("exports", "*/5 * * * *", exportsJob)
+}
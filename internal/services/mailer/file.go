@@ -0,0 +1,72 @@
+/*
+ * Copyright (C) 2021  SuperGreenLab <towelie@supergreenlab.com>
+ * Author: Constantin Clauzel <constantin.clauzel@gmail.com>
+ *
+ * This program is free software: you can redistribute it and/or modify
+ * it under the terms of the GNU General Public License as published by
+ * the Free Software Foundation, either version 3 of the License, or
+ * (at your option) any later version.
+ *
+ * This program is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ * GNU General Public License for more details.
+ *
+ * You should have received a copy of the GNU General Public License
+ * along with this program.  If not, see <http://www.gnu.org/licenses/>.
+ */
+
+package mailer
+
+import (
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"regexp"
+	"time"
+
+	"github.com/sirupsen/logrus"
+	"github.com/spf13/pflag"
+	"github.com/spf13/viper"
+)
+
+var (
+	_ = pflag.String("mailerdir", "/tmp/appbackend.mails", "Directory where the file mailer writes the emails")
+)
+
+func init() {
+	viper.SetDefault("MailerDir", "/tmp/appbackend.mails")
+}
+
+// FileMailer - writes each email to a file in Dir, or to the logs when Dir is empty, for local testing
+type FileMailer struct {
+	Dir  string
+	From string
+}
+
+// NewFileMailer -
+func NewFileMailer(dir string) FileMailer {
+	return FileMailer{Dir: dir, From: viper.GetString("MailFrom")}
+}
+
+var tokenParam = regexp.MustCompile(`token=[^\s&]+`)
+
+func redactTokens(content string) string {
+	return tokenParam.ReplaceAllString(content, "token=[redacted]")
+}
+
+// Send -
+func (f FileMailer) Send(m Mail) error {
+	content := format(f.From, m)
+	if f.Dir == "" {
+		// the logs are readable by more people than the mailboxes, tokens would give access to the accounts
+		logrus.Infof("Sending mail:\n%s", redactTokens(content))
+		return nil
+	}
+	if err := os.MkdirAll(f.Dir, 0755); err != nil {
+		return err
+	}
+	name := fmt.Sprintf("%d.eml", time.Now().UnixNano())
+	return ioutil.WriteFile(filepath.Join(f.Dir, name), []byte(content), 0644)
+}
@@ -0,0 +1,67 @@
+/*
+ * Copyright (C) 2021  SuperGreenLab <towelie@supergreenlab.com>
+ * Author: Constantin Clauzel <constantin.clauzel@gmail.com>
+ *
+ * This program is free software: you can redistribute it and/or modify
+ * it under the terms of the GNU General Public License as published by
+ * the Free Software Foundation, either version 3 of the License, or
+ * (at your option) any later version.
+ *
+ * This program is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ * GNU General Public License for more details.
+ *
+ * You should have received a copy of the GNU General Public License
+ * along with this program.  If not, see <http://www.gnu.org/licenses/>.
+ */
+
+package mailer
+
+import (
+	"github.com/sirupsen/logrus"
+	"github.com/spf13/pflag"
+	"github.com/spf13/viper"
+)
+
+var (
+	m Mailer
+	_ = pflag.String("mailer", "log", "Mailer implementation, one of smtp, file or log")
+	_ = pflag.String("mailfrom", "SuperGreenLab <noreply@supergreenlab.com>", "Sender address of the emails")
+)
+
+func init() {
+	viper.SetDefault("Mailer", "log")
+	viper.SetDefault("MailFrom", "SuperGreenLab <noreply@supergreenlab.com>")
+}
+
+// Mail -
+type Mail struct {
+	To      string
+	Subject string
+	Body    string
+}
+
+// Mailer - sends the emails, implementations are picked with the --mailer flag
+type Mailer interface {
+	Send(mail Mail) error
+}
+
+// Send - sends a mail with the configured mailer
+func Send(mail Mail) error {
+	return m.Send(mail)
+}
+
+// Init -
+func Init() {
+	switch viper.GetString("Mailer") {
+	case "smtp":
+		m = NewSMTPMailer()
+	case "file":
+		m = NewFileMailer(viper.GetString("MailerDir"))
+	case "log":
+		m = NewFileMailer("")
+	default:
+		logrus.Fatalf("Unknown mailer %q", viper.GetString("Mailer"))
+	}
+}
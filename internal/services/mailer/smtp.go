@@ -0,0 +1,89 @@
+/*
+ * Copyright (C) 2021  SuperGreenLab <towelie@supergreenlab.com>
+ * Author: Constantin Clauzel <constantin.clauzel@gmail.com>
+ *
+ * This program is free software: you can redistribute it and/or modify
+ * it under the terms of the GNU General Public License as published by
+ * the Free Software Foundation, either version 3 of the License, or
+ * (at your option) any later version.
+ *
+ * This program is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ * GNU General Public License for more details.
+ *
+ * You should have received a copy of the GNU General Public License
+ * along with this program.  If not, see <http://www.gnu.org/licenses/>.
+ */
+
+package mailer
+
+import (
+	"fmt"
+	"net"
+	"net/mail"
+	"net/smtp"
+	"strings"
+
+	"github.com/spf13/pflag"
+	"github.com/spf13/viper"
+)
+
+var (
+	_ = pflag.String("smtphost", "", "SMTP server host")
+	_ = pflag.String("smtpport", "587", "SMTP server port")
+	_ = pflag.String("smtpuser", "", "SMTP user")
+	_ = pflag.String("smtppassword", "", "SMTP password")
+)
+
+func init() {
+	viper.SetDefault("SMTPHost", "")
+	viper.SetDefault("SMTPPort", "587")
+	viper.SetDefault("SMTPUser", "")
+	viper.SetDefault("SMTPPassword", "")
+}
+
+// SMTPMailer -
+type SMTPMailer struct {
+	Addr string
+	Auth smtp.Auth
+	From string
+}
+
+// NewSMTPMailer - SMTP mailer configured from the smtp* flags
+func NewSMTPMailer() SMTPMailer {
+	host := viper.GetString("SMTPHost")
+	var auth smtp.Auth
+	if viper.GetString("SMTPUser") != "" {
+		auth = smtp.PlainAuth("", viper.GetString("SMTPUser"), viper.GetString("SMTPPassword"), host)
+	}
+	return SMTPMailer{
+		Addr: net.JoinHostPort(host, viper.GetString("SMTPPort")),
+		Auth: auth,
+		From: viper.GetString("MailFrom"),
+	}
+}
+
+// Send -
+func (s SMTPMailer) Send(m Mail) error {
+	from, err := mail.ParseAddress(s.From)
+	if err != nil {
+		return err
+	}
+	to, err := mail.ParseAddress(m.To)
+	if err != nil {
+		return err
+	}
+	return smtp.SendMail(s.Addr, s.Auth, from.Address, []string{to.Address}, []byte(format(s.From, m)))
+}
+
+func format(from string, m Mail) string {
+	headers := []string{
+		fmt.Sprintf("From: %s", from),
+		fmt.Sprintf("To: %s", m.To),
+		fmt.Sprintf("Subject: %s", m.Subject),
+		"MIME-Version: 1.0",
+		"Content-Type: text/plain; charset=\"utf-8\"",
+	}
+	return fmt.Sprintf("%s\r\n\r\n%s", strings.Join(headers, "\r\n"), strings.ReplaceAll(m.Body, "\n", "\r\n"))
+}
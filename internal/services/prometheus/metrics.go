@@ -44,4 +44,28 @@ var (
 		Name: "appbackend_alerts",
 		Help: "Number of alerts",
 	}, []string{"metric", "type"})
+	loginFailuresCount = promauto.NewCounterVec(prometheus.CounterOpts{
+		Name: "appbackend_login_failures",
+		Help: "Number of failed or rejected logins",
+	}, []string{"reason"})
+	userEndsProvisioningDuration = promauto.NewHistogramVec(prometheus.HistogramOpts{
+		Name: "appbackend_userends_provisioning_duration_seconds",
+		Help: "Duration of the userend objects creation.",
+	}, []string{"type"})
+	userEndObjectsCount = promauto.NewCounterVec(prometheus.CounterOpts{
+		Name: "appbackend_userend_objects",
+		Help: "Number of userend objects created",
+	}, []string{"collection"})
+	userEndsExpiredCount = promauto.NewCounter(prometheus.CounterOpts{
+		Name: "appbackend_userends_expired",
+		Help: "Number of idle userends expired",
+	})
+	userEndsDeletedCount = promauto.NewCounter(prometheus.CounterOpts{
+		Name: "appbackend_userends_deleted",
+		Help: "Number of revoked userends deleted",
+	})
+	userEndObjectsReclaimedCount = promauto.NewCounter(prometheus.CounterOpts{
+		Name: "appbackend_userend_objects_reclaimed",
+		Help: "Number of userend objects removed with expired userends, or when they switch to /sync",
+	})
 )
@@ -68,6 +68,33 @@ func InitAlertTriggered(metric, atype string) {
 	alertsCount.WithLabelValues(metric, atype)
 }
 
+func LoginFailed(reason string) {
+	loginFailuresCount.WithLabelValues(reason).Inc()
+}
+
+// UserEndsProvisioningTimer - kind is "userend" for a new install, "object" for a new object
+func UserEndsProvisioningTimer(kind string) *prometheus.Timer {
+	return prometheus.NewTimer(userEndsProvisioningDuration.WithLabelValues(kind))
+}
+
+func UserEndObjectsCreated(collection string, n int64) {
+	userEndObjectsCount.WithLabelValues(collection).Add(float64(n))
+}
+
+func UserEndExpired(nObjects int64) {
+	userEndsExpiredCount.Inc()
+	userEndObjectsReclaimedCount.Add(float64(nObjects))
+}
+
+func UserEndsDeleted(n int64) {
+	userEndsDeletedCount.Add(float64(n))
+}
+
+// UserEndObjectsReclaimed - userend objects removed when a userend switches to /sync
+func UserEndObjectsReclaimed(nObjects int64) {
+	userEndObjectsReclaimedCount.Add(float64(nObjects))
+}
+
 func Init() {
 	go func() {
 		http.Handle("/metrics", promhttp.Handler())
@@ -68,4 +68,5 @@ func SubscribeControllerIntMetric(topic string) chan ControllerIntMetric {
 func Init() {
 	initRedis()
 	initPubsub()
+	go listenUserEndsDirty()
 }
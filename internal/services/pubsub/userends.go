@@ -0,0 +1,74 @@
+/*
+ * Copyright (C) 2021  SuperGreenLab <towelie@supergreenlab.com>
+ * Author: Constantin Clauzel <constantin.clauzel@gmail.com>
+ *
+ * This program is free software: you can redistribute it and/or modify
+ * it under the terms of the GNU General Public License as published by
+ * the Free Software Foundation, either version 3 of the License, or
+ * (at your option) any later version.
+ *
+ * This program is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ * GNU General Public License for more details.
+ *
+ * You should have received a copy of the GNU General Public License
+ * along with this program.  If not, see <http://www.gnu.org/licenses/>.
+ */
+
+package pubsub
+
+import (
+	"encoding/json"
+	"fmt"
+
+	"github.com/gofrs/uuid"
+	"github.com/sirupsen/logrus"
+)
+
+// UserEndsDirty - objects of the user that the other userends need to sync
+type UserEndsDirty struct {
+	UserID     uuid.UUID     `json:"userID"`
+	UserEndID  uuid.NullUUID `json:"userEndID"` // userend that made the change
+	Collection string        `json:"collection"`
+	IDs        []uuid.UUID   `json:"ids"`
+}
+
+func userEndsTopic(uid uuid.UUID) string {
+	return fmt.Sprintf("userends.%s", uid)
+}
+
+// PublishUserEndsDirty - goes through redis so the userends connected to the other instances get it too
+func PublishUserEndsDirty(msg UserEndsDirty) error {
+	b, err := json.Marshal(msg)
+	if err != nil {
+		return err
+	}
+	return r.Publish(userEndsTopic(msg.UserID), string(b)).Err()
+}
+
+// SubscribeUserEndsDirty - the channel must be released with UnsubscribeUserEndsDirty
+func SubscribeUserEndsDirty(uid uuid.UUID) chan interface{} {
+	return ps.Sub(userEndsTopic(uid))
+}
+
+// UnsubscribeUserEndsDirty - the channel has to be drained until it's closed
+func UnsubscribeUserEndsDirty(ch chan interface{}) {
+	go ps.Unsub(ch)
+	for range ch {
+	}
+}
+
+// listenUserEndsDirty - one redis subscription per instance, dispatched to the local connections
+func listenUserEndsDirty() {
+	rps := r.PSubscribe("userends.*")
+	for msg := range rps.Channel() {
+		m := UserEndsDirty{}
+		if err := json.Unmarshal([]byte(msg.Payload), &m); err != nil {
+			logrus.Errorf("json.Unmarshal in listenUserEndsDirty %q - %+v", err, msg)
+			continue
+		}
+		// slow connections must not block the other subscribers, they'll catch up on their next sync
+		ps.TryPub(m, msg.Channel)
+	}
+}
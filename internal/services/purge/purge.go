@@ -0,0 +1,70 @@
+/*
+ * Copyright (C) 2021  SuperGreenLab <towelie@supergreenlab.com>
+ * Author: Constantin Clauzel <constantin.clauzel@gmail.com>
+ *
+ * This program is free software: you can redistribute it and/or modify
+ * it under the terms of the GNU General Public License as published by
+ * the Free Software Foundation, either version 3 of the License, or
+ * (at your option) any later version.
+ *
+ * This program is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ * GNU General Public License for more details.
+ *
+ * You should have received a copy of the GNU General Public License
+ * along with this program.  If not, see <http://www.gnu.org/licenses/>.
+ */
+
+package purge
+
+import (
+	"context"
+
+	"github.com/SuperGreenLab/AppBackend/internal/data/db"
+	"github.com/SuperGreenLab/AppBackend/internal/data/storage"
+	"github.com/SuperGreenLab/AppBackend/internal/services/cron"
+	"github.com/gofrs/uuid"
+	"github.com/sirupsen/logrus"
+	"upper.io/db.v3/lib/sqlbuilder"
+)
+
+func purgeJob() {
+	users := []db.User{}
+	if err := db.Sess.Select("id").From("users").Where("deleted = ?", true).And("purgeat <= now()").All(&users); err != nil {
+		logrus.Errorf("db.Sess.Select in purgeJob %q", err)
+		return
+	}
+	for _, u := range users {
+		if err := purgeUser(u.ID.UUID); err != nil {
+			logrus.Errorf("purgeUser in purgeJob %q - userID: %s", err, u.ID.UUID)
+		}
+	}
+}
+
+// purgeUser - storage objects are only removed once the rows are gone
+func purgeUser(userID uuid.UUID) error {
+	objects, err := db.GetUserStorageObjects(db.Sess, userID)
+	if err != nil {
+		return err
+	}
+
+	if err := db.Sess.Tx(context.Background(), func(tx sqlbuilder.Tx) error {
+		return db.PurgeUser(tx, userID)
+	}); err != nil {
+		return err
+	}
+
+	for _, o := range objects {
+		if err := storage.Client.RemoveObject(o.Bucket, o.Path); err != nil {
+			logrus.Errorf("storage.Client.RemoveObject in purgeUser %q - userID: %s object: %+v", err, userID, o)
+		}
+	}
+	logrus.Infof("Purged user %s, removed %d storage objects", userID, len(objects))
+	return nil
+}
+
+// Init -
+func Init() {
+	cron.SetJob("purge", "*/5 * * * *", purgeJob)
+}
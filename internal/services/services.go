@@ -23,11 +23,15 @@ import (
 	"github.com/SuperGreenLab/AppBackend/internal/services/bot"
 	"github.com/SuperGreenLab/AppBackend/internal/services/cron"
 	"github.com/SuperGreenLab/AppBackend/internal/services/discord"
+	"github.com/SuperGreenLab/AppBackend/internal/services/exports"
+	"github.com/SuperGreenLab/AppBackend/internal/services/mailer"
 	"github.com/SuperGreenLab/AppBackend/internal/services/notifications"
 	"github.com/SuperGreenLab/AppBackend/internal/services/prometheus"
 	"github.com/SuperGreenLab/AppBackend/internal/services/pubsub"
+	"github.com/SuperGreenLab/AppBackend/internal/services/purge"
 	"github.com/SuperGreenLab/AppBackend/internal/services/slack"
 	"github.com/SuperGreenLab/AppBackend/internal/services/social"
+	"github.com/SuperGreenLab/AppBackend/internal/services/userends"
 )
 
 func Init() {
@@ -35,9 +39,13 @@ func Init() {
 	pubsub.Init()
 	cron.Init()
 	notifications.Init()
+	mailer.Init()
 	social.Init()
 	alerts.Init()
 	slack.Init()
 	discord.Init()
 	bot.Init()
+	exports.Init()
+	purge.Init()
+	userends.Init()
 }
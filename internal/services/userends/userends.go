@@ -0,0 +1,89 @@
+/*
+ * Copyright (C) 2021  SuperGreenLab <towelie@supergreenlab.com>
+ * Author: Constantin Clauzel <constantin.clauzel@gmail.com>
+ *
+ * This program is free software: you can redistribute it and/or modify
+ * it under the terms of the GNU General Public License as published by
+ * the Free Software Foundation, either version 3 of the License, or
+ * (at your option) any later version.
+ *
+ * This program is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ * GNU General Public License for more details.
+ *
+ * You should have received a copy of the GNU General Public License
+ * along with this program.  If not, see <http://www.gnu.org/licenses/>.
+ */
+
+package userends
+
+import (
+	"context"
+	"time"
+
+	"github.com/SuperGreenLab/AppBackend/internal/data/db"
+	"github.com/SuperGreenLab/AppBackend/internal/services/cron"
+	"github.com/SuperGreenLab/AppBackend/internal/services/prometheus"
+	"github.com/sirupsen/logrus"
+	"github.com/spf13/pflag"
+	"github.com/spf13/viper"
+	"upper.io/db.v3/lib/sqlbuilder"
+)
+
+var (
+	_ = pflag.String("userendidleexpiration", "2160h", "Userends not seen for this long are revoked and their sync data removed")
+	_ = pflag.String("userendretention", "720h", "Revoked userends are deleted after this delay")
+)
+
+func init() {
+	viper.SetDefault("UserEndIdleExpiration", "2160h")
+	viper.SetDefault("UserEndRetention", "720h")
+}
+
+// expireUserEndsJob - revokes the userends idle for longer than UserEndIdleExpiration
+func expireUserEndsJob() {
+	idle := viper.GetDuration("UserEndIdleExpiration")
+	if idle <= 0 {
+		return
+	}
+	userEnds := []db.UserEnd{}
+	if err := db.Sess.Select("id", "userid").From("userends").Where("revoked = ?", false).And("lastseen < ?", time.Now().Add(-idle)).All(&userEnds); err != nil {
+		logrus.Errorf("db.Sess.Select in expireUserEndsJob %q", err)
+		return
+	}
+	for _, ue := range userEnds {
+		var n int64
+		if err := db.Sess.Tx(context.Background(), func(tx sqlbuilder.Tx) error {
+			var err error
+			n, err = db.ExpireUserEnd(tx, ue.ID.UUID)
+			return err
+		}); err != nil {
+			logrus.Errorf("db.ExpireUserEnd in expireUserEndsJob %q - userEndID: %s", err, ue.ID.UUID)
+			continue
+		}
+		prometheus.UserEndExpired(n)
+	}
+	if len(userEnds) > 0 {
+		logrus.Infof("Expired %d idle userends", len(userEnds))
+	}
+
+	var n int64
+	if err := db.Sess.Tx(context.Background(), func(tx sqlbuilder.Tx) error {
+		var err error
+		n, err = db.DeleteRevokedUserEnds(tx, time.Now().Add(-viper.GetDuration("UserEndRetention")))
+		return err
+	}); err != nil {
+		logrus.Errorf("db.DeleteRevokedUserEnds in expireUserEndsJob %q", err)
+		return
+	}
+	prometheus.UserEndsDeleted(n)
+	if n > 0 {
+		logrus.Infof("Deleted %d revoked userends", n)
+	}
+}
+
+// Init -
+func Init() {
+	cron.SetJob("userends", "17 * * * *", expireUserEndsJob)
+}
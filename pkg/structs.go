@@ -32,9 +32,9 @@ type Box struct {
 	DeviceID  uuid.NullUUID `db:"deviceid" json:"deviceID"`
 	DeviceBox *uint         `db:"devicebox,omitempty" json:"deviceBox,omitempty"`
 	FeedID    uuid.NullUUID `db:"feedid" json:"feedID"`
-	Name      string        `db:"name" json:"name"`
+	Name      string        `db:"name" json:"name" validate:"required,max=64"`
 
-	Settings string `db:"settings" json:"settings"`
+	Settings string `db:"settings" json:"settings" validate:"json"`
 
 	Deleted bool `db:"deleted" json:"deleted"`
 
@@ -73,12 +73,12 @@ type Plant struct {
 	UserID        uuid.UUID     `db:"userid" json:"userID"`
 	BoxID         uuid.UUID     `db:"boxid" json:"boxID"`
 	FeedID        uuid.UUID     `db:"feedid" json:"feedID"`
-	Name          string        `db:"name" json:"name"`
+	Name          string        `db:"name" json:"name" validate:"required,max=64"`
 	Single        bool          `db:"single" json:"single"` // TODO remove this field
 	Public        bool          `db:"is_public" json:"public"`
 	AlertsEnabled bool          `db:"alerts_enabled" json:"alertsEnabled"`
 
-	Settings string `db:"settings" json:"settings"`
+	Settings string `db:"settings" json:"settings" validate:"json"`
 
 	Deleted  bool `db:"deleted" json:"deleted"`
 	Archived bool `db:"archived" json:"archived"`
@@ -119,7 +119,7 @@ type Timelapse struct {
 	PlantID uuid.UUID     `db:"plantid" json:"plantID"`
 
 	Type     string `db:"ttype" json:"type"`
-	Settings string `db:"settings" json:"settings"`
+	Settings string `db:"settings" json:"settings" validate:"json"`
 
 	Deleted bool `db:"deleted" json:"deleted"`
 
@@ -159,7 +159,7 @@ type TimelapseFrame struct {
 	TimelapseID uuid.UUID     `db:"timelapseid" json:"timelapseID"`
 
 	FilePath string `db:"filepath" json:"filePath"`
-	Meta     string `db:"meta" json:"meta"`
+	Meta     string `db:"meta" json:"meta" validate:"json"`
 
 	CreatedAt time.Time `db:"cat,omitempty" json:"cat"`
 	UpdatedAt time.Time `db:"uat,omitempty" json:"uat"`
@@ -211,10 +211,10 @@ func (os TimelapseFrames) Each(fn func(Object)) {
 type Device struct {
 	ID         uuid.NullUUID `db:"id,omitempty" json:"id"`
 	UserID     uuid.UUID     `db:"userid" json:"userID"`
-	Identifier string        `db:"identifier" json:"identifier"`
-	Name       string        `db:"name" json:"name"`
-	IP         string        `db:"ip" json:"ip"`
-	Mdns       string        `db:"mdns" json:"mdns"`
+	Identifier string        `db:"identifier" json:"identifier" validate:"required,max=16"`
+	Name       string        `db:"name" json:"name" validate:"max=24"`
+	IP         string        `db:"ip" json:"ip" validate:"max=15"`
+	Mdns       string        `db:"mdns" json:"mdns" validate:"max=64"`
 
 	Deleted bool `db:"deleted" json:"deleted"`
 
@@ -251,7 +251,7 @@ func (os Devices) Each(fn func(Object)) {
 type Feed struct {
 	ID         uuid.NullUUID `db:"id,omitempty" json:"id"`
 	UserID     uuid.UUID     `db:"userid" json:"userID"`
-	Name       string        `db:"name" json:"name"`
+	Name       string        `db:"name" json:"name" validate:"max=24"`
 	IsNewsFeed bool          `db:"isnewsfeed" json:"isNewsFeed"`
 
 	Deleted bool `db:"deleted" json:"deleted"`
@@ -291,10 +291,10 @@ type FeedEntry struct {
 	UserID uuid.UUID     `db:"userid" json:"userID"`
 	FeedID uuid.UUID     `db:"feedid" json:"feedID"`
 	Date   time.Time     `db:"createdat" json:"date"`
-	Type   string        `db:"etype" json:"type"`
+	Type   string        `db:"etype" json:"type" validate:"required,max=24"`
 
-	Params string      `db:"params" json:"params"`
-	Meta   null.String `db:"meta,omitempty" json:"meta,omitempty"`
+	Params string      `db:"params" json:"params" validate:"json"`
+	Meta   null.String `db:"meta,omitempty" json:"meta,omitempty" validate:"json"`
 
 	Deleted bool `db:"deleted" json:"deleted"`
 
@@ -339,7 +339,7 @@ type FeedMedia struct {
 	FilePath      string        `db:"filepath" json:"filePath"`
 	ThumbnailPath string        `db:"thumbnailpath" json:"thumbnailPath"`
 
-	Params string `db:"params" json:"params"`
+	Params string `db:"params" json:"params" validate:"json"`
 
 	Deleted bool `db:"deleted" json:"deleted"`
 